@@ -0,0 +1,313 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Cheejyg/Flo-Energy-Tech-Assessment/nem12"
+)
+
+func init() {
+	RegisterSink("aggregate", func(config *SinkConfig) (Sink, error) {
+		if config.Append {
+			return nil, ErrSinkNotResumable
+		}
+
+		period := sinkOption(config.Options, "period", "day")
+		format := reportFormat(config)
+		dates, err := parseDatesOption(config.Options)
+		if err != nil {
+			return nil, err
+		}
+
+		return newFileSink(config, func(writer io.Writer) (Sink, error) {
+			return NewAggregateWriter(writer, period, format, dates)
+		})
+	})
+}
+
+// parseDatesOption parses the comma-separated YYYY-MM-DD dates option.
+func parseDatesOption(options url.Values) ([]time.Time, error) {
+	var dates []time.Time
+	for _, value := range options["dates"] {
+		for _, date := range strings.Split(value, ",") {
+			t, err := nem12.ParseDate8(strings.ReplaceAll(date, "-", ""))
+			if err != nil {
+				return nil, fmt.Errorf("%w: dates: %s", ErrInvalidSinkOption, date)
+			}
+			dates = append(dates, t)
+		}
+	}
+
+	return dates, nil
+}
+
+const aggregateScale int = 6
+
+var ErrInvalidAggregatePeriod = errors.New("invalid aggregate period, want day, month or billing")
+var ErrInvalidAggregateFormat = errors.New("invalid aggregate format, want csv or json")
+
+// aggregate summarises interval readings. Values are scaled by 10^aggregateScale.
+type aggregate struct {
+	Count       int
+	Total       int64
+	Min         int64
+	Max         int64
+	Peak        time.Time // End of the interval with the largest value.
+	Substituted int       // Readings with quality flag S or F.
+	Estimated   int       // Readings with quality flag E.
+}
+
+func (aggregate *aggregate) add(value int64, timestamp time.Time, qualityMethod string) {
+	if aggregate.Count == 0 || value < aggregate.Min {
+		aggregate.Min = value
+	}
+	if aggregate.Count == 0 || value > aggregate.Max {
+		aggregate.Max = value
+		aggregate.Peak = timestamp
+	}
+	aggregate.Count++
+	aggregate.Total += value
+
+	if qualityMethod != "" {
+		switch qualityMethod[0] {
+		case 'S', 'F':
+			aggregate.Substituted++
+		case 'E':
+			aggregate.Estimated++
+		}
+	}
+}
+func (aggregate *aggregate) merge(other *aggregate) {
+	if other.Count == 0 {
+		return
+	}
+	if aggregate.Count == 0 || other.Min < aggregate.Min {
+		aggregate.Min = other.Min
+	}
+	if aggregate.Count == 0 || other.Max > aggregate.Max {
+		aggregate.Max = other.Max
+		aggregate.Peak = other.Peak
+	}
+	aggregate.Count += other.Count
+	aggregate.Total += other.Total
+	aggregate.Substituted += other.Substituted
+	aggregate.Estimated += other.Estimated
+}
+
+// aggregateDay is the aggregate of one channel's interval date, from the last 300 record read for it.
+type aggregateDay struct {
+	aggregate
+	Source     *SourceFile
+	LineNumber int
+}
+
+// AggregateWriter totals meter readings per NMI channel per day, month or billing period, and writes the totals as CSV or JSON on Close.
+//
+// Billing periods run between the given dates, or, if there are none, between the NextScheduledReadDates of each NMI's 200 records. Readings before the first or after the last date fall in an open-ended period.
+type AggregateWriter struct {
+	report *reportWriter
+	period string
+	dates  []time.Time
+
+	days              map[StoreSeries]map[time.Time]*aggregateDay
+	nextScheduledRead map[string]map[time.Time]bool
+}
+
+func NewAggregateWriter(writer io.Writer, period string, format string, dates []time.Time) (*AggregateWriter, error) {
+	if period != "day" && period != "month" && period != "billing" {
+		return nil, ErrInvalidAggregatePeriod
+	}
+	report, err := newReportWriter(writer, format)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AggregateWriter{
+		report:            report,
+		period:            period,
+		dates:             dates,
+		days:              make(map[StoreSeries]map[time.Time]*aggregateDay, 16),
+		nextScheduledRead: make(map[string]map[time.Time]bool, 16),
+	}, nil
+}
+
+func (aggregateWriter *AggregateWriter) WriteBatch(meterReadingsJob []*MeterReadingsJob) error {
+	for _, job := range meterReadingsJob {
+		value, err := nem12.ParseIntervalValueDecimal(job.Consumption, aggregateScale)
+		if err != nil {
+			return err
+		}
+
+		channel := StoreSeries{job.Nmi, job.NmiSuffix, job.Uom}
+		days := aggregateWriter.days[channel]
+		if days == nil {
+			days = make(map[time.Time]*aggregateDay, 64)
+			aggregateWriter.days[channel] = days
+		}
+
+		date := job.Timestamp.Add(-job.IntervalLength).Truncate(24 * time.Hour)
+		if job.IntervalData != nil {
+			date = job.IntervalData.IntervalDate
+		}
+		day := days[date]
+		// A day sent again in a later 300 record replaces the earlier one.
+		if day == nil || day.Source != job.Source || day.LineNumber != job.LineNumber {
+			day = &aggregateDay{Source: job.Source, LineNumber: job.LineNumber}
+			days[date] = day
+		}
+		day.add(value, job.Timestamp, job.QualityMethod)
+
+		if job.NmiDataDetails != nil && job.NmiDataDetails.NextScheduledReadDate != nil {
+			nextScheduledRead := aggregateWriter.nextScheduledRead[job.Nmi]
+			if nextScheduledRead == nil {
+				nextScheduledRead = make(map[time.Time]bool, 4)
+				aggregateWriter.nextScheduledRead[job.Nmi] = nextScheduledRead
+			}
+			nextScheduledRead[*job.NmiDataDetails.NextScheduledReadDate] = true
+		}
+	}
+
+	return nil
+}
+
+// periodOf returns the period date falls in, as [start, end); zero times are open ends.
+func (aggregateWriter *AggregateWriter) periodOf(date time.Time, boundaries []time.Time) (start time.Time, end time.Time) {
+	switch aggregateWriter.period {
+	case "day":
+		return date, date.AddDate(0, 0, 1)
+	case "month":
+		start = time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0)
+	}
+
+	return billingPeriodOf(date, boundaries)
+}
+
+// billingPeriodOf returns the billing period date falls in between sorted boundaries, as [start, end); zero times are open ends.
+func billingPeriodOf(date time.Time, boundaries []time.Time) (start time.Time, end time.Time) {
+	i := sort.Search(len(boundaries), func(i int) bool {
+		return boundaries[i].After(date)
+	})
+	if i > 0 {
+		start = boundaries[i-1]
+	}
+	if i < len(boundaries) {
+		end = boundaries[i]
+	}
+	return
+}
+
+// billingBoundaries returns dates if there are any, otherwise nextScheduledRead, sorted.
+func billingBoundaries(dates []time.Time, nextScheduledRead map[time.Time]bool) []time.Time {
+	boundaries := append([]time.Time(nil), dates...)
+	if len(boundaries) == 0 {
+		for date := range nextScheduledRead {
+			boundaries = append(boundaries, date)
+		}
+	}
+	sort.Slice(boundaries, func(i, j int) bool {
+		return boundaries[i].Before(boundaries[j])
+	})
+
+	return boundaries
+}
+
+func appendAggregateDate(b []byte, t time.Time, report *reportWriter) []byte {
+	if t.IsZero() {
+		return report.AppendNull(b)
+	}
+	return report.AppendDate(b, t)
+}
+func appendAggregateShare(b []byte, n int, count int) []byte {
+	return strconv.AppendFloat(b, float64(n)/float64(count), 'f', 4, 64)
+}
+
+func (aggregateWriter *AggregateWriter) appendRecord(b []byte, channel StoreSeries, start time.Time, end time.Time, aggregate *aggregate) []byte {
+	report := aggregateWriter.report
+	b = report.Field(b, "nmi")
+	b = report.AppendString(b, channel.Nmi)
+	b = report.Field(b, "nmi_suffix")
+	b = report.AppendString(b, channel.NmiSuffix)
+	b = report.Field(b, "uom")
+	b = report.AppendString(b, channel.Uom)
+	b = report.Field(b, "period")
+	b = report.AppendString(b, aggregateWriter.period)
+	b = report.Field(b, "start")
+	b = appendAggregateDate(b, start, report)
+	b = report.Field(b, "end")
+	b = appendAggregateDate(b, end, report)
+	b = report.Field(b, "count")
+	b = strconv.AppendInt(b, int64(aggregate.Count), 10)
+	b = report.Field(b, "total")
+	b = appendScaledDecimal(b, aggregate.Total, aggregateScale)
+	b = report.Field(b, "min")
+	b = appendScaledDecimal(b, aggregate.Min, aggregateScale)
+	b = report.Field(b, "max")
+	b = appendScaledDecimal(b, aggregate.Max, aggregateScale)
+	b = report.Field(b, "peak_timestamp")
+	b = report.AppendTimestamp(b, aggregate.Peak)
+	b = report.Field(b, "substituted_share")
+	b = appendAggregateShare(b, aggregate.Substituted, aggregate.Count)
+	b = report.Field(b, "estimated_share")
+	b = appendAggregateShare(b, aggregate.Estimated, aggregate.Count)
+	return b
+}
+
+func (aggregateWriter *AggregateWriter) Flush() error {
+	return nil
+}
+
+// Close writes every channel's periods in order. It does not close the underlying writer.
+func (aggregateWriter *AggregateWriter) Close() error {
+	channels := sortedChannels(aggregateWriter.days)
+
+	report := aggregateWriter.report
+	if err := report.Begin("nmi,nmi_suffix,uom,period,start,end,count,total,min,max,peak_timestamp,substituted_share,estimated_share"); err != nil {
+		return err
+	}
+
+	line := make([]byte, 0, 256)
+	for _, channel := range channels {
+		days := aggregateWriter.days[channel]
+		dates := make([]time.Time, 0, len(days))
+		for date := range days {
+			dates = append(dates, date)
+		}
+		sort.Slice(dates, func(i, j int) bool {
+			return dates[i].Before(dates[j])
+		})
+		boundaries := billingBoundaries(aggregateWriter.dates, aggregateWriter.nextScheduledRead[channel.Nmi])
+
+		var period aggregate
+		var start, end time.Time
+		for i, date := range dates {
+			dateStart, dateEnd := aggregateWriter.periodOf(date, boundaries)
+			if i > 0 && (!dateStart.Equal(start) || !dateEnd.Equal(end)) {
+				line = aggregateWriter.appendRecord(line[:0], channel, start, end, &period)
+				if err := report.Record(line); err != nil {
+					return err
+				}
+				period = aggregate{}
+			}
+			start, end = dateStart, dateEnd
+			period.merge(&days[date].aggregate)
+		}
+		if len(dates) > 0 {
+			line = aggregateWriter.appendRecord(line[:0], channel, start, end, &period)
+			if err := report.Record(line); err != nil {
+				return err
+			}
+		}
+	}
+
+	return report.End()
+}
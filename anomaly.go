@@ -0,0 +1,252 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Cheejyg/Flo-Energy-Tech-Assessment/nem12"
+)
+
+func init() {
+	RegisterSink("anomaly", func(config *SinkConfig) (Sink, error) {
+		if config.Append {
+			return nil, ErrSinkNotResumable
+		}
+
+		window, err := strconv.Atoi(sinkOption(config.Options, "window", "48"))
+		if err != nil || window < 2 {
+			return nil, fmt.Errorf("%w: window %q, want a number of intervals", ErrInvalidSinkOption, config.Options.Get("window"))
+		}
+		thresholds := make(map[string]float64, 3)
+		for _, option := range []struct{ name, value string }{{"spike", "4"}, {"step", "3"}, {"max", "0"}} {
+			threshold, err := strconv.ParseFloat(sinkOption(config.Options, option.name, option.value), 64)
+			if err != nil || threshold < 0 {
+				return nil, fmt.Errorf("%w: %s %q, want a number", ErrInvalidSinkOption, option.name, config.Options.Get(option.name))
+			}
+			thresholds[option.name] = threshold
+		}
+		flatline, err := time.ParseDuration(sinkOption(config.Options, "flatline", "6h"))
+		if err != nil || flatline <= 0 {
+			return nil, fmt.Errorf("%w: flatline %q, want a duration", ErrInvalidSinkOption, config.Options.Get("flatline"))
+		}
+		format := reportFormat(config)
+
+		return newFileSink(config, func(writer io.Writer) (Sink, error) {
+			return NewAnomalyWriter(writer, window, thresholds["spike"], thresholds["step"], flatline, thresholds["max"], format)
+		})
+	})
+}
+
+const (
+	anomalySpike    = "spike"
+	anomalyStep     = "step"
+	anomalyFlatline = "flatline"
+	anomalyMax      = "max"
+)
+
+type anomalyReading struct {
+	Timestamp      time.Time // End of the interval.
+	IntervalLength time.Duration
+	Value          float64
+}
+
+// anomaly is one finding. Baseline is NaN where there is none.
+type anomaly struct {
+	Timestamp time.Time
+	Anomaly   string
+	Value     float64
+	Baseline  float64
+	Score     float64
+}
+
+// AnomalyWriter flags anomalous interval values per NMI channel, and writes them as CSV or JSON on Close:
+//
+//   - spike: a value Spike or more standard deviations from the mean of the Window intervals before it. Score is the number of standard deviations.
+//   - step: a change of Step or more pooled standard deviations between the means of the Window intervals before and after an interval; the largest of consecutive changes is reported. Score is the number of standard deviations.
+//   - flatline: the same non-zero value for Flatline or longer. Score is the length of the run over Flatline.
+//   - max: average demand over the interval above Max kW (or kVAr), for energy channels, if Max is set. Score is the demand over Max.
+//
+// A reading sent again replaces the earlier one.
+type AnomalyWriter struct {
+	report   *reportWriter
+	window   int
+	spike    float64
+	step     float64
+	flatline time.Duration
+	max      float64
+
+	readings map[StoreSeries]map[int64]anomalyReading
+}
+
+func NewAnomalyWriter(writer io.Writer, window int, spike float64, step float64, flatline time.Duration, max float64, format string) (*AnomalyWriter, error) {
+	report, err := newReportWriter(writer, format)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AnomalyWriter{
+		report:   report,
+		window:   window,
+		spike:    spike,
+		step:     step,
+		flatline: flatline,
+		max:      max,
+		readings: make(map[StoreSeries]map[int64]anomalyReading, 16),
+	}, nil
+}
+
+func (anomalyWriter *AnomalyWriter) WriteBatch(meterReadingsJob []*MeterReadingsJob) error {
+	for _, job := range meterReadingsJob {
+		value, err := nem12.ParseIntervalValue(job.Consumption)
+		if err != nil {
+			return err
+		}
+
+		channel := StoreSeries{job.Nmi, job.NmiSuffix, job.Uom}
+		readings := anomalyWriter.readings[channel]
+		if readings == nil {
+			readings = make(map[int64]anomalyReading, 1024)
+			anomalyWriter.readings[channel] = readings
+		}
+		readings[job.Timestamp.Unix()] = anomalyReading{job.Timestamp, job.IntervalLength, value}
+	}
+
+	return nil
+}
+
+// anomalyStats returns the mean and standard deviation of readings.
+func anomalyStats(readings []anomalyReading) (mean float64, deviation float64) {
+	for _, reading := range readings {
+		mean += reading.Value
+	}
+	mean /= float64(len(readings))
+	for _, reading := range readings {
+		deviation += (reading.Value - mean) * (reading.Value - mean)
+	}
+	return mean, math.Sqrt(deviation / float64(len(readings)))
+}
+
+// anomalyScore returns difference in standard deviations. A deviation too small to measure is taken as 1% of the mean, or 0.001.
+func anomalyScore(difference float64, mean float64, deviation float64) float64 {
+	return math.Abs(difference) / math.Max(deviation, math.Max(math.Abs(mean)/100, 0.001))
+}
+
+// anomalies returns the findings of one channel by timestamp.
+func (anomalyWriter *AnomalyWriter) anomalies(channel StoreSeries, byTimestamp map[int64]anomalyReading) []anomaly {
+	readings := make([]anomalyReading, 0, len(byTimestamp))
+	for _, reading := range byTimestamp {
+		readings = append(readings, reading)
+	}
+	sort.Slice(readings, func(i, j int) bool {
+		return readings[i].Timestamp.Before(readings[j].Timestamp)
+	})
+	unit, isEnergy := demandUnits[strings.ToLower(channel.Uom)]
+	window := anomalyWriter.window
+
+	var anomalies []anomaly
+	var step *anomaly
+	for i, reading := range readings {
+		if anomalyWriter.max > 0 && isEnergy && reading.IntervalLength > 0 {
+			if demand := reading.Value * unit / reading.IntervalLength.Hours(); demand > anomalyWriter.max {
+				anomalies = append(anomalies, anomaly{reading.Timestamp, anomalyMax, reading.Value, math.NaN(), demand / anomalyWriter.max})
+			}
+		}
+
+		if i >= window {
+			mean, deviation := anomalyStats(readings[i-window : i])
+			if score := anomalyScore(reading.Value-mean, mean, deviation); score >= anomalyWriter.spike {
+				anomalies = append(anomalies, anomaly{reading.Timestamp, anomalySpike, reading.Value, mean, score})
+			}
+		}
+
+		if i >= window && i+window <= len(readings) {
+			before, beforeDeviation := anomalyStats(readings[i-window : i])
+			after, afterDeviation := anomalyStats(readings[i : i+window])
+			deviation := math.Sqrt((beforeDeviation*beforeDeviation + afterDeviation*afterDeviation) / 2)
+			if score := anomalyScore(after-before, before, deviation); score >= anomalyWriter.step {
+				if step == nil || score > step.Score {
+					step = &anomaly{reading.Timestamp, anomalyStep, after, before, score}
+				}
+				continue
+			}
+		}
+		if step != nil {
+			anomalies = append(anomalies, *step)
+			step = nil
+		}
+	}
+	if step != nil {
+		anomalies = append(anomalies, *step)
+	}
+
+	for i := 0; i < len(readings); {
+		j := i + 1
+		for j < len(readings) && readings[j].Value == readings[i].Value && readings[j].Timestamp.Sub(readings[j-1].Timestamp) == readings[j].IntervalLength {
+			j++
+		}
+		run := readings[j-1].Timestamp.Sub(readings[i].Timestamp.Add(-readings[i].IntervalLength))
+		if readings[i].Value != 0 && run >= anomalyWriter.flatline {
+			anomalies = append(anomalies, anomaly{readings[i].Timestamp, anomalyFlatline, readings[i].Value, math.NaN(), run.Hours() / anomalyWriter.flatline.Hours()})
+		}
+		i = j
+	}
+
+	sort.SliceStable(anomalies, func(i, j int) bool {
+		return anomalies[i].Timestamp.Before(anomalies[j].Timestamp)
+	})
+
+	return anomalies
+}
+
+func (anomalyWriter *AnomalyWriter) Flush() error {
+	return nil
+}
+
+// Close writes one row per finding, by channel and timestamp. It does not close the underlying writer.
+func (anomalyWriter *AnomalyWriter) Close() error {
+	report := anomalyWriter.report
+	if err := report.Begin("nmi,nmi_suffix,uom,timestamp,anomaly,value,baseline,score"); err != nil {
+		return err
+	}
+
+	number := func(b []byte, v float64) []byte {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return report.AppendNull(b)
+		}
+		return strconv.AppendFloat(b, v, 'f', 3, 64)
+	}
+
+	line := make([]byte, 0, 256)
+	for _, channel := range sortedChannels(anomalyWriter.readings) {
+		for _, anomaly := range anomalyWriter.anomalies(channel, anomalyWriter.readings[channel]) {
+			line = report.Field(line[:0], "nmi")
+			line = report.AppendString(line, channel.Nmi)
+			line = report.Field(line, "nmi_suffix")
+			line = report.AppendString(line, channel.NmiSuffix)
+			line = report.Field(line, "uom")
+			line = report.AppendString(line, channel.Uom)
+			line = report.Field(line, "timestamp")
+			line = report.AppendTimestamp(line, anomaly.Timestamp)
+			line = report.Field(line, "anomaly")
+			line = report.AppendString(line, anomaly.Anomaly)
+			line = report.Field(line, "value")
+			line = number(line, anomaly.Value)
+			line = report.Field(line, "baseline")
+			line = number(line, anomaly.Baseline)
+			line = report.Field(line, "score")
+			line = number(line, anomaly.Score)
+			if err := report.Record(line); err != nil {
+				return err
+			}
+		}
+	}
+
+	return report.End()
+}
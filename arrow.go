@@ -0,0 +1,502 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"sort"
+	"strings"
+
+	"github.com/Cheejyg/Flo-Energy-Tech-Assessment/nem12"
+)
+
+func init() {
+	// The IPC stream format is used for targets ending in .arrows, otherwise the IPC file format.
+	RegisterSink("arrow", func(config *SinkConfig) (Sink, error) {
+		if config.Append {
+			return nil, ErrSinkNotResumable
+		}
+		return newFileSink(config, func(writer io.Writer) (Sink, error) {
+			if strings.HasSuffix(config.Target, ".arrows") || config.Target == "-" {
+				return NewArrowStreamWriter(writer)
+			}
+			return NewArrowFileWriter(writer)
+		})
+	})
+}
+
+// Apache Arrow columnar format constants, as defined in Schema.fbs and Message.fbs.
+const (
+	arrowMetadataVersionV5 int16 = 4
+
+	arrowMessageHeaderSchema      uint8 = 1
+	arrowMessageHeaderRecordBatch uint8 = 3
+
+	arrowTypeUtf8      uint8 = 5
+	arrowTypeDecimal   uint8 = 7
+	arrowTypeTimestamp uint8 = 10
+
+	arrowTimeUnitMillisecond int16 = 1
+)
+
+const arrowMagic string = "ARROW1"
+const arrowContinuation uint32 = 0xFFFFFFFF
+
+// Interval values are NUM(15), at most 15 digits, and are written as decimal128(arrowDecimalPrecision, arrowDecimalScale): any NUM(15) value with at most arrowDecimalScale decimal places fits.
+const arrowIntervalValueDigits int = 15
+const arrowDecimalScale int = 6
+const arrowDecimalPrecision int32 = int32(arrowIntervalValueDigits + arrowDecimalScale)
+
+var ErrArrowWriterClosed = errors.New("arrow writer closed")
+
+type arrowColumn struct {
+	Name     string
+	TypeType uint8
+	Type     func() *flatbufferTable
+}
+
+// meter_readings schema: nmi, suffix, timestamp, value, quality.
+var arrowColumns = []arrowColumn{
+	{Name: "nmi", TypeType: arrowTypeUtf8, Type: arrowTypeUtf8Table},
+	{Name: "suffix", TypeType: arrowTypeUtf8, Type: arrowTypeUtf8Table},
+	{Name: "timestamp", TypeType: arrowTypeTimestamp, Type: arrowTypeTimestampTable},
+	{Name: "value", TypeType: arrowTypeDecimal, Type: arrowTypeDecimalTable},
+	{Name: "quality", TypeType: arrowTypeUtf8, Type: arrowTypeUtf8Table},
+}
+
+func arrowTypeUtf8Table() *flatbufferTable {
+	return &flatbufferTable{}
+}
+func arrowTypeTimestampTable() *flatbufferTable {
+	// No timezone: NEM12 timestamps are local market time.
+	return (&flatbufferTable{}).Int16(0, arrowTimeUnitMillisecond)
+}
+func arrowTypeDecimalTable() *flatbufferTable {
+	return (&flatbufferTable{}).
+		Int32(0, arrowDecimalPrecision).
+		Int32(1, int32(arrowDecimalScale)).
+		Int32(2, 128)
+}
+
+// appendArrowDecimal appends an interval value as a little-endian decimal128 at arrowDecimalScale. Values of more than arrowIntervalValueDigits digits or more than arrowDecimalScale decimal places do not fit the column, and are rejected.
+func appendArrowDecimal(b []byte, intervalValue []byte) ([]byte, error) {
+	digits := intervalValue
+	negative := len(digits) > 0 && digits[0] == '-'
+	if len(digits) > 0 && (digits[0] == '-' || digits[0] == '+') {
+		digits = digits[1:]
+	}
+	integer, fraction, _ := bytes.Cut(digits, []byte{'.'})
+	fraction = bytes.TrimRight(fraction, "0")
+	if len(integer)+len(fraction) == 0 {
+		return b, nem12.ErrInvalidIntervalValue
+	}
+	if len(bytes.TrimLeft(integer, "0"))+len(fraction) > arrowIntervalValueDigits || len(fraction) > arrowDecimalScale {
+		return b, fmt.Errorf("%w: %s does not fit decimal128(%d,%d)", nem12.ErrInvalidIntervalValue, intervalValue, arrowDecimalPrecision, arrowDecimalScale)
+	}
+
+	var hi, lo uint64
+	digit := func(c byte) {
+		var carry uint64
+		hi *= 10
+		carry, lo = bits.Mul64(lo, 10)
+		hi += carry
+		lo, carry = bits.Add64(lo, uint64(c-'0'), 0)
+		hi += carry
+	}
+	for _, c := range append(integer[:len(integer):len(integer)], fraction...) {
+		if c < '0' || c > '9' {
+			return b, nem12.ErrInvalidIntervalValue
+		}
+		digit(c)
+	}
+	for range arrowDecimalScale - len(fraction) {
+		digit('0')
+	}
+	if negative {
+		var borrow uint64
+		lo, borrow = bits.Sub64(0, lo, 0)
+		hi, _ = bits.Sub64(0, hi, borrow)
+	}
+
+	b = binary.LittleEndian.AppendUint64(b, lo)
+	return binary.LittleEndian.AppendUint64(b, hi), nil
+}
+func arrowSchemaTable() *flatbufferTable {
+	fields := make([]*flatbufferTable, len(arrowColumns))
+	for i := range arrowColumns {
+		fields[i] = (&flatbufferTable{}).
+			String(0, arrowColumns[i].Name).
+			Bool(1, false).
+			Uint8(2, arrowColumns[i].TypeType).
+			Table(3, arrowColumns[i].Type()).
+			TableVector(5, nil)
+	}
+
+	return (&flatbufferTable{}).
+		Int16(0, 0). // Little endian.
+		TableVector(1, fields)
+}
+
+type arrowBlock struct {
+	Offset         int64
+	MetaDataLength int32
+	BodyLength     int64
+}
+
+// ArrowWriter writes meter readings in the Apache Arrow IPC stream or file format, one record batch per batch.
+type ArrowWriter struct {
+	writer *bufio.Writer
+	offset int64
+	file   bool
+	blocks []arrowBlock
+	closed bool
+}
+
+func NewArrowStreamWriter(writer io.Writer) (*ArrowWriter, error) {
+	arrowWriter := &ArrowWriter{
+		writer: bufio.NewWriterSize(writer, 1<<22),
+	}
+
+	if _, _, err := arrowWriter.writeMessage(arrowMessageHeaderSchema, arrowSchemaTable(), nil); err != nil {
+		return nil, err
+	}
+
+	return arrowWriter, nil
+}
+func NewArrowFileWriter(writer io.Writer) (*ArrowWriter, error) {
+	arrowWriter := &ArrowWriter{
+		writer: bufio.NewWriterSize(writer, 1<<22),
+		file:   true,
+	}
+
+	if err := arrowWriter.write([]byte(arrowMagic + "\x00\x00")); err != nil {
+		return nil, err
+	}
+	if _, _, err := arrowWriter.writeMessage(arrowMessageHeaderSchema, arrowSchemaTable(), nil); err != nil {
+		return nil, err
+	}
+
+	return arrowWriter, nil
+}
+
+func (arrowWriter *ArrowWriter) write(b []byte) error {
+	n, err := arrowWriter.writer.Write(b)
+	arrowWriter.offset += int64(n)
+	return err
+}
+
+// writeMessage writes an encapsulated message: continuation, metadata length, Message flatbuffer and body.
+func (arrowWriter *ArrowWriter) writeMessage(headerType uint8, header *flatbufferTable, body []byte) (metaDataLength int32, bodyLength int64, err error) {
+	message := (&flatbufferTable{}).
+		Int16(0, arrowMetadataVersionV5).
+		Uint8(1, headerType).
+		Table(2, header).
+		Int64(3, int64(len(body)))
+
+	metadata := message.Finish()
+	metadata = append(metadata, make([]byte, padding8(8+len(metadata)))...)
+
+	prefix := binary.LittleEndian.AppendUint32(nil, arrowContinuation)
+	prefix = binary.LittleEndian.AppendUint32(prefix, uint32(len(metadata)))
+	if err = arrowWriter.write(prefix); err != nil {
+		return
+	}
+	if err = arrowWriter.write(metadata); err != nil {
+		return
+	}
+	if err = arrowWriter.write(body); err != nil {
+		return
+	}
+
+	return int32(len(prefix) + len(metadata)), int64(len(body)), nil
+}
+
+// WriteBatch writes meterReadingsJob as a single record batch.
+func (arrowWriter *ArrowWriter) WriteBatch(meterReadingsJob []*MeterReadingsJob) error {
+	if arrowWriter.closed {
+		return ErrArrowWriterClosed
+	}
+	n := len(meterReadingsJob)
+	if n == 0 {
+		return nil
+	}
+
+	var body []byte
+	var nodes, buffers [][]byte
+	appendBuffer := func(buffer []byte) {
+		buffers = append(buffers, binary.LittleEndian.AppendUint64(binary.LittleEndian.AppendUint64(nil, uint64(len(body))), uint64(len(buffer))))
+		body = append(body, buffer...)
+		body = append(body, make([]byte, padding8(len(body)))...)
+	}
+	appendUtf8 := func(value func(i int) string) {
+		offsets := make([]byte, 0, 4*(n+1))
+		var data []byte
+		offsets = binary.LittleEndian.AppendUint32(offsets, 0)
+		for i := range n {
+			data = append(data, value(i)...)
+			offsets = binary.LittleEndian.AppendUint32(offsets, uint32(len(data)))
+		}
+		appendBuffer(nil) // No nulls, so no validity bitmap.
+		appendBuffer(offsets)
+		appendBuffer(data)
+	}
+
+	for c := range arrowColumns {
+		nodes = append(nodes, binary.LittleEndian.AppendUint64(binary.LittleEndian.AppendUint64(nil, uint64(n)), 0))
+
+		switch arrowColumns[c].Name {
+		case "nmi":
+			appendUtf8(func(i int) string { return meterReadingsJob[i].Nmi })
+		case "suffix":
+			appendUtf8(func(i int) string { return meterReadingsJob[i].NmiSuffix })
+		case "quality":
+			appendUtf8(func(i int) string { return meterReadingsJob[i].QualityMethod })
+		case "timestamp":
+			data := make([]byte, 0, 8*n)
+			for i := range meterReadingsJob {
+				data = binary.LittleEndian.AppendUint64(data, uint64(meterReadingsJob[i].Timestamp.UnixMilli()))
+			}
+			appendBuffer(nil)
+			appendBuffer(data)
+		case "value":
+			data := make([]byte, 0, 16*n)
+			for i := range meterReadingsJob {
+				var err error
+				if data, err = appendArrowDecimal(data, meterReadingsJob[i].Consumption); err != nil {
+					return err
+				}
+			}
+			appendBuffer(nil)
+			appendBuffer(data)
+		}
+	}
+
+	recordBatch := (&flatbufferTable{}).
+		Int64(0, int64(n)).
+		StructVector(1, 8, nodes).
+		StructVector(2, 8, buffers)
+
+	offset := arrowWriter.offset
+	metaDataLength, bodyLength, err := arrowWriter.writeMessage(arrowMessageHeaderRecordBatch, recordBatch, body)
+	if err != nil {
+		return err
+	}
+	arrowWriter.blocks = append(arrowWriter.blocks, arrowBlock{
+		Offset:         offset,
+		MetaDataLength: metaDataLength,
+		BodyLength:     bodyLength,
+	})
+
+	return arrowWriter.writer.Flush()
+}
+
+func (arrowWriter *ArrowWriter) Flush() error {
+	return arrowWriter.writer.Flush()
+}
+
+// Close writes the end-of-stream marker and, for the file format, the footer. It does not close the underlying writer.
+func (arrowWriter *ArrowWriter) Close() error {
+	if arrowWriter.closed {
+		return nil
+	}
+	arrowWriter.closed = true
+
+	endOfStream := binary.LittleEndian.AppendUint32(nil, arrowContinuation)
+	endOfStream = binary.LittleEndian.AppendUint32(endOfStream, 0)
+	if err := arrowWriter.write(endOfStream); err != nil {
+		return err
+	}
+
+	if arrowWriter.file {
+		blocks := make([][]byte, len(arrowWriter.blocks))
+		for i := range arrowWriter.blocks {
+			blocks[i] = binary.LittleEndian.AppendUint64(nil, uint64(arrowWriter.blocks[i].Offset))
+			blocks[i] = binary.LittleEndian.AppendUint32(blocks[i], uint32(arrowWriter.blocks[i].MetaDataLength))
+			blocks[i] = binary.LittleEndian.AppendUint32(blocks[i], 0)
+			blocks[i] = binary.LittleEndian.AppendUint64(blocks[i], uint64(arrowWriter.blocks[i].BodyLength))
+		}
+
+		footer := (&flatbufferTable{}).
+			Int16(0, arrowMetadataVersionV5).
+			Table(1, arrowSchemaTable()).
+			StructVector(2, 8, nil).
+			StructVector(3, 8, blocks).
+			Finish()
+
+		if err := arrowWriter.write(footer); err != nil {
+			return err
+		}
+		if err := arrowWriter.write(binary.LittleEndian.AppendUint32(nil, uint32(len(footer)))); err != nil {
+			return err
+		}
+		if err := arrowWriter.write([]byte(arrowMagic)); err != nil {
+			return err
+		}
+	}
+
+	return arrowWriter.writer.Flush()
+}
+
+func padding8(n int) int {
+	return (8 - n%8) % 8
+}
+
+// flatbufferTable is a minimal FlatBuffers table builder for Arrow IPC metadata.
+//
+// Unlike the reference builder, objects are laid out front to back: a table is followed by the objects it references, so every uoffset points forward.
+type flatbufferTable struct {
+	fields []flatbufferField
+}
+type flatbufferField struct {
+	size   int // Inline size in bytes, 0 if absent.
+	scalar uint64
+	child  func(buffer []byte) ([]byte, int)
+}
+
+func (table *flatbufferTable) set(id int, field flatbufferField) *flatbufferTable {
+	for len(table.fields) <= id {
+		table.fields = append(table.fields, flatbufferField{})
+	}
+	table.fields[id] = field
+	return table
+}
+func (table *flatbufferTable) Bool(id int, v bool) *flatbufferTable {
+	if v {
+		return table.set(id, flatbufferField{size: 1, scalar: 1})
+	}
+	return table.set(id, flatbufferField{size: 1, scalar: 0})
+}
+func (table *flatbufferTable) Uint8(id int, v uint8) *flatbufferTable {
+	return table.set(id, flatbufferField{size: 1, scalar: uint64(v)})
+}
+func (table *flatbufferTable) Int16(id int, v int16) *flatbufferTable {
+	return table.set(id, flatbufferField{size: 2, scalar: uint64(uint16(v))})
+}
+func (table *flatbufferTable) Int32(id int, v int32) *flatbufferTable {
+	return table.set(id, flatbufferField{size: 4, scalar: uint64(uint32(v))})
+}
+func (table *flatbufferTable) Int64(id int, v int64) *flatbufferTable {
+	return table.set(id, flatbufferField{size: 8, scalar: uint64(v)})
+}
+func (table *flatbufferTable) String(id int, v string) *flatbufferTable {
+	return table.set(id, flatbufferField{size: 4, child: func(buffer []byte) ([]byte, int) {
+		buffer = flatbufferAlign(buffer, 4, 0)
+		position := len(buffer)
+		buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(v)))
+		buffer = append(buffer, v...)
+		buffer = append(buffer, 0)
+		return buffer, position
+	}})
+}
+func (table *flatbufferTable) Table(id int, v *flatbufferTable) *flatbufferTable {
+	return table.set(id, flatbufferField{size: 4, child: v.write})
+}
+func (table *flatbufferTable) TableVector(id int, v []*flatbufferTable) *flatbufferTable {
+	return table.set(id, flatbufferField{size: 4, child: func(buffer []byte) ([]byte, int) {
+		buffer = flatbufferAlign(buffer, 4, 0)
+		position := len(buffer)
+		buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(v)))
+		buffer = append(buffer, make([]byte, 4*len(v))...)
+		for i := range v {
+			var child int
+			buffer, child = v[i].write(buffer)
+			element := position + 4 + 4*i
+			binary.LittleEndian.PutUint32(buffer[element:], uint32(child-element))
+		}
+		return buffer, position
+	}})
+}
+
+// StructVector adds a vector of fixed-size structs, each already encoded in little endian.
+func (table *flatbufferTable) StructVector(id int, alignment int, v [][]byte) *flatbufferTable {
+	return table.set(id, flatbufferField{size: 4, child: func(buffer []byte) ([]byte, int) {
+		buffer = flatbufferAlign(buffer, alignment, 4)
+		position := len(buffer)
+		buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(v)))
+		for i := range v {
+			buffer = append(buffer, v[i]...)
+		}
+		return buffer, position
+	}})
+}
+
+// Finish lays out table as the root of a new buffer.
+func (table *flatbufferTable) Finish() []byte {
+	buffer := make([]byte, 4, 512)
+	buffer, root := table.write(buffer)
+	binary.LittleEndian.PutUint32(buffer, uint32(root))
+	return append(buffer, make([]byte, padding8(len(buffer)))...)
+}
+
+func (table *flatbufferTable) write(buffer []byte) ([]byte, int) {
+	// Lay out inline fields largest first after the soffset to the vtable, keeping each naturally aligned.
+	order := make([]int, 0, len(table.fields))
+	alignment := 4
+	for id := range table.fields {
+		if table.fields[id].size > 0 {
+			order = append(order, id)
+			alignment = max(alignment, table.fields[id].size)
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return table.fields[order[i]].size > table.fields[order[j]].size
+	})
+
+	fieldOffsets := make([]int, len(table.fields))
+	size := 4
+	for _, id := range order {
+		size += (table.fields[id].size - size%table.fields[id].size) % table.fields[id].size
+		fieldOffsets[id] = size
+		size += table.fields[id].size
+	}
+
+	buffer = flatbufferAlign(buffer, 2, 0)
+	vtable := len(buffer)
+	buffer = binary.LittleEndian.AppendUint16(buffer, uint16(4+2*len(table.fields)))
+	buffer = binary.LittleEndian.AppendUint16(buffer, uint16(size))
+	for id := range table.fields {
+		buffer = binary.LittleEndian.AppendUint16(buffer, uint16(fieldOffsets[id]))
+	}
+
+	buffer = flatbufferAlign(buffer, alignment, 0)
+	position := len(buffer)
+	buffer = append(buffer, make([]byte, size)...)
+	binary.LittleEndian.PutUint32(buffer[position:], uint32(int32(position-vtable)))
+	for _, id := range order {
+		field := buffer[position+fieldOffsets[id]:]
+		switch table.fields[id].size {
+		case 1:
+			field[0] = byte(table.fields[id].scalar)
+		case 2:
+			binary.LittleEndian.PutUint16(field, uint16(table.fields[id].scalar))
+		case 4:
+			binary.LittleEndian.PutUint32(field, uint32(table.fields[id].scalar))
+		case 8:
+			binary.LittleEndian.PutUint64(field, table.fields[id].scalar)
+		}
+	}
+
+	for _, id := range order {
+		if table.fields[id].child == nil {
+			continue
+		}
+
+		var child int
+		buffer, child = table.fields[id].child(buffer)
+		field := position + fieldOffsets[id]
+		binary.LittleEndian.PutUint32(buffer[field:], uint32(child-field))
+	}
+
+	return buffer, position
+}
+
+// flatbufferAlign pads buffer so that len(buffer)+offset is a multiple of alignment.
+func flatbufferAlign(buffer []byte, alignment int, offset int) []byte {
+	return append(buffer, make([]byte, (alignment-(len(buffer)+offset)%alignment)%alignment)...)
+}
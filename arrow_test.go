@@ -0,0 +1,348 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/Cheejyg/Flo-Energy-Tech-Assessment/nem12"
+)
+
+// decodeArrowDecimal reads a little-endian two's complement decimal128.
+func decodeArrowDecimal(b []byte) *big.Int {
+	value := new(big.Int).SetUint64(binary.LittleEndian.Uint64(b[8:]))
+	value.Lsh(value, 64).Or(value, new(big.Int).SetUint64(binary.LittleEndian.Uint64(b)))
+	if b[15]&0x80 != 0 {
+		value.Sub(value, new(big.Int).Lsh(big.NewInt(1), 128))
+	}
+	return value
+}
+
+// scaledArrowDecimal returns intervalValue at arrowDecimalScale, as the unscaled integer the column holds.
+func scaledArrowDecimal(t *testing.T, intervalValue string) *big.Int {
+	t.Helper()
+	value, ok := new(big.Rat).SetString(intervalValue)
+	if !ok {
+		t.Fatalf("bad test value %q", intervalValue)
+	}
+	value.Mul(value, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(arrowDecimalScale)), nil)))
+	if !value.IsInt() {
+		t.Fatalf("test value %q has more than %d decimals", intervalValue, arrowDecimalScale)
+	}
+	return value.Num()
+}
+
+func TestAppendArrowDecimal(t *testing.T) {
+	tests := []struct {
+		name          string
+		intervalValue string
+		err           bool
+	}{
+		{"zero", "0", false},
+		{"fraction", "1.5", false},
+		{"leading dot", ".25", false},
+		{"trailing zeros", "1.5000000000", false},
+		{"plus", "+2", false},
+		{"negative", "-0.25", false},
+		{"six decimals", "0.000001", false},
+		{"fifteen digits", "999999999999999", false},
+		{"fifteen digits with decimals", "999999999.999999", false},
+		{"leading zeros", "000000000000000001", false},
+		{"sixteen digits", "1234567890123456", true},
+		{"seven decimals", "0.0000001", true},
+		{"empty", "", true},
+		{"sign only", "-", true},
+		{"letter", "1x", true},
+		{"two dots", "1.2.3", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, err := appendArrowDecimal([]byte("prefix"), []byte(test.intervalValue))
+			if test.err {
+				if !errors.Is(err, nem12.ErrInvalidIntervalValue) {
+					t.Errorf("got %v, want %v", err, nem12.ErrInvalidIntervalValue)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(b) != len("prefix")+16 || !bytes.HasPrefix(b, []byte("prefix")) {
+				t.Fatalf("got % x, want prefix and 16 bytes", b)
+			}
+			if got, want := decodeArrowDecimal(b[len("prefix"):]), scaledArrowDecimal(t, test.intervalValue); got.Cmp(want) != 0 {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// flatbufferReader reads the FlatBuffers tables written by flatbufferTable.
+type flatbufferReader []byte
+
+func (b flatbufferReader) uint32(position int) int {
+	return int(binary.LittleEndian.Uint32(b[position:]))
+}
+
+// root returns the position of the root table.
+func (b flatbufferReader) root() int {
+	return b.uint32(0)
+}
+
+// field returns the position of a table's field, or 0 if absent.
+func (b flatbufferReader) field(table int, id int) int {
+	vtable := table - int(int32(binary.LittleEndian.Uint32(b[table:])))
+	if 4+2*id >= int(binary.LittleEndian.Uint16(b[vtable:])) {
+		return 0
+	}
+	if offset := int(binary.LittleEndian.Uint16(b[vtable+4+2*id:])); offset > 0 {
+		return table + offset
+	}
+	return 0
+}
+
+// reference follows the uoffset of a table, string or vector field.
+func (b flatbufferReader) reference(table int, id int) int {
+	field := b.field(table, id)
+	return field + b.uint32(field)
+}
+
+// vector returns the position of the first element and the length of a vector field.
+func (b flatbufferReader) vector(table int, id int) (int, int) {
+	vector := b.reference(table, id)
+	return vector + 4, b.uint32(vector)
+}
+func (b flatbufferReader) string(table int, id int) string {
+	position := b.reference(table, id)
+	return string(b[position+4 : position+4+b.uint32(position)])
+}
+
+// readArrowMessage reads the encapsulated message at offset, returning its header type, header table, body and the offset after it.
+func readArrowMessage(t *testing.T, stream []byte, offset int) (uint8, flatbufferReader, int, []byte, int) {
+	t.Helper()
+	if binary.LittleEndian.Uint32(stream[offset:]) != arrowContinuation {
+		t.Fatalf("no continuation marker at %d", offset)
+	}
+	length := int(binary.LittleEndian.Uint32(stream[offset+4:]))
+	if (offset+8+length)%8 != 0 {
+		t.Errorf("message at %d: body not 8-byte aligned", offset)
+	}
+	metadata := flatbufferReader(stream[offset+8 : offset+8+length])
+	message := metadata.root()
+	if version := int16(binary.LittleEndian.Uint16(metadata[metadata.field(message, 0):])); version != arrowMetadataVersionV5 {
+		t.Errorf("message at %d: version %d, want %d", offset, version, arrowMetadataVersionV5)
+	}
+	headerType := metadata[metadata.field(message, 1)]
+	var bodyLength int
+	if field := metadata.field(message, 3); field > 0 {
+		bodyLength = int(binary.LittleEndian.Uint64(metadata[field:]))
+	}
+	body := stream[offset+8+length : offset+8+length+bodyLength]
+
+	return headerType, metadata, metadata.reference(message, 2), body, offset + 8 + length + bodyLength
+}
+
+// readArrowRecordBatch decodes a record batch into rows of strings, the value column as its unscaled decimal.
+func readArrowRecordBatch(t *testing.T, metadata flatbufferReader, recordBatch int, body []byte) [][]string {
+	t.Helper()
+	n := int(binary.LittleEndian.Uint64(metadata[metadata.field(recordBatch, 0):]))
+	nodes, nodeCount := metadata.vector(recordBatch, 1)
+	buffers, bufferCount := metadata.vector(recordBatch, 2)
+	if nodeCount != len(arrowColumns) {
+		t.Fatalf("%d field nodes, want %d", nodeCount, len(arrowColumns))
+	}
+
+	buffer := func() []byte {
+		if bufferCount == 0 {
+			t.Fatal("too few buffers")
+		}
+		offset := int(binary.LittleEndian.Uint64(metadata[buffers:]))
+		length := int(binary.LittleEndian.Uint64(metadata[buffers+8:]))
+		if offset%8 != 0 {
+			t.Errorf("buffer at %d not 8-byte aligned", offset)
+		}
+		buffers += 16
+		bufferCount--
+		return body[offset : offset+length]
+	}
+
+	rows := make([][]string, n)
+	for c := range arrowColumns {
+		if length := int(binary.LittleEndian.Uint64(metadata[nodes+16*c:])); length != n {
+			t.Errorf("%s: length %d, want %d", arrowColumns[c].Name, length, n)
+		}
+		if validity := buffer(); len(validity) != 0 {
+			t.Errorf("%s: unexpected validity bitmap", arrowColumns[c].Name)
+		}
+		switch arrowColumns[c].TypeType {
+		case arrowTypeUtf8:
+			offsets, data := buffer(), buffer()
+			for i := range n {
+				rows[i] = append(rows[i], string(data[binary.LittleEndian.Uint32(offsets[4*i:]):binary.LittleEndian.Uint32(offsets[4*i+4:])]))
+			}
+		case arrowTypeTimestamp:
+			data := buffer()
+			for i := range n {
+				rows[i] = append(rows[i], time.UnixMilli(int64(binary.LittleEndian.Uint64(data[8*i:]))).UTC().Format(jsonTimestampLayout))
+			}
+		case arrowTypeDecimal:
+			data := buffer()
+			for i := range n {
+				rows[i] = append(rows[i], decodeArrowDecimal(data[16*i:]).String())
+			}
+		}
+	}
+	if bufferCount != 0 {
+		t.Errorf("%d buffers left over", bufferCount)
+	}
+
+	return rows
+}
+
+func TestArrowWriter(t *testing.T) {
+	jobs := testMeterReadingsJobs()
+	tests := []struct {
+		name    string
+		file    bool
+		batches [][]*MeterReadingsJob
+	}{
+		{"empty stream", false, nil},
+		{"stream", false, [][]*MeterReadingsJob{jobs}},
+		{"stream of two batches", false, [][]*MeterReadingsJob{jobs[:2], jobs[2:]}},
+		{"empty file", true, nil},
+		{"file of two batches", true, [][]*MeterReadingsJob{jobs[:3], jobs[3:]}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			newArrowWriter := NewArrowStreamWriter
+			if test.file {
+				newArrowWriter = NewArrowFileWriter
+			}
+			arrowWriter, err := newArrowWriter(&buffer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want [][]string
+			for _, batch := range test.batches {
+				if err := arrowWriter.WriteBatch(batch); err != nil {
+					t.Fatal(err)
+				}
+				for _, job := range batch {
+					want = append(want, []string{job.Nmi, job.NmiSuffix, job.Timestamp.Format(jsonTimestampLayout), scaledArrowDecimal(t, string(job.Consumption)).String(), job.QualityMethod})
+				}
+			}
+			if err := arrowWriter.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err := arrowWriter.WriteBatch(jobs); !errors.Is(err, ErrArrowWriterClosed) {
+				t.Errorf("WriteBatch after Close: got %v, want %v", err, ErrArrowWriterClosed)
+			}
+
+			stream := buffer.Bytes()
+			offset := 0
+			if test.file {
+				if !bytes.HasPrefix(stream, []byte(arrowMagic+"\x00\x00")) || !bytes.HasSuffix(stream, []byte(arrowMagic)) {
+					t.Fatal("missing ARROW1 magic")
+				}
+				offset = 8
+			}
+
+			headerType, metadata, schema, _, offset := readArrowMessage(t, stream, offset)
+			if headerType != arrowMessageHeaderSchema {
+				t.Fatalf("first message is %d, want a schema", headerType)
+			}
+			fields, fieldCount := metadata.vector(schema, 1)
+			if fieldCount != len(arrowColumns) {
+				t.Fatalf("%d fields, want %d", fieldCount, len(arrowColumns))
+			}
+			for c := range arrowColumns {
+				field := fields + 4*c + metadata.uint32(fields+4*c)
+				if name := metadata.string(field, 0); name != arrowColumns[c].Name {
+					t.Errorf("field %d: name %q, want %q", c, name, arrowColumns[c].Name)
+				}
+				if typeType := metadata[metadata.field(field, 2)]; typeType != arrowColumns[c].TypeType {
+					t.Errorf("%s: type %d, want %d", arrowColumns[c].Name, typeType, arrowColumns[c].TypeType)
+				}
+			}
+
+			var got [][]string
+			var batchOffsets []int
+			for binary.LittleEndian.Uint32(stream[offset+4:]) != 0 {
+				batchOffsets = append(batchOffsets, offset)
+				var recordBatch int
+				var body []byte
+				headerType, metadata, recordBatch, body, offset = readArrowMessage(t, stream, offset)
+				if headerType != arrowMessageHeaderRecordBatch {
+					t.Fatalf("message at %d is %d, want a record batch", batchOffsets[len(batchOffsets)-1], headerType)
+				}
+				got = append(got, readArrowRecordBatch(t, metadata, recordBatch, body)...)
+			}
+			offset += 8
+			if len(batchOffsets) != len(test.batches) {
+				t.Errorf("%d record batches, want %d", len(batchOffsets), len(test.batches))
+			}
+
+			if len(got) != len(want) {
+				t.Fatalf("%d rows, want %d", len(got), len(want))
+			}
+			for i := range want {
+				for c := range arrowColumns {
+					if got[i][c] != want[i][c] {
+						t.Errorf("row %d %s: got %q, want %q", i, arrowColumns[c].Name, got[i][c], want[i][c])
+					}
+				}
+			}
+
+			if !test.file {
+				if offset != len(stream) {
+					t.Errorf("%d bytes after the end-of-stream marker", len(stream)-offset)
+				}
+				return
+			}
+			footerLength := int(binary.LittleEndian.Uint32(stream[len(stream)-len(arrowMagic)-4:]))
+			if offset+footerLength+4+len(arrowMagic) != len(stream) {
+				t.Fatalf("footer of %d bytes does not follow the end-of-stream marker", footerLength)
+			}
+			footer := flatbufferReader(stream[offset : offset+footerLength])
+			blocks, blockCount := footer.vector(footer.root(), 3)
+			if blockCount != len(batchOffsets) {
+				t.Fatalf("%d blocks, want %d", blockCount, len(batchOffsets))
+			}
+			for i := range blockCount {
+				if blockOffset := int(binary.LittleEndian.Uint64(footer[blocks+24*i:])); blockOffset != batchOffsets[i] {
+					t.Errorf("block %d: offset %d, want %d", i, blockOffset, batchOffsets[i])
+				}
+			}
+		})
+	}
+}
+
+func TestArrowWriterInvalidValue(t *testing.T) {
+	jobs := testMeterReadingsJobs()
+	jobs[1].Consumption = []byte("1234567890123456")
+
+	var buffer bytes.Buffer
+	arrowWriter, err := NewArrowStreamWriter(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := arrowWriter.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	length := buffer.Len()
+	if err := arrowWriter.WriteBatch(jobs); !errors.Is(err, nem12.ErrInvalidIntervalValue) {
+		t.Errorf("got %v, want %v", err, nem12.ErrInvalidIntervalValue)
+	}
+	if err := arrowWriter.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if buffer.Len() != length {
+		t.Errorf("a failed batch wrote %d bytes", buffer.Len()-length)
+	}
+}
@@ -0,0 +1,15 @@
+-- B2B details (500 records), loaded from the insert and copy sinks with table=b2b_details.
+
+CREATE TABLE IF NOT EXISTS b2b_details (
+    nmi VARCHAR(10) NOT NULL,
+    nmi_suffix VARCHAR(2) NOT NULL,
+    uom VARCHAR(5) NOT NULL,
+    interval_date DATE NOT NULL, -- Of the 300 record the 500 record follows.
+    trans_code CHAR(1) NOT NULL,
+    ret_service_order VARCHAR(15),
+    read_datetime TIMESTAMP,
+    index_read NUMERIC
+);
+
+CREATE INDEX IF NOT EXISTS b2b_details_channel
+    ON b2b_details (nmi, nmi_suffix, interval_date);
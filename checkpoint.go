@@ -0,0 +1,169 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+var ErrCheckpointMismatch = errors.New("checkpoint does not match input")
+
+// Checkpoint records how far a load got, so that it can be resumed from the last 200 record instead of from the start of the file.
+type Checkpoint struct {
+	File     string `json:"file"`
+	FileSize int64  `json:"file_size"`
+
+	ByteOffset     int64  `json:"byte_offset"` // Start of the current 200 record.
+	LineNumber     int    `json:"line_number"` // Line of the current 200 record.
+	Nmi            string `json:"nmi"`
+	NmiSuffix      string `json:"nmi_suffix"`
+	Uom            string `json:"uom"`
+	IntervalLength int    `json:"interval_length"`
+
+	RowsWritten  int64 `json:"rows_written"`
+	RowsSince200 int64 `json:"rows_since_200"` // Rows of the current 200 record already written, skipped on resume.
+
+	Sinks   []string         `json:"sinks"`   // Without secret options.
+	Outputs map[string]int64 `json:"outputs"` // Size of each sink's output file, by sink spec as in Sinks.
+}
+
+// checkpointSecretOptions are the sink options left out of checkpoints, so that credentials are never written to disk. On resume they come from -sink again or the environment, e.g. INFLUX_TOKEN.
+var checkpointSecretOptions = []string{"token"}
+
+// checkpointSinkSpec returns spec without its secret options, or spec itself if it has none.
+func checkpointSinkSpec(spec string) string {
+	name, target, options, err := ParseSinkSpec(spec)
+	if err != nil {
+		return spec
+	}
+	secret := false
+	for _, option := range checkpointSecretOptions {
+		if options.Has(option) {
+			options.Del(option)
+			secret = true
+		}
+	}
+	if !secret {
+		return spec
+	}
+
+	spec = name + ":" + target
+	if len(options) > 0 {
+		spec += "?" + options.Encode()
+	}
+	return spec
+}
+
+// NewCheckpoint captures state after its pipeline has been flushed. Secret sink options are left out of Sinks and Outputs.
+func NewCheckpoint(state *ProcessLineState, fileSize int64, sinkSpecs []string) *Checkpoint {
+	checkpoint := &Checkpoint{
+		File:     state.Source.Name,
+		FileSize: fileSize,
+
+		ByteOffset:     state.NmiDataDetailsOffset,
+		LineNumber:     state.NmiDataDetailsLineNumber,
+		Nmi:            state.Nmi,
+		NmiSuffix:      state.NmiSuffix,
+		Uom:            state.Uom,
+		IntervalLength: state.IntervalLength,
+
+		RowsWritten:  state.Pipeline.Rows,
+		RowsSince200: state.NmiDataDetailsRows,
+
+		Sinks:   make([]string, len(sinkSpecs)),
+		Outputs: make(map[string]int64, len(sinkSpecs)),
+	}
+
+	for i, spec := range sinkSpecs {
+		checkpoint.Sinks[i] = checkpointSinkSpec(spec)
+		_, target, _, err := ParseSinkSpec(spec)
+		if err != nil {
+			continue
+		}
+		// Only regular files can be truncated back on resume; standard output and URLs are skipped.
+		if fileInfo, err := os.Stat(target); err == nil && fileInfo.Mode().IsRegular() {
+			checkpoint.Outputs[checkpoint.Sinks[i]] = fileInfo.Size()
+		}
+	}
+
+	return checkpoint
+}
+
+// WriteCheckpoint writes checkpoint to name, replacing any previous checkpoint atomically.
+func WriteCheckpoint(name string, checkpoint *Checkpoint) error {
+	b, err := json.MarshalIndent(checkpoint, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(append(b, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), name)
+}
+
+func ReadCheckpoint(name string) (*Checkpoint, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(b, &checkpoint); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return &checkpoint, nil
+}
+
+// resumeNem12 processes the header of file, then continues from the 200 record in checkpoint, skipping the rows already written.
+func resumeNem12(file *os.File, state *ProcessLineState, checkpoint *Checkpoint) error {
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if fileInfo.Size() != checkpoint.FileSize || checkpoint.ByteOffset < 0 || checkpoint.ByteOffset > fileInfo.Size() {
+		return fmt.Errorf("%w: %s", ErrCheckpointMismatch, checkpoint.File)
+	}
+
+	if checkpoint.ByteOffset > 0 {
+		header, err := bufio.NewReader(io.LimitReader(file, checkpoint.ByteOffset)).ReadSlice('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if err := processLine(header, state); err != nil {
+			return err
+		}
+	}
+
+	if _, err := file.Seek(checkpoint.ByteOffset, io.SeekStart); err != nil {
+		return err
+	}
+	state.Offset = checkpoint.ByteOffset
+	state.LineNumber = max(checkpoint.LineNumber-1, 0)
+	state.SkipRows = checkpoint.RowsSince200
+	state.Pipeline.Rows = checkpoint.RowsWritten
+
+	return processNem12(file, state)
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckpointSinkSpec(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"copy:meter_readings.sql.csv", "copy:meter_readings.sql.csv"},
+		{"copy:a.csv?suffix=E1&nmi=NEM1201009", "copy:a.csv?suffix=E1&nmi=NEM1201009"},
+		{"influx-http:http://localhost:8086?token=secret", "influx-http:http://localhost:8086"},
+		{"influx-http:http://localhost:8086?token=secret&org=flo&bucket=readings", "influx-http:http://localhost:8086?bucket=readings&org=flo"},
+	}
+	for _, test := range tests {
+		if got := checkpointSinkSpec(test.spec); got != test.want {
+			t.Errorf("checkpointSinkSpec(%q) = %q, want %q", test.spec, got, test.want)
+		}
+	}
+}
+
+var errTestInterrupted = errors.New("interrupted")
+
+// TestResumeNem12 interrupts a load after its first batch, with rows written after the checkpoint, and resumes it. The output must be that of an uninterrupted load.
+func TestResumeNem12(t *testing.T) {
+	dir := t.TempDir()
+	config := testGeneratorConfig()
+	config.Days = 120
+	config.B2b = 0.5
+	name := filepath.Join(dir, "test.csv")
+	nem12File := generateTestNem12(t, config)
+	if err := os.WriteFile(name, nem12File, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	checkpointName := name + ".checkpoint"
+
+	load := func(sinkSpecs []string, checkpoint *Checkpoint, interrupt bool) error {
+		file, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		var outputs map[string]int64
+		if checkpoint != nil {
+			outputs = checkpoint.Outputs
+		}
+		sink, err := OpenSinks(sinkSpecs, outputs)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pipeline := NewPipeline(sink, sqlInsertBatchSize)
+		state := ProcessLineState{Source: &SourceFile{Name: name}, Pipeline: pipeline}
+		pipeline.AfterFlush = func() error {
+			if err := WriteCheckpoint(checkpointName, NewCheckpoint(&state, int64(len(nem12File)), sinkSpecs)); err != nil {
+				return err
+			}
+			if interrupt {
+				return errTestInterrupted
+			}
+			return nil
+		}
+
+		if checkpoint != nil {
+			err = resumeNem12(file, &state, checkpoint)
+		} else {
+			err = processNem12(file, &state)
+		}
+		if interrupt {
+			return errors.Join(err, sink.Close())
+		}
+		return errors.Join(err, pipeline.Close())
+	}
+	outputs := func(prefix string) []string {
+		return []string{
+			"copy:" + filepath.Join(dir, prefix+".csv"),
+			"insert:" + filepath.Join(dir, prefix+".sql"),
+			"copy:" + filepath.Join(dir, prefix+".b2b.csv") + "?table=b2b_details",
+			"jsonl:" + filepath.Join(dir, prefix+".jsonl"),
+		}
+	}
+
+	if err := load(outputs("want"), nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	sinkSpecs := outputs("got")
+	if err := load(sinkSpecs, nil, true); !errors.Is(err, errTestInterrupted) {
+		t.Fatalf("got %v, want the load interrupted", err)
+	}
+	// Rows written after the checkpoint was taken, which the resumed load must drop.
+	for _, spec := range sinkSpecs {
+		_, target, _, _ := ParseSinkSpec(spec)
+		file, err := os.OpenFile(target, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.WriteString("partial row\n")
+		file.Close()
+	}
+
+	checkpoint, err := ReadCheckpoint(checkpointName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkpoint.RowsWritten != int64(sqlInsertBatchSize) || checkpoint.ByteOffset == 0 || len(checkpoint.Outputs) != len(sinkSpecs) {
+		t.Fatalf("got checkpoint %+v", checkpoint)
+	}
+	if err := load(checkpoint.Sinks, checkpoint, false); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, spec := range outputs("want") {
+		_, wantName, _, _ := ParseSinkSpec(spec)
+		_, gotName, _, _ := ParseSinkSpec(sinkSpecs[i])
+		want, err := os.ReadFile(wantName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(gotName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: resumed output of %d bytes differs from the %d bytes of an uninterrupted load", filepath.Base(gotName), len(got), len(want))
+		}
+	}
+}
+
+func TestNewCheckpointSecrets(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "test.checkpoint")
+	state := ProcessLineState{Source: &SourceFile{Name: "test.csv"}, Pipeline: NewPipeline(&testSink{}, 1)}
+	sinkSpecs := []string{"influx-http:http://localhost:8086?token=secret&bucket=readings", "copy:" + filepath.Join(dir, "missing.csv")}
+	if err := WriteCheckpoint(name, NewCheckpoint(&state, 0, sinkSpecs)); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "secret") {
+		t.Errorf("the token was written to the checkpoint:\n%s", b)
+	}
+	checkpoint, err := ReadCheckpoint(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checkpoint.Sinks) != 2 || checkpoint.Sinks[0] != "influx-http:http://localhost:8086?bucket=readings" || checkpoint.Sinks[1] != sinkSpecs[1] {
+		t.Errorf("got sinks %v", checkpoint.Sinks)
+	}
+	if len(checkpoint.Outputs) != 0 {
+		t.Errorf("got outputs %v for a URL and a missing file", checkpoint.Outputs)
+	}
+}
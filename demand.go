@@ -0,0 +1,286 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Cheejyg/Flo-Energy-Tech-Assessment/nem12"
+)
+
+func init() {
+	RegisterSink("demand", func(config *SinkConfig) (Sink, error) {
+		if config.Append {
+			return nil, ErrSinkNotResumable
+		}
+
+		var tariff *Tariff
+		if config.Options.Has("tariff") {
+			var err error
+			if tariff, err = LoadTariff(config.Options.Get("tariff")); err != nil {
+				return nil, err
+			}
+		}
+		var interval time.Duration
+		if config.Options.Has("interval") {
+			var err error
+			interval, err = time.ParseDuration(config.Options.Get("interval"))
+			if err != nil || interval < time.Minute || (24*time.Hour)%interval != 0 {
+				return nil, fmt.Errorf("%w: interval %q, want a duration dividing a day", ErrInvalidSinkOption, config.Options.Get("interval"))
+			}
+		}
+		rolling, err := strconv.Atoi(sinkOption(config.Options, "rolling", "12"))
+		if err != nil || rolling < 1 {
+			return nil, fmt.Errorf("%w: rolling %q, want a number of months", ErrInvalidSinkOption, config.Options.Get("rolling"))
+		}
+		format := reportFormat(config)
+		period := config.Options.Get("period")
+		if period != "" && tariff == nil {
+			return nil, fmt.Errorf("%w: period needs a tariff", ErrInvalidSinkOption)
+		}
+
+		return newFileSink(config, func(writer io.Writer) (Sink, error) {
+			return NewDemandWriter(writer, interval, rolling, tariff, period, format)
+		})
+	})
+}
+
+// demandUnits converts energy units to kWh, and reactive energy units to kVArh.
+var demandUnits = map[string]float64{
+	"wh":    1e-3,
+	"kwh":   1,
+	"mwh":   1e3,
+	"varh":  1e-3,
+	"kvarh": 1,
+	"mvarh": 1e3,
+}
+
+type demandReading struct {
+	NmiSuffix string
+	Start     int64 // Unix seconds of market time.
+}
+type demandValue struct {
+	Energy         float64 // kWh or kVArh.
+	IntervalLength time.Duration
+}
+
+type demandMonth struct {
+	Month       time.Time
+	MaxKw       float64
+	MaxKwStart  time.Time
+	MaxKva      float64
+	MaxKvaStart time.Time
+	PowerFactor float64 // At MaxKva.
+	RollingKw   float64
+	RollingKva  float64
+}
+
+// DemandWriter converts interval energy to average demand, and writes each NMI's monthly and rolling maximum demand as CSV or JSON on Close.
+//
+// Demand is the energy of the import channels (NMI suffix E) over an interval divided by its length, in kW. Where the NMI also has reactive import channels (Q), kVA is combined from kW and kVAr per interval, with the power factor at the maximum. Intervals can be summed into a longer demand interval, e.g. 30m for 5-minute data, and restricted to a tariff period, e.g. peak. The rolling maximum is over the last rolling calendar months, the current month included.
+type DemandWriter struct {
+	report   *reportWriter
+	interval time.Duration
+	rolling  int
+	tariff   *Tariff
+	period   string
+
+	readings map[string]map[demandReading]demandValue
+}
+
+func NewDemandWriter(writer io.Writer, interval time.Duration, rolling int, tariff *Tariff, period string, format string) (*DemandWriter, error) {
+	report, err := newReportWriter(writer, format)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DemandWriter{
+		report:   report,
+		interval: interval,
+		rolling:  rolling,
+		tariff:   tariff,
+		period:   period,
+		readings: make(map[string]map[demandReading]demandValue, 16),
+	}, nil
+}
+
+func (demandWriter *DemandWriter) WriteBatch(meterReadingsJob []*MeterReadingsJob) error {
+	for _, job := range meterReadingsJob {
+		if job.NmiSuffix == "" || (job.NmiSuffix[0] != 'E' && job.NmiSuffix[0] != 'Q') || job.IntervalLength <= 0 {
+			continue
+		}
+		unit, ok := demandUnits[strings.ToLower(job.Uom)]
+		if !ok {
+			continue
+		}
+		// Energy is summed into demand intervals, never split, so they must be whole multiples of the reading.
+		if demandWriter.interval > 0 && demandWriter.interval%job.IntervalLength != 0 {
+			return fmt.Errorf("%w: interval %s is not a multiple of the %s readings of %s %s", ErrInvalidSinkOption, demandWriter.interval, job.IntervalLength, job.Nmi, job.NmiSuffix)
+		}
+		value, err := nem12.ParseIntervalValue(job.Consumption)
+		if err != nil {
+			return err
+		}
+
+		readings := demandWriter.readings[job.Nmi]
+		if readings == nil {
+			readings = make(map[demandReading]demandValue, 1024)
+			demandWriter.readings[job.Nmi] = readings
+		}
+		// A reading sent again replaces the earlier one.
+		readings[demandReading{job.NmiSuffix, job.Timestamp.Add(-job.IntervalLength).Unix()}] = demandValue{value * unit, job.IntervalLength}
+	}
+
+	return nil
+}
+
+// months computes the monthly and rolling maximum demand of one NMI.
+func (demandWriter *DemandWriter) months(readings map[demandReading]demandValue) []*demandMonth {
+	type demandBucket struct {
+		Length      time.Duration
+		Active      float64 // kWh.
+		Reactive    float64 // kVArh.
+		HasReactive bool
+	}
+	buckets := make(map[time.Time]*demandBucket, len(readings))
+	for reading, value := range readings {
+		start := time.Unix(reading.Start, 0).UTC()
+		length := value.IntervalLength
+		if demandWriter.interval > 0 {
+			start = start.Truncate(demandWriter.interval)
+			length = demandWriter.interval
+		}
+		if demandWriter.period != "" {
+			if _, period := demandWriter.tariff.Classify(start); period != demandWriter.period {
+				continue
+			}
+		}
+
+		bucket := buckets[start]
+		if bucket == nil {
+			bucket = &demandBucket{Length: length}
+			buckets[start] = bucket
+		}
+		if reading.NmiSuffix[0] == 'E' {
+			bucket.Active += value.Energy
+		} else {
+			bucket.Reactive += value.Energy
+			bucket.HasReactive = true
+		}
+	}
+
+	starts := make([]time.Time, 0, len(buckets))
+	for start := range buckets {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool {
+		return starts[i].Before(starts[j])
+	})
+
+	var months []*demandMonth
+	for _, start := range starts {
+		bucket := buckets[start]
+		month := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC)
+		if len(months) == 0 || !months[len(months)-1].Month.Equal(month) {
+			months = append(months, &demandMonth{Month: month, MaxKw: math.Inf(-1), MaxKva: math.NaN(), PowerFactor: math.NaN()})
+		}
+		demandMonth := months[len(months)-1]
+
+		hours := bucket.Length.Hours()
+		kw := bucket.Active / hours
+		if kw > demandMonth.MaxKw {
+			demandMonth.MaxKw, demandMonth.MaxKwStart = kw, start
+		}
+		if bucket.HasReactive {
+			kva := math.Hypot(kw, bucket.Reactive/hours)
+			if math.IsNaN(demandMonth.MaxKva) || kva > demandMonth.MaxKva {
+				demandMonth.MaxKva, demandMonth.MaxKvaStart = kva, start
+				demandMonth.PowerFactor = math.NaN()
+				if kva > 0 {
+					demandMonth.PowerFactor = kw / kva
+				}
+			}
+		}
+	}
+
+	for i, demandMonth := range months {
+		demandMonth.RollingKw, demandMonth.RollingKva = math.Inf(-1), math.NaN()
+		first := demandMonth.Month.AddDate(0, -demandWriter.rolling+1, 0)
+		for j := i; j >= 0 && !months[j].Month.Before(first); j-- {
+			demandMonth.RollingKw = math.Max(demandMonth.RollingKw, months[j].MaxKw)
+			if !math.IsNaN(months[j].MaxKva) && (math.IsNaN(demandMonth.RollingKva) || months[j].MaxKva > demandMonth.RollingKva) {
+				demandMonth.RollingKva = months[j].MaxKva
+			}
+		}
+	}
+
+	return months
+}
+
+func (demandWriter *DemandWriter) Flush() error {
+	return nil
+}
+
+// Close writes one row per NMI and month. kVA columns are empty, or null, for NMIs without reactive channels. It does not close the underlying writer.
+func (demandWriter *DemandWriter) Close() error {
+	nmis := make([]string, 0, len(demandWriter.readings))
+	for nmi := range demandWriter.readings {
+		nmis = append(nmis, nmi)
+	}
+	sort.Strings(nmis)
+
+	report := demandWriter.report
+	if err := report.Begin("nmi,month,period,max_kw,max_kw_start,max_kva,max_kva_start,power_factor,rolling_max_kw,rolling_max_kva"); err != nil {
+		return err
+	}
+
+	number := func(b []byte, v float64) []byte {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return report.AppendNull(b)
+		}
+		return strconv.AppendFloat(b, v, 'f', 3, 64)
+	}
+	timestamp := func(b []byte, t time.Time, ok bool) []byte {
+		if !ok {
+			return report.AppendNull(b)
+		}
+		return report.AppendTimestamp(b, t)
+	}
+
+	line := make([]byte, 0, 256)
+	for _, nmi := range nmis {
+		for _, demandMonth := range demandWriter.months(demandWriter.readings[nmi]) {
+			line = report.Field(line[:0], "nmi")
+			line = report.AppendString(line, nmi)
+			line = report.Field(line, "month")
+			line = report.AppendString(line, demandMonth.Month.Format("2006-01"))
+			line = report.Field(line, "period")
+			line = report.AppendString(line, demandWriter.period)
+			line = report.Field(line, "max_kw")
+			line = number(line, demandMonth.MaxKw)
+			line = report.Field(line, "max_kw_start")
+			line = timestamp(line, demandMonth.MaxKwStart, true)
+			line = report.Field(line, "max_kva")
+			line = number(line, demandMonth.MaxKva)
+			line = report.Field(line, "max_kva_start")
+			line = timestamp(line, demandMonth.MaxKvaStart, !math.IsNaN(demandMonth.MaxKva))
+			line = report.Field(line, "power_factor")
+			line = number(line, demandMonth.PowerFactor)
+			line = report.Field(line, "rolling_max_kw")
+			line = number(line, demandMonth.RollingKw)
+			line = report.Field(line, "rolling_max_kva")
+			line = number(line, demandMonth.RollingKva)
+			if err := report.Record(line); err != nil {
+				return err
+			}
+		}
+	}
+
+	return report.End()
+}
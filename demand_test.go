@@ -0,0 +1,83 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDemandWriter(t *testing.T) {
+	values := strings.Split(strings.Repeat("1,", 48), ",")[:48]
+	values[30] = "2" // 15:00 to 15:30.
+	sink := loadTestNem12(t, []byte(testNem12(
+		testHeaderLine,
+		testBlockLine("NEM1201009", "E1"),
+		"300,20050301,"+strings.Join(values, ",")+",A,,,,",
+		testDayLine("20050401", "1", ""),
+		strings.Replace(testBlockLine("NEM1201009", "Q1"), ",kWh,", ",kVArh,", 1),
+		testDayLine("20050301", "0.5", ""),
+		"900",
+	)))
+	tariff, err := LoadTariff("tariff.example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		interval time.Duration
+		rolling  int
+		period   string
+		want     []string
+	}{
+		{"monthly", 0, 12, "", []string{
+			"NEM1201009,2005-03,,4.000,2005-03-01T15:00:00+10:00,4.123,2005-03-01T15:00:00+10:00,0.970,4.000,4.123",
+			"NEM1201009,2005-04,,2.000,2005-04-01T00:00:00+10:00,,,,4.000,4.123",
+		}},
+		{"rolling one month", 0, 1, "", []string{
+			"NEM1201009,2005-03,,4.000,2005-03-01T15:00:00+10:00,4.123,2005-03-01T15:00:00+10:00,0.970,4.000,4.123",
+			"NEM1201009,2005-04,,2.000,2005-04-01T00:00:00+10:00,,,,2.000,",
+		}},
+		{"hourly", time.Hour, 12, "", []string{
+			"NEM1201009,2005-03,,3.000,2005-03-01T15:00:00+10:00,3.162,2005-03-01T15:00:00+10:00,0.949,3.000,3.162",
+			"NEM1201009,2005-04,,2.000,2005-04-01T00:00:00+10:00,,,,3.000,3.162",
+		}},
+		{"peak", 0, 12, "peak", []string{
+			"NEM1201009,2005-03,peak,4.000,2005-03-01T15:00:00+10:00,4.123,2005-03-01T15:00:00+10:00,0.970,4.000,4.123",
+			"NEM1201009,2005-04,peak,2.000,2005-04-01T14:00:00+10:00,,,,4.000,4.123",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var b bytes.Buffer
+			demandWriter, err := NewDemandWriter(&b, test.interval, test.rolling, tariff, test.period, "csv")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := demandWriter.WriteBatch(sink.jobs); err != nil {
+				t.Fatal(err)
+			}
+			if err := demandWriter.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+			if got, want := strings.Join(lines[1:], "\n"), strings.Join(test.want, "\n"); got != want {
+				t.Errorf("got\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+
+	// Demand intervals that would split a reading are rejected.
+	demandWriter, err := NewDemandWriter(&bytes.Buffer{}, 45*time.Minute, 12, nil, "", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := demandWriter.WriteBatch(sink.jobs); !errors.Is(err, ErrInvalidSinkOption) {
+		t.Errorf("got %v, want %v", err, ErrInvalidSinkOption)
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Cheejyg/Flo-Energy-Tech-Assessment/nem12"
+)
+
+const (
+	diffAdded          = "added"
+	diffRemoved        = "removed"
+	diffIntervalLength = "interval_length"
+	diffUpdateDateTime = "update_datetime"
+	diffValue          = "value"
+	diffQualityMethod  = "quality_method"
+	diffReasonCode     = "reason_code"
+)
+
+// diffKey is one channel's interval date.
+type diffKey struct {
+	StoreSeries
+	IntervalDate time.Time
+}
+
+type diffInterval struct {
+	Value         string
+	QualityMethod string
+	ReasonCode    string
+}
+
+// diffDay is one channel's interval date, from the last 300 record read for it.
+type diffDay struct {
+	IntervalLength time.Duration
+	UpdateDateTime string
+	Intervals      []diffInterval
+	Source         *SourceFile
+	LineNumber     int
+}
+
+// diffSink collects the days of a NEM12 file.
+type diffSink struct {
+	days map[diffKey]*diffDay
+}
+
+func (diffSink *diffSink) WriteBatch(meterReadingsJob []*MeterReadingsJob) error {
+	for _, job := range meterReadingsJob {
+		key := diffKey{StoreSeries{job.Nmi, job.NmiSuffix, job.Uom}, job.IntervalData.IntervalDate}
+		day := diffSink.days[key]
+		// A day sent again in a later 300 record replaces the earlier one.
+		if day == nil || day.Source != job.Source || day.LineNumber != job.LineNumber {
+			day = &diffDay{IntervalLength: job.IntervalLength, Source: job.Source, LineNumber: job.LineNumber}
+			if job.IntervalData.UpdateDateTime != nil {
+				day.UpdateDateTime = job.IntervalData.UpdateDateTime.Format(jsonTimestampLayout) + jsonMarketTimeOffset
+			}
+			diffSink.days[key] = day
+		}
+
+		var reasonCode *[3]byte
+		if job.IntervalEvent != nil {
+			reasonCode = job.IntervalEvent.ReasonCode
+		} else {
+			reasonCode = job.IntervalData.ReasonCode
+		}
+		interval := diffInterval{Value: string(job.Consumption), QualityMethod: job.QualityMethod}
+		if reasonCode != nil {
+			interval.ReasonCode = nem12.ParseByteString(reasonCode[:])
+		}
+		day.Intervals = append(day.Intervals, interval)
+	}
+
+	return nil
+}
+func (diffSink *diffSink) Flush() error {
+	return nil
+}
+func (diffSink *diffSink) Close() error {
+	return nil
+}
+
+// readDiffDays reads the days of the NEM12 file name.
+func readDiffDays(name string) (map[diffKey]*diffDay, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	sink := &diffSink{days: make(map[diffKey]*diffDay, 1024)}
+	pipeline := NewPipeline(sink, sqlInsertBatchSize)
+	state := ProcessLineState{
+		Source:   &SourceFile{Name: name},
+		Pipeline: pipeline,
+	}
+	if err := errors.Join(processNem12(file, &state), pipeline.Close()); err != nil {
+		return nil, fmt.Errorf("%s: line %d: %w", name, state.LineNumber, err)
+	}
+
+	return sink.days, nil
+}
+
+// DiffChange is one difference between two NEM12 files. Interval is the 1-based interval number, or 0 for changes to the whole day.
+type DiffChange struct {
+	Nmi          string `json:"nmi"`
+	NmiSuffix    string `json:"nmi_suffix"`
+	Uom          string `json:"uom"`
+	IntervalDate string `json:"interval_date"`
+	Interval     int    `json:"interval,omitempty"`
+	Change       string `json:"change"`
+	Old          string `json:"old"`
+	New          string `json:"new"`
+}
+
+// diffValues reports whether two interval values differ as numbers, e.g. 0.5 and 0.500 do not.
+func diffValues(old string, new string) bool {
+	oldValue, oldErr := nem12.ParseIntervalValueDecimal([]byte(old), aggregateScale)
+	newValue, newErr := nem12.ParseIntervalValueDecimal([]byte(new), aggregateScale)
+	if oldErr != nil || newErr != nil {
+		return old != new
+	}
+	return oldValue != newValue
+}
+
+// DiffNem12 compares the days of two NEM12 files, and returns the changes from old to new by channel, date and interval.
+func DiffNem12(old map[diffKey]*diffDay, new map[diffKey]*diffDay) []DiffChange {
+	keys := make([]diffKey, 0, len(old)+len(new))
+	for key := range old {
+		keys = append(keys, key)
+	}
+	for key := range new {
+		if old[key] == nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Nmi != keys[j].Nmi {
+			return keys[i].Nmi < keys[j].Nmi
+		}
+		if keys[i].NmiSuffix != keys[j].NmiSuffix {
+			return keys[i].NmiSuffix < keys[j].NmiSuffix
+		}
+		if keys[i].Uom != keys[j].Uom {
+			return keys[i].Uom < keys[j].Uom
+		}
+		return keys[i].IntervalDate.Before(keys[j].IntervalDate)
+	})
+
+	var changes []DiffChange
+	for _, key := range keys {
+		change := func(interval int, kind string, oldValue string, newValue string) {
+			changes = append(changes, DiffChange{key.Nmi, key.NmiSuffix, key.Uom, key.IntervalDate.Format(jsonDateLayout), interval, kind, oldValue, newValue})
+		}
+
+		oldDay, newDay := old[key], new[key]
+		switch {
+		case oldDay == nil:
+			change(0, diffAdded, "", "")
+			continue
+		case newDay == nil:
+			change(0, diffRemoved, "", "")
+			continue
+		}
+
+		if oldDay.UpdateDateTime != newDay.UpdateDateTime {
+			change(0, diffUpdateDateTime, oldDay.UpdateDateTime, newDay.UpdateDateTime)
+		}
+		if oldDay.IntervalLength != newDay.IntervalLength || len(oldDay.Intervals) != len(newDay.Intervals) {
+			change(0, diffIntervalLength, strconv.Itoa(int(oldDay.IntervalLength/time.Minute)), strconv.Itoa(int(newDay.IntervalLength/time.Minute)))
+			continue
+		}
+		for i := range oldDay.Intervals {
+			oldInterval, newInterval := &oldDay.Intervals[i], &newDay.Intervals[i]
+			if diffValues(oldInterval.Value, newInterval.Value) {
+				change(i+1, diffValue, oldInterval.Value, newInterval.Value)
+			}
+			if oldInterval.QualityMethod != newInterval.QualityMethod {
+				change(i+1, diffQualityMethod, oldInterval.QualityMethod, newInterval.QualityMethod)
+			}
+			if oldInterval.ReasonCode != newInterval.ReasonCode {
+				change(i+1, diffReasonCode, oldInterval.ReasonCode, newInterval.ReasonCode)
+			}
+		}
+	}
+
+	return changes
+}
+
+// runDiff runs the diff command: the interval-level differences between two NEM12 files, e.g. an original and a resend. It exits with status 1 if the files differ.
+func runDiff(args []string) error {
+	flagSet := flag.NewFlagSet("diff", flag.ExitOnError)
+	format := flagSet.String("format", "text", "write differences as `text` or json")
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), "Usage: %s diff [flags] old new\n", os.Args[0])
+		flagSet.PrintDefaults()
+	}
+	flagSet.Parse(args)
+
+	if flagSet.NArg() != 2 || (*format != "text" && *format != "json") {
+		flagSet.Usage()
+		os.Exit(2)
+	}
+	old, err := readDiffDays(flagSet.Arg(0))
+	if err != nil {
+		return err
+	}
+	new, err := readDiffDays(flagSet.Arg(1))
+	if err != nil {
+		return err
+	}
+	changes := DiffNem12(old, new)
+
+	writer := bufio.NewWriter(os.Stdout)
+	if *format == "json" {
+		if changes == nil {
+			changes = []DiffChange{}
+		}
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "\t")
+		err = encoder.Encode(map[string]any{"changes": changes})
+	} else {
+		for _, change := range changes {
+			fmt.Fprintf(writer, "%s %s %s %s", change.Nmi, change.NmiSuffix, change.Uom, change.IntervalDate)
+			if change.Interval > 0 {
+				fmt.Fprintf(writer, " #%d", change.Interval)
+			}
+			switch change.Change {
+			case diffAdded, diffRemoved:
+				fmt.Fprintf(writer, " %s\n", change.Change)
+			default:
+				fmt.Fprintf(writer, " %s: %q -> %q\n", change.Change, change.Old, change.New)
+			}
+		}
+	}
+	if err := errors.Join(err, writer.Flush()); err != nil {
+		return err
+	}
+
+	if len(changes) > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffNem12(t *testing.T) {
+	values := strings.Split(strings.Repeat("0.500,", 48), ",")[:48]
+	values[4] = "0.7"
+	block15 := strings.Replace(testBlockLine("NEM1201009", "E2"), ",30,", ",15,", 1)
+	files := map[string]string{
+		"old.csv": testNem12(
+			testHeaderLine,
+			testBlockLine("NEM1201009", "B1"),
+			testDayLine("20050301", "1", ""),
+			testBlockLine("NEM1201009", "E1"),
+			testDayLine("20050301", "0.5", "20050302000000"),
+			testDayLine("20050302", "1", ""),
+			testDayLine("20050303", "1", ""),
+			testBlockLine("NEM1201009", "E2"),
+			testDayLine("20050301", "1", ""),
+			"900",
+		),
+		"new.csv": testNem12(
+			testHeaderLine,
+			testBlockLine("NEM1201009", "E1"),
+			"300,20050301,"+strings.Join(values, ",")+",A,,,20050303000000,",
+			strings.Replace(testDayLine("20050302", "1", ""), ",A,,,", ",V,,,", 1),
+			"400,1,1,S53,79,",
+			"400,2,48,A,,",
+			testDayLine("20050303", "2", ""),
+			testDayLine("20050303", "1.0", ""), // Sent again, so only this version counts.
+			testDayLine("20050304", "1", ""),
+			block15,
+			"300,20050301"+strings.Repeat(",0.5", 96)+",A,,,,",
+			"900",
+		),
+	}
+	dir := t.TempDir()
+	days := map[string]map[diffKey]*diffDay{}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		var err error
+		if days[name], err = readDiffDays(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	change := func(nmiSuffix string, intervalDate string, interval int, kind string, old string, new string) DiffChange {
+		return DiffChange{"NEM1201009", nmiSuffix, "kWh", intervalDate, interval, kind, old, new}
+	}
+	want := []DiffChange{
+		change("B1", "2005-03-01", 0, diffRemoved, "", ""),
+		change("E1", "2005-03-01", 0, diffUpdateDateTime, "2005-03-02T00:00:00+10:00", "2005-03-03T00:00:00+10:00"),
+		change("E1", "2005-03-01", 5, diffValue, "0.5", "0.7"),
+		change("E1", "2005-03-02", 1, diffQualityMethod, "A", "S53"),
+		change("E1", "2005-03-02", 1, diffReasonCode, "", "79"),
+		change("E1", "2005-03-04", 0, diffAdded, "", ""),
+		change("E2", "2005-03-01", 0, diffIntervalLength, "30", "15"),
+	}
+	if got := DiffNem12(days["old.csv"], days["new.csv"]); !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%+v\nwant\n%+v", got, want)
+	}
+	if got := DiffNem12(days["new.csv"], days["new.csv"]); got != nil {
+		t.Errorf("got %+v comparing a file with itself", got)
+	}
+}
+
+func TestReadDiffDaysInvalid(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "bad.csv")
+	if err := os.WriteFile(name, []byte(testNem12(testHeaderLine, "200")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readDiffDays(name); err == nil || !strings.Contains(err.Error(), "bad.csv: line 2:") {
+		t.Errorf("got %v, want the error on line 2", err)
+	}
+}
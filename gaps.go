@@ -0,0 +1,177 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Cheejyg/Flo-Energy-Tech-Assessment/nem12"
+)
+
+func init() {
+	RegisterSink("gaps", func(config *SinkConfig) (Sink, error) {
+		if config.Append {
+			return nil, ErrSinkNotResumable
+		}
+
+		format := reportFormat(config)
+
+		return newFileSink(config, func(writer io.Writer) (Sink, error) {
+			return NewGapsWriter(writer, format)
+		})
+	})
+}
+
+const (
+	gapMissing   = "missing"
+	gapDuplicate = "duplicate"
+	gapZero      = "zero"
+)
+
+// gapsDay is what was read of one channel's interval date.
+type gapsDay struct {
+	NonZero    []bool // One per 300 record read for the date, in the order read.
+	Source     *SourceFile
+	LineNumber int
+}
+
+// gapsIssue is one finding, in the order it is written.
+type gapsIssue struct {
+	Date    time.Time
+	Issue   string
+	Records int
+	Version int // The 300 record a zero refers to, from 1 in the order read, or 0.
+}
+
+// GapsWriter checks each NMI channel's interval dates, across every 200 record, and writes what looks wrong as CSV or JSON on Close:
+//
+//   - missing: a date between the channel's first and last date without a 300 record.
+//   - duplicate: a date with more than one 300 record, e.g. a day sent again.
+//   - zero: a date whose intervals are all zero, once for each 300 record read for it that is, with its version.
+type GapsWriter struct {
+	report *reportWriter
+
+	days map[StoreSeries]map[time.Time]*gapsDay
+}
+
+func NewGapsWriter(writer io.Writer, format string) (*GapsWriter, error) {
+	report, err := newReportWriter(writer, format)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GapsWriter{
+		report: report,
+		days:   make(map[StoreSeries]map[time.Time]*gapsDay, 16),
+	}, nil
+}
+
+func (gapsWriter *GapsWriter) WriteBatch(meterReadingsJob []*MeterReadingsJob) error {
+	for _, job := range meterReadingsJob {
+		value, err := nem12.ParseIntervalValueDecimal(job.Consumption, aggregateScale)
+		if err != nil {
+			return err
+		}
+
+		channel := StoreSeries{job.Nmi, job.NmiSuffix, job.Uom}
+		days := gapsWriter.days[channel]
+		if days == nil {
+			days = make(map[time.Time]*gapsDay, 64)
+			gapsWriter.days[channel] = days
+		}
+
+		date := job.Timestamp.Add(-job.IntervalLength).Truncate(24 * time.Hour)
+		if job.IntervalData != nil {
+			date = job.IntervalData.IntervalDate
+		}
+		day := days[date]
+		if day == nil {
+			day = &gapsDay{}
+			days[date] = day
+		}
+		if len(day.NonZero) == 0 || day.Source != job.Source || day.LineNumber != job.LineNumber {
+			day.NonZero = append(day.NonZero, false)
+			day.Source, day.LineNumber = job.Source, job.LineNumber
+		}
+		if value != 0 {
+			day.NonZero[len(day.NonZero)-1] = true
+		}
+	}
+
+	return nil
+}
+
+// gapsIssues returns the findings of one channel by date.
+func gapsIssues(days map[time.Time]*gapsDay) []gapsIssue {
+	dates := make([]time.Time, 0, len(days))
+	for date := range days {
+		dates = append(dates, date)
+	}
+	sort.Slice(dates, func(i, j int) bool {
+		return dates[i].Before(dates[j])
+	})
+
+	var issues []gapsIssue
+	for i, date := range dates {
+		if i > 0 {
+			for missing := dates[i-1].AddDate(0, 0, 1); missing.Before(date); missing = missing.AddDate(0, 0, 1) {
+				issues = append(issues, gapsIssue{Date: missing, Issue: gapMissing})
+			}
+		}
+		day := days[date]
+		if len(day.NonZero) > 1 {
+			issues = append(issues, gapsIssue{Date: date, Issue: gapDuplicate, Records: len(day.NonZero)})
+		}
+		for version, nonZero := range day.NonZero {
+			if !nonZero {
+				issues = append(issues, gapsIssue{Date: date, Issue: gapZero, Records: len(day.NonZero), Version: version + 1})
+			}
+		}
+	}
+
+	return issues
+}
+
+func (gapsWriter *GapsWriter) Flush() error {
+	return nil
+}
+
+// Close writes one row per finding, by channel and date. It does not close the underlying writer.
+func (gapsWriter *GapsWriter) Close() error {
+	report := gapsWriter.report
+	if err := report.Begin("nmi,nmi_suffix,uom,interval_date,issue,records,version"); err != nil {
+		return err
+	}
+
+	line := make([]byte, 0, 128)
+	for _, channel := range sortedChannels(gapsWriter.days) {
+		for _, issue := range gapsIssues(gapsWriter.days[channel]) {
+			line = report.Field(line[:0], "nmi")
+			line = report.AppendString(line, channel.Nmi)
+			line = report.Field(line, "nmi_suffix")
+			line = report.AppendString(line, channel.NmiSuffix)
+			line = report.Field(line, "uom")
+			line = report.AppendString(line, channel.Uom)
+			line = report.Field(line, "interval_date")
+			line = report.AppendDate(line, issue.Date)
+			line = report.Field(line, "issue")
+			line = report.AppendString(line, issue.Issue)
+			line = report.Field(line, "records")
+			line = strconv.AppendInt(line, int64(issue.Records), 10)
+			line = report.Field(line, "version")
+			if issue.Version > 0 {
+				line = strconv.AppendInt(line, int64(issue.Version), 10)
+			} else {
+				line = report.AppendNull(line)
+			}
+			if err := report.Record(line); err != nil {
+				return err
+			}
+		}
+	}
+
+	return report.End()
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestGapsWriter(t *testing.T) {
+	sink := loadTestNem12(t, []byte(testNem12(
+		testHeaderLine,
+		testBlockLine("NEM1201009", "E1"),
+		testDayLine("20050301", "1", ""),
+		testDayLine("20050302", "0", ""),
+		testDayLine("20050305", "1", ""),
+		testDayLine("20050305", "0", ""),
+		testBlockLine("NEM1201009", "B1"),
+		testDayLine("20050301", "0.5", ""),
+		testDayLine("20050302", "0.5", ""),
+		"900",
+	)))
+
+	write := func(format string) string {
+		var b bytes.Buffer
+		gapsWriter, err := NewGapsWriter(&b, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := gapsWriter.WriteBatch(sink.jobs); err != nil {
+			t.Fatal(err)
+		}
+		if err := gapsWriter.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return b.String()
+	}
+
+	want := `nmi,nmi_suffix,uom,interval_date,issue,records,version
+NEM1201009,E1,kWh,2005-03-02,zero,1,1
+NEM1201009,E1,kWh,2005-03-03,missing,0,
+NEM1201009,E1,kWh,2005-03-04,missing,0,
+NEM1201009,E1,kWh,2005-03-05,duplicate,2,
+NEM1201009,E1,kWh,2005-03-05,zero,2,2
+`
+	if got := write("csv"); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	want = `[
+{"nmi":"NEM1201009","nmi_suffix":"E1","uom":"kWh","interval_date":"2005-03-02","issue":"zero","records":1,"version":1},
+{"nmi":"NEM1201009","nmi_suffix":"E1","uom":"kWh","interval_date":"2005-03-03","issue":"missing","records":0,"version":null},
+{"nmi":"NEM1201009","nmi_suffix":"E1","uom":"kWh","interval_date":"2005-03-04","issue":"missing","records":0,"version":null},
+{"nmi":"NEM1201009","nmi_suffix":"E1","uom":"kWh","interval_date":"2005-03-05","issue":"duplicate","records":2,"version":null},
+{"nmi":"NEM1201009","nmi_suffix":"E1","uom":"kWh","interval_date":"2005-03-05","issue":"zero","records":2,"version":2}
+]
+`
+	if got := write("json"); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	if _, err := NewGapsWriter(&bytes.Buffer{}, "xml"); !errors.Is(err, ErrInvalidAggregateFormat) {
+		t.Errorf("got %v for xml, want %v", err, ErrInvalidAggregateFormat)
+	}
+}
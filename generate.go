@@ -0,0 +1,362 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Cheejyg/Flo-Energy-Tech-Assessment/nem12"
+)
+
+var ErrInvalidShares = errors.New("invalid shares, want name:share,...")
+var ErrInvalidGeneratorConfig = errors.New("invalid generator config")
+
+// parseShares parses comma-separated name:share pairs, e.g. A:0.9,E:0.1, each share from 0 to 1. A name without a share has a share of 1.
+func parseShares(s string, names string) (map[string]float64, error) {
+	shares := make(map[string]float64)
+	for _, pair := range strings.Split(s, ",") {
+		if pair == "" {
+			continue
+		}
+		name, value, found := strings.Cut(pair, ":")
+		share := 1.0
+		if found {
+			var err error
+			if share, err = strconv.ParseFloat(value, 64); err != nil || share < 0 || share > 1 {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidShares, pair)
+			}
+		}
+		if names != "" && !strings.Contains(","+names+",", ","+name+",") {
+			return nil, fmt.Errorf("%w: %s, want one of %s", ErrInvalidShares, name, names)
+		}
+		shares[name] = share
+	}
+	return shares, nil
+}
+
+// GeneratorConfig configures a Generator. Shares are per NMI for Channels, and per day for Quality, B2b and Defects; days without another quality flag are A.
+type GeneratorConfig struct {
+	Seed            uint64
+	Nmis            int
+	Start           time.Time
+	Days            int
+	IntervalLength  int // Minutes.
+	Channels        map[string]float64
+	Quality         map[string]float64
+	B2b             float64
+	Defects         map[string]float64
+	FromParticipant string
+	ToParticipant   string
+}
+
+const generatorQualities = "A,E,S,F,V"
+const generatorDefects = "missing,duplicate,zero,spike,flatline"
+
+// Generator writes synthetic NEM12 files: residential load with morning and evening peaks, solar export and reactive energy, with the configured mix of channels and quality flags, and injected defects. The same config and Seed write the same file.
+//
+// Channels are NMI suffixes: E (import) channels carry load less solar, B (export) channels the excess solar, and Q channels reactive energy at a power factor of 0.9 to 0.98. V days have 400 records for a run of substituted intervals. Defects are days that are missing, sent again later in the same 200 record with other values (duplicate), all zero, or have an interval 20 times too large (spike) or 8 hours of one value (flatline).
+type Generator struct {
+	GeneratorConfig
+	rand *rand.Rand
+}
+
+func NewGenerator(config GeneratorConfig) *Generator {
+	return &Generator{
+		GeneratorConfig: config,
+		rand:            rand.New(rand.NewPCG(config.Seed, config.Seed^0x9e3779b97f4a7c15)),
+	}
+}
+
+// pick returns a name chosen by share, in name order, or "" for the rest if the shares add up to less than 1.
+func (generator *Generator) pick(shares map[string]float64) string {
+	names := make([]string, 0, len(shares))
+	for name := range shares {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	r := generator.rand.Float64()
+	for _, name := range names {
+		if r < shares[name] {
+			return name
+		}
+		r -= shares[name]
+	}
+	return ""
+}
+func (generator *Generator) chance(share float64) bool {
+	return share > 0 && generator.rand.Float64() < share
+}
+
+// generatorSite is the profile of one NMI.
+type generatorSite struct {
+	Nmi         string
+	Channels    []string
+	Base        float64 // kW.
+	Peak        float64 // kW.
+	Solar       float64 // kW peak, 0 without B channels.
+	PowerFactor float64
+}
+
+// load returns a site's average load and solar generation in kW over the interval starting at minute of day.
+func (generator *Generator) load(site *generatorSite, date time.Time, minute int, cloud float64) (float64, float64) {
+	hour := float64(minute) / 60
+	morning := math.Exp(-(hour - 7.5) * (hour - 7.5) / 2)
+	evening := math.Exp(-(hour - 19) * (hour - 19) / 4)
+	winter := 1 + 0.3*math.Cos(2*math.Pi*float64(date.YearDay()-196)/365)
+	load := (site.Base + site.Peak*(0.6*morning+evening)*winter) * (0.85 + 0.3*generator.rand.Float64())
+
+	var solar float64
+	if site.Solar > 0 && hour > 6 && hour < 18 {
+		solar = site.Solar * math.Sin(math.Pi*(hour-6)/12) * cloud * (0.9 + 0.2*generator.rand.Float64())
+	}
+	return load, solar
+}
+
+func generatorValue(b []byte, v float64) []byte {
+	return strconv.AppendFloat(b, math.Max(0, math.Round(v*1000)/1000), 'f', -1, 64)
+}
+
+// Generate writes the file.
+func (generator *Generator) Generate(writer io.Writer) error {
+	if generator.Nmis <= 0 || generator.Days <= 0 || generator.IntervalLength <= 0 || 1440%generator.IntervalLength != 0 {
+		return fmt.Errorf("%w: %d NMIs, %d days of %d-minute intervals", ErrInvalidGeneratorConfig, generator.Nmis, generator.Days, generator.IntervalLength)
+	}
+
+	headerLine := appendHeaderRecord(nil, generator.Start.AddDate(0, 0, generator.Days+1).Add(9*time.Hour), generator.FromParticipant, generator.ToParticipant)
+	nem12Writer, err := NewNem12Writer(writer, headerLine)
+	if err != nil {
+		return err
+	}
+
+	n := 1440 / generator.IntervalLength
+	hours := float64(generator.IntervalLength) / 60
+	suffixes := make([]string, 0, len(generator.Channels))
+	for suffix := range generator.Channels {
+		suffixes = append(suffixes, suffix)
+	}
+	sort.Strings(suffixes)
+
+	line := make([]byte, 0, 16*n+128)
+	values := make([]float64, n)
+	for i := 0; i < generator.Nmis; i++ {
+		site := &generatorSite{
+			Nmi:         fmt.Sprintf("QGEN%06d", i+1),
+			Base:        0.2 + 0.4*generator.rand.Float64(),
+			Peak:        1 + 3*generator.rand.Float64(),
+			PowerFactor: 0.9 + 0.08*generator.rand.Float64(),
+		}
+		for _, suffix := range suffixes {
+			if generator.chance(generator.Channels[suffix]) {
+				site.Channels = append(site.Channels, suffix)
+				if suffix[0] == 'B' {
+					site.Solar = 3 + 5*generator.rand.Float64()
+				}
+			}
+		}
+		if len(site.Channels) == 0 {
+			continue
+		}
+
+		// Readings per day, channel and interval, so that import, export and reactive agree.
+		type generatorDay struct {
+			Import, Export []float64
+		}
+		days := make([]generatorDay, generator.Days)
+		for d := range days {
+			date := generator.Start.AddDate(0, 0, d)
+			cloud := 0.3 + 0.7*generator.rand.Float64()
+			days[d] = generatorDay{make([]float64, n), make([]float64, n)}
+			for j := 0; j < n; j++ {
+				load, solar := generator.load(site, date, j*generator.IntervalLength, cloud)
+				days[d].Import[j] = math.Max(0, load-solar) * hours
+				days[d].Export[j] = math.Max(0, solar-load) * hours
+			}
+		}
+
+		configuration := strings.Join(site.Channels, "")
+		nextScheduledRead := generator.Start.AddDate(0, 3, 0)
+		for c, suffix := range site.Channels {
+			uom := "kWh"
+			if suffix[0] == 'Q' {
+				uom = "kVArh"
+			}
+			line = fmt.Appendf(line[:0], "200,%s,%s,%d,%s,N%c,%06d,%s,%d,%s", site.Nmi, configuration, c+1, suffix, suffix[len(suffix)-1], 100000+i, uom, generator.IntervalLength, nextScheduledRead.Format("20060102"))
+			if err := nem12Writer.WriteLine(line); err != nil {
+				return err
+			}
+
+			for d := range days {
+				date := generator.Start.AddDate(0, 0, d)
+				for j := range values {
+					switch suffix[0] {
+					case 'B':
+						values[j] = days[d].Export[j]
+					case 'Q':
+						values[j] = days[d].Import[j] * math.Tan(math.Acos(site.PowerFactor))
+					default:
+						values[j] = days[d].Import[j]
+					}
+				}
+
+				defect := generator.pick(generator.Defects)
+				switch defect {
+				case "missing":
+					continue
+				case "zero":
+					clear(values)
+				case "spike":
+					values[generator.rand.IntN(n)] *= 20
+				case "flatline":
+					start := generator.rand.IntN(n)
+					level := math.Max(values[start], 0.1)
+					for j := start; j < min(n, start+480/generator.IntervalLength); j++ {
+						values[j] = level
+					}
+				}
+
+				updated := date.AddDate(0, 0, 1).Add(time.Duration(generator.rand.IntN(12*60)) * time.Minute)
+				if err := generator.writeDay(nem12Writer, line, date, values, updated); err != nil {
+					return err
+				}
+				if defect == "duplicate" {
+					for j := range values {
+						values[j] *= 0.9 + 0.2*generator.rand.Float64()
+					}
+					if err := generator.writeDay(nem12Writer, line, date, values, updated.AddDate(0, 0, 2)); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	return nem12Writer.Close()
+}
+
+// writeDay writes a 300 record, with a quality flag chosen by share, and its 400 and 500 records.
+func (generator *Generator) writeDay(nem12Writer *Nem12Writer, line []byte, date time.Time, values []float64, updated time.Time) error {
+	n := len(values)
+	quality := generator.pick(generator.Quality)
+	if quality == "" {
+		quality = "A"
+	}
+
+	line = append(line[:0], nem12.RecordIndicatorIntervalDataString...)
+	line = append(line, COMMA)
+	line = date.AppendFormat(line, "20060102")
+	for _, v := range values {
+		line = append(line, COMMA)
+		line = generatorValue(line, v)
+	}
+	switch quality {
+	case "E":
+		line = append(line, ",E52,,,"...)
+	case "S", "F":
+		line = append(line, ","+quality+"53,32,,"...)
+	default:
+		line = append(line, ","+quality+",,,"...)
+	}
+	line = updated.AppendFormat(line, "20060102150405")
+	line = append(line, COMMA)
+	line = updated.Add(time.Duration(1+generator.rand.IntN(6))*time.Hour).AppendFormat(line, "20060102150405")
+	if err := nem12Writer.WriteLine(line); err != nil {
+		return err
+	}
+
+	if quality == "V" {
+		// A run of substituted intervals between actual ones.
+		start := 1 + generator.rand.IntN(n-1)
+		end := start + generator.rand.IntN(n-start)
+		events := [][3]string{{"1", strconv.Itoa(start - 1), "A,"}, {strconv.Itoa(start), strconv.Itoa(end), "S53,32"}, {strconv.Itoa(end + 1), strconv.Itoa(n), "A,"}}
+		if start == 1 {
+			events = events[1:]
+		}
+		for _, event := range events {
+			line = fmt.Appendf(line[:0], "400,%s,%s,%s,", event[0], event[1], event[2])
+			if err := nem12Writer.WriteLine(line); err != nil {
+				return err
+			}
+		}
+	}
+
+	if generator.chance(generator.B2b) {
+		read := date.AddDate(0, 0, 1).Add(time.Duration(generator.rand.IntN(24*60)) * time.Minute)
+		line = fmt.Appendf(line[:0], "500,O,S%05d,%s,", generator.rand.IntN(100000), read.Format("20060102150405"))
+		if err := nem12Writer.WriteLine(line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runGenerate runs the generate command: a synthetic NEM12 file for load tests and test fixtures.
+func runGenerate(args []string) error {
+	flagSet := flag.NewFlagSet("generate", flag.ExitOnError)
+	seed := flagSet.Uint64("seed", 1, "random `seed`; the same flags and seed generate the same file")
+	nmis := flagSet.Int("nmis", 10, "number of `NMIs`")
+	start := flagSet.String("start", "2025-01-01", "first interval `date`")
+	days := flagSet.Int("days", 30, "number of `days`")
+	intervalLength := flagSet.Int("interval", 30, "interval length in `minutes`: 5, 15 or 30")
+	channels := flagSet.String("channels", "E1,B1:0.3,Q1:0.2", "channel `mix`: NMI suffixes, each with the share of NMIs that have it")
+	quality := flagSet.String("quality", "A:0.9,E:0.04,S:0.02,F:0.01,V:0.03", "quality flag `mix`: the share of days with each flag, V with 400 records")
+	b2b := flagSet.Float64("b2b", 0.02, "`share` of days with a 500 record")
+	defects := flagSet.String("defects", "", "`defects` to inject, e.g. missing:0.01,duplicate:0.01,zero:0.01,spike:0.01,flatline:0.01")
+	fromParticipant := flagSet.String("from", "GENMDP", "FromParticipant")
+	toParticipant := flagSet.String("to", "GENRETAIL", "ToParticipant")
+	output := flagSet.String("o", "-", "write the file to `path`, - for stdout")
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), "Usage: %s generate [flags]\n", os.Args[0])
+		flagSet.PrintDefaults()
+	}
+	flagSet.Parse(args)
+
+	config := GeneratorConfig{
+		Seed:            *seed,
+		Nmis:            *nmis,
+		Days:            *days,
+		IntervalLength:  *intervalLength,
+		B2b:             *b2b,
+		FromParticipant: *fromParticipant,
+		ToParticipant:   *toParticipant,
+	}
+	var err error
+	if config.Start, err = nem12.ParseDate8(strings.ReplaceAll(*start, "-", "")); err != nil {
+		return fmt.Errorf("-start: %w", err)
+	}
+	if config.Channels, err = parseShares(*channels, ""); err != nil {
+		return fmt.Errorf("-channels: %w", err)
+	}
+	for suffix := range config.Channels {
+		if len(suffix) != 2 || !strings.ContainsRune("EBQ", rune(suffix[0])) {
+			return fmt.Errorf("-channels: %w: %s, want E, B or Q and an element, e.g. E1", ErrInvalidShares, suffix)
+		}
+	}
+	if config.Quality, err = parseShares(*quality, generatorQualities); err != nil {
+		return fmt.Errorf("-quality: %w", err)
+	}
+	if config.Defects, err = parseShares(*defects, generatorDefects); err != nil {
+		return fmt.Errorf("-defects: %w", err)
+	}
+
+	generator := NewGenerator(config)
+	if *output == "-" {
+		return generator.Generate(os.Stdout)
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	return errors.Join(generator.Generate(file), file.Close())
+}
@@ -0,0 +1,232 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"maps"
+	"testing"
+	"time"
+)
+
+// testSink keeps every meter reading and 500 record it is given.
+type testSink struct {
+	jobs       []*MeterReadingsJob
+	b2bDetails []*B2bDetailsJob
+}
+
+func (testSink *testSink) WriteBatch(meterReadingsJob []*MeterReadingsJob) error {
+	testSink.jobs = append(testSink.jobs, meterReadingsJob...)
+	return nil
+}
+func (testSink *testSink) WriteB2bDetails(b2bDetailsJob []*B2bDetailsJob) error {
+	testSink.b2bDetails = append(testSink.b2bDetails, b2bDetailsJob...)
+	return nil
+}
+func (testSink *testSink) Flush() error {
+	return nil
+}
+func (testSink *testSink) Close() error {
+	return nil
+}
+
+// loadTestNem12 loads a NEM12 file the way the serve and watch commands do, failing the test if it does not load cleanly.
+func loadTestNem12(t *testing.T, file []byte) *testSink {
+	t.Helper()
+	sink := &testSink{}
+	summary, err := loadNem12(bytes.NewReader(file), "test.csv", sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !summary.Loaded || len(summary.Errors) > 0 {
+		t.Fatalf("not loaded: %v", summary.Errors)
+	}
+	return sink
+}
+
+func TestParseShares(t *testing.T) {
+	tests := []struct {
+		name   string
+		s      string
+		names  string
+		want   map[string]float64
+		errors bool
+	}{
+		{"empty", "", "A,E", map[string]float64{}, false},
+		{"shares", "A:0.9,E:0.1", "A,E", map[string]float64{"A": 0.9, "E": 0.1}, false},
+		{"no share", "E1,B1:0.3", "", map[string]float64{"E1": 1, "B1": 0.3}, false},
+		{"trailing comma", "A:0.5,", "A", map[string]float64{"A": 0.5}, false},
+		{"share above 1", "A:2", "A", nil, true},
+		{"negative share", "A:-0.1", "A", nil, true},
+		{"not a number", "A:x", "A", nil, true},
+		{"unknown name", "X:0.1", "A,E", nil, true},
+		{"name prefix", "AB:0.1", "A,E", nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseShares(test.s, test.names)
+			if test.errors {
+				if !errors.Is(err, ErrInvalidShares) {
+					t.Errorf("got %v, want %v", err, ErrInvalidShares)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func testGeneratorConfig() GeneratorConfig {
+	return GeneratorConfig{
+		Seed:            1,
+		Nmis:            3,
+		Start:           time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Days:            4,
+		IntervalLength:  30,
+		Channels:        map[string]float64{"E1": 1},
+		Quality:         map[string]float64{},
+		Defects:         map[string]float64{},
+		FromParticipant: "GENMDP",
+		ToParticipant:   "GENRETAIL",
+	}
+}
+
+func generateTestNem12(t *testing.T, config GeneratorConfig) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	if err := NewGenerator(config).Generate(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestGenerator(t *testing.T) {
+	tests := []struct {
+		name       string
+		edit       func(config *GeneratorConfig)
+		records    map[string]int // Records by indicator, 400 records as the least expected.
+		rows       int
+		b2bDetails int
+		check      func(t *testing.T, stats *Nem12Stats)
+	}{
+		{"import only", nil, map[string]int{"100": 1, "200": 3, "300": 12, "900": 1}, 3 * 4 * 48, 0, nil},
+		{"every channel", func(config *GeneratorConfig) {
+			config.Channels = map[string]float64{"E1": 1, "B1": 1, "Q1": 1}
+		}, map[string]int{"100": 1, "200": 9, "300": 36, "900": 1}, 9 * 4 * 48, 0, func(t *testing.T, stats *Nem12Stats) {
+			if stats.Uoms["kVArh"] == nil || stats.Uoms["kVArh"].Channels != 3 {
+				t.Errorf("got UOMs %v, want 3 kVArh channels", stats.Uoms)
+			}
+		}},
+		{"5-minute", func(config *GeneratorConfig) {
+			config.IntervalLength = 5
+		}, map[string]int{"100": 1, "200": 3, "300": 12, "900": 1}, 3 * 4 * 288, 0, func(t *testing.T, stats *Nem12Stats) {
+			if stats.IntervalLengths[5] != 3 {
+				t.Errorf("got interval lengths %v, want 3 of 5 minutes", stats.IntervalLengths)
+			}
+		}},
+		{"substituted days", func(config *GeneratorConfig) {
+			config.Quality = map[string]float64{"V": 1}
+		}, map[string]int{"100": 1, "200": 3, "300": 12, "400": 2 * 12, "900": 1}, 3 * 4 * 48, 0, func(t *testing.T, stats *Nem12Stats) {
+			if stats.Quality["V"] != 0 || stats.Quality["A"] == 0 || stats.Quality["S"] == 0 {
+				t.Errorf("got quality %v, want A and S intervals from the 400 records", stats.Quality)
+			}
+		}},
+		{"500 records", func(config *GeneratorConfig) {
+			config.B2b = 1
+		}, map[string]int{"100": 1, "200": 3, "300": 12, "500": 12, "900": 1}, 3 * 4 * 48, 12, nil},
+		{"missing days", func(config *GeneratorConfig) {
+			config.Defects = map[string]float64{"missing": 1}
+		}, map[string]int{"100": 1, "200": 3, "900": 1}, 0, 0, nil},
+		{"duplicate days", func(config *GeneratorConfig) {
+			config.Defects = map[string]float64{"duplicate": 1}
+		}, map[string]int{"100": 1, "200": 3, "300": 24, "900": 1}, 2 * 3 * 4 * 48, 0, func(t *testing.T, stats *Nem12Stats) {
+			if stats.DuplicateDays != 12 {
+				t.Errorf("got %d duplicate days, want 12", stats.DuplicateDays)
+			}
+		}},
+		{"zero days", func(config *GeneratorConfig) {
+			config.Defects = map[string]float64{"zero": 1}
+		}, map[string]int{"100": 1, "200": 3, "300": 12, "900": 1}, 3 * 4 * 48, 0, func(t *testing.T, stats *Nem12Stats) {
+			if total := stats.Uoms["kWh"].Total; total != "0" {
+				t.Errorf("got total %s, want 0", total)
+			}
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := testGeneratorConfig()
+			if test.edit != nil {
+				test.edit(&config)
+			}
+			file := generateTestNem12(t, config)
+
+			if again := generateTestNem12(t, config); !bytes.Equal(again, file) {
+				t.Error("the same seed generated another file")
+			}
+			config.Seed++
+			if other := generateTestNem12(t, config); test.rows > 0 && bytes.Equal(other, file) {
+				t.Error("another seed generated the same file")
+			}
+
+			stats, err := ReadNem12Stats(bytes.NewReader(file), "test.csv")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for recordIndicator, want := range test.records {
+				if got := stats.Records[recordIndicator]; recordIndicator == "400" && got < want || recordIndicator != "400" && got != want {
+					t.Errorf("%s records: got %d, want %d", recordIndicator, got, want)
+				}
+			}
+			for recordIndicator := range stats.Records {
+				if _, ok := test.records[recordIndicator]; !ok {
+					t.Errorf("unexpected %s records", recordIndicator)
+				}
+			}
+			if stats.FromParticipant != "GENMDP" || stats.ToParticipant != "GENRETAIL" {
+				t.Errorf("got participants %s -> %s", stats.FromParticipant, stats.ToParticipant)
+			}
+			if test.check != nil {
+				test.check(t, stats)
+			}
+
+			sink := loadTestNem12(t, file)
+			if len(sink.jobs) != test.rows {
+				t.Errorf("loaded %d rows, want %d", len(sink.jobs), test.rows)
+			}
+			if len(sink.b2bDetails) != test.b2bDetails {
+				t.Errorf("loaded %d 500 records, want %d", len(sink.b2bDetails), test.b2bDetails)
+			}
+		})
+	}
+}
+
+func TestGeneratorInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(config *GeneratorConfig)
+	}{
+		{"no NMIs", func(config *GeneratorConfig) { config.Nmis = 0 }},
+		{"no days", func(config *GeneratorConfig) { config.Days = 0 }},
+		{"no interval length", func(config *GeneratorConfig) { config.IntervalLength = 0 }},
+		{"interval length not dividing a day", func(config *GeneratorConfig) { config.IntervalLength = 7 }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := testGeneratorConfig()
+			test.edit(&config)
+			var buffer bytes.Buffer
+			if err := NewGenerator(config).Generate(&buffer); !errors.Is(err, ErrInvalidGeneratorConfig) {
+				t.Errorf("got %v, want %v", err, ErrInvalidGeneratorConfig)
+			}
+			if buffer.Len() > 0 {
+				t.Errorf("wrote %d bytes", buffer.Len())
+			}
+		})
+	}
+}
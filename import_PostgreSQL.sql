@@ -3,4 +3,7 @@
 COPY meter_readings(nmi, timestamp, consumption)
 FROM 'C:/meter_readings.sql.csv' CSV;
 
+COPY b2b_details(nmi, nmi_suffix, uom, interval_date, trans_code, ret_service_order, read_datetime, index_read)
+FROM 'C:/b2b_details.sql.csv' CSV;
+
 --command " "\\copy public.meter_readings(nmi, \"timestamp\", consumption) FROM 'C:/meter_readings.sql.csv' WITH(FORMAT csv, DELIMITER ',', QUOTE '\"', ESCAPE '''');""
\ No newline at end of file
@@ -0,0 +1,183 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Cheejyg/Flo-Energy-Tech-Assessment/nem12"
+)
+
+func init() {
+	RegisterSink("influx", func(config *SinkConfig) (Sink, error) {
+		return newFileSink(config, func(writer io.Writer) (Sink, error) {
+			return NewInfluxFileWriter(writer, sinkOption(config.Options, "precision", "s"))
+		})
+	})
+	RegisterSink("influx-http", func(config *SinkConfig) (Sink, error) {
+		return NewInfluxHttpWriter(
+			config.Target,
+			config.Options.Get("org"),
+			sinkOption(config.Options, "bucket", "meter_readings"),
+			sinkOption(config.Options, "token", os.Getenv("INFLUX_TOKEN")),
+			sinkOption(config.Options, "precision", "s"),
+		)
+	})
+}
+
+const influxMeasurement string = "meter_readings"
+
+var ErrInvalidInfluxPrecision = errors.New("invalid influx precision, want s, ms, us or ns")
+
+var influxPrecision = map[string]time.Duration{
+	"s":  time.Second,
+	"ms": time.Millisecond,
+	"us": time.Microsecond,
+	"ns": time.Nanosecond,
+}
+
+var influxTagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// InfluxWriter writes meter readings as InfluxDB line protocol, either to a file for offline import or to the HTTP write API.
+type InfluxWriter struct {
+	writer    *bufio.Writer
+	client    *http.Client
+	url       string
+	token     string
+	precision time.Duration
+	buffer    bytes.Buffer
+}
+
+func NewInfluxFileWriter(writer io.Writer, precision string) (*InfluxWriter, error) {
+	unit, ok := influxPrecision[precision]
+	if !ok {
+		return nil, ErrInvalidInfluxPrecision
+	}
+
+	return &InfluxWriter{
+		writer:    bufio.NewWriterSize(writer, 1<<22),
+		precision: unit,
+	}, nil
+}
+
+// NewInfluxHttpWriter writes to the InfluxDB v2 write API at baseUrl, e.g. http://localhost:8086.
+func NewInfluxHttpWriter(baseUrl string, org string, bucket string, token string, precision string) (*InfluxWriter, error) {
+	unit, ok := influxPrecision[precision]
+	if !ok {
+		return nil, ErrInvalidInfluxPrecision
+	}
+
+	writeUrl, err := url.Parse(strings.TrimRight(baseUrl, "/") + "/api/v2/write")
+	if err != nil {
+		return nil, err
+	}
+	query := writeUrl.Query()
+	query.Set("org", org)
+	query.Set("bucket", bucket)
+	query.Set("precision", precision)
+	writeUrl.RawQuery = query.Encode()
+
+	return &InfluxWriter{
+		client:    &http.Client{Timeout: 60 * time.Second},
+		url:       writeUrl.String(),
+		token:     token,
+		precision: unit,
+	}, nil
+}
+
+func appendInfluxLine(b []byte, meterReadingsJob *MeterReadingsJob, precision time.Duration) ([]byte, error) {
+	consumption, err := nem12.ParseIntervalValue(meterReadingsJob.Consumption)
+	if err != nil {
+		return b, err
+	}
+
+	b = append(b, influxMeasurement...)
+	b = append(b, ",nmi="...)
+	b = append(b, influxTagEscaper.Replace(meterReadingsJob.Nmi)...)
+	if meterReadingsJob.NmiSuffix != "" {
+		b = append(b, ",suffix="...)
+		b = append(b, influxTagEscaper.Replace(meterReadingsJob.NmiSuffix)...)
+	}
+	if meterReadingsJob.Uom != "" {
+		b = append(b, ",uom="...)
+		b = append(b, influxTagEscaper.Replace(meterReadingsJob.Uom)...)
+	}
+	b = append(b, " consumption="...)
+	b = strconv.AppendFloat(b, consumption, 'f', -1, 64)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, meterReadingsJob.Timestamp.Add(-marketTimeOffset).UnixNano()/int64(precision), 10)
+
+	return append(b, '\n'), nil
+}
+
+// WriteBatch writes meterReadingsJob as one file chunk or one HTTP write request.
+func (influxWriter *InfluxWriter) WriteBatch(meterReadingsJob []*MeterReadingsJob) error {
+	if len(meterReadingsJob) == 0 {
+		return nil
+	}
+
+	influxWriter.buffer.Reset()
+	line := make([]byte, 0, 128)
+	for i := range meterReadingsJob {
+		var err error
+		line, err = appendInfluxLine(line[:0], meterReadingsJob[i], influxWriter.precision)
+		if err != nil {
+			return err
+		}
+		influxWriter.buffer.Write(line)
+	}
+
+	if influxWriter.client == nil {
+		if _, err := influxWriter.writer.Write(influxWriter.buffer.Bytes()); err != nil {
+			return err
+		}
+		return influxWriter.writer.Flush()
+	}
+
+	request, err := http.NewRequest(http.MethodPost, influxWriter.url, bytes.NewReader(influxWriter.buffer.Bytes()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if influxWriter.token != "" {
+		request.Header.Set("Authorization", "Token "+influxWriter.token)
+	}
+
+	response, err := influxWriter.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 1<<10))
+		return fmt.Errorf("influx write: %s: %s", response.Status, bytes.TrimSpace(body))
+	}
+	io.Copy(io.Discard, response.Body)
+
+	return nil
+}
+func (influxWriter *InfluxWriter) Flush() error {
+	if influxWriter.writer != nil {
+		return influxWriter.writer.Flush()
+	}
+
+	return nil
+}
+func (influxWriter *InfluxWriter) Close() error {
+	if influxWriter.writer != nil {
+		return influxWriter.writer.Flush()
+	}
+
+	return nil
+}
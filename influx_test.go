@@ -0,0 +1,168 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Cheejyg/Flo-Energy-Tech-Assessment/nem12"
+)
+
+func TestAppendInfluxLine(t *testing.T) {
+	tests := []struct {
+		name      string
+		edit      func(job *MeterReadingsJob)
+		precision string
+		want      string
+		err       error
+	}{
+		{"seconds", nil, "s", "meter_readings,nmi=NEM1201009,suffix=E1,uom=kWh consumption=1.5 1109601000\n", nil},
+		{"milliseconds", nil, "ms", "meter_readings,nmi=NEM1201009,suffix=E1,uom=kWh consumption=1.5 1109601000000\n", nil},
+		{"nanoseconds", nil, "ns", "meter_readings,nmi=NEM1201009,suffix=E1,uom=kWh consumption=1.5 1109601000000000000\n", nil},
+		{"no suffix or uom", func(job *MeterReadingsJob) { job.NmiSuffix, job.Uom = "", "" }, "s", "meter_readings,nmi=NEM1201009 consumption=1.5 1109601000\n", nil},
+		{"escaped tags", func(job *MeterReadingsJob) { job.Nmi, job.Uom = "NEM 12,01=9", "k Wh" }, "s", `meter_readings,nmi=NEM\ 12\,01\=9,suffix=E1,uom=k\ Wh consumption=1.5 1109601000` + "\n", nil},
+		{"integer value", func(job *MeterReadingsJob) { job.Consumption = []byte("10.000") }, "s", "meter_readings,nmi=NEM1201009,suffix=E1,uom=kWh consumption=10 1109601000\n", nil},
+		{"invalid value", func(job *MeterReadingsJob) { job.Consumption = []byte("") }, "s", "", nem12.ErrInvalidIntervalValue},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			job := testMeterReadingsJobs()[0]
+			if test.edit != nil {
+				test.edit(job)
+			}
+			got, err := appendInfluxLine(nil, job, influxPrecision[test.precision])
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+			if string(got) != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestInfluxFileWriter(t *testing.T) {
+	if _, err := NewInfluxFileWriter(io.Discard, "m"); !errors.Is(err, ErrInvalidInfluxPrecision) {
+		t.Errorf("precision m: got %v, want %v", err, ErrInvalidInfluxPrecision)
+	}
+
+	var buffer bytes.Buffer
+	influxWriter, err := NewInfluxFileWriter(&buffer, "s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs := testMeterReadingsJobs()
+	for _, batch := range [][]*MeterReadingsJob{jobs[:2], nil, jobs[2:]} {
+		if err := influxWriter.WriteBatch(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := influxWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+	if len(lines) != len(jobs) {
+		t.Fatalf("got %d lines, want %d", len(lines), len(jobs))
+	}
+	for i, job := range jobs {
+		want, _ := appendInfluxLine(nil, job, influxPrecision["s"])
+		if lines[i]+"\n" != string(want) {
+			t.Errorf("line %d: got %q, want %q", i, lines[i], want)
+		}
+	}
+}
+
+// TestInfluxHttpWriter writes to a local stand-in for the InfluxDB v2 write API.
+func TestInfluxHttpWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		status int
+		body   string
+		err    string
+	}{
+		{"no content", "secret", http.StatusNoContent, "", ""},
+		{"no token", "", http.StatusNoContent, "", ""},
+		{"rejected", "secret", http.StatusBadRequest, `{"code":"invalid","message":"unable to parse"}` + "\n", `influx write: 400 Bad Request: {"code":"invalid","message":"unable to parse"}`},
+		{"unauthorized", "wrong", http.StatusUnauthorized, "", "influx write: 401 Unauthorized: "},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests []*http.Request
+			var bodies []string
+			server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				body, _ := io.ReadAll(request.Body)
+				requests = append(requests, request)
+				bodies = append(bodies, string(body))
+				writer.WriteHeader(test.status)
+				io.WriteString(writer, test.body)
+			}))
+			defer server.Close()
+
+			influxWriter, err := NewInfluxHttpWriter(server.URL+"/", "flo", "readings", test.token, "ms")
+			if err != nil {
+				t.Fatal(err)
+			}
+			jobs := testMeterReadingsJobs()
+			if err := influxWriter.WriteBatch(nil); err != nil {
+				t.Fatal(err)
+			}
+			err = influxWriter.WriteBatch(jobs)
+			if test.err == "" && err != nil {
+				t.Fatal(err)
+			}
+			if test.err != "" && (err == nil || err.Error() != test.err) {
+				t.Fatalf("got error %v, want %q", err, test.err)
+			}
+			if err := influxWriter.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(requests) != 1 {
+				t.Fatalf("got %d requests, want 1", len(requests))
+			}
+			request := requests[0]
+			if request.Method != http.MethodPost || request.URL.Path != "/api/v2/write" {
+				t.Errorf("got %s %s, want POST /api/v2/write", request.Method, request.URL.Path)
+			}
+			if query := request.URL.Query(); query.Get("org") != "flo" || query.Get("bucket") != "readings" || query.Get("precision") != "ms" {
+				t.Errorf("got query %v", query)
+			}
+			wantAuthorization := ""
+			if test.token != "" {
+				wantAuthorization = "Token " + test.token
+			}
+			if authorization := request.Header.Get("Authorization"); authorization != wantAuthorization {
+				t.Errorf("got Authorization %q, want %q", authorization, wantAuthorization)
+			}
+
+			var want []byte
+			for _, job := range jobs {
+				want, _ = appendInfluxLine(want, job, influxPrecision["ms"])
+			}
+			if bodies[0] != string(want) {
+				t.Errorf("got body %q, want %q", bodies[0], want)
+			}
+		})
+	}
+}
+
+func TestInfluxHttpWriterUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	influxWriter, err := NewInfluxHttpWriter(server.URL, "", "meter_readings", "", "s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := influxWriter.WriteBatch(testMeterReadingsJobs()); err == nil {
+		t.Error("got no error writing to a closed server")
+	}
+}
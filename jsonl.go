@@ -0,0 +1,264 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"bufio"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Cheejyg/Flo-Energy-Tech-Assessment/nem12"
+)
+
+const jsonTimestampLayout string = "2006-01-02T15:04:05"
+const jsonDateLayout string = "2006-01-02"
+const jsonMarketTimeOffset string = "+10:00" // marketTimeOffset
+
+const hex = "0123456789abcdef"
+
+func appendJsonString(b []byte, s string) []byte {
+	b = append(b, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b = append(b, '\\', c)
+		case c < 0x20:
+			b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xF])
+		case c < utf8.RuneSelf:
+			b = append(b, c)
+		default:
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if r == utf8.RuneError && size == 1 {
+				b = append(b, "\ufffd"...)
+			} else {
+				b = append(b, s[i:i+size]...)
+			}
+			i += size
+			continue
+		}
+		i++
+	}
+	return append(b, '"')
+}
+func appendJsonByteString(b []byte, v []byte) []byte {
+	return appendJsonString(b, nem12.ParseByteString(v))
+}
+func appendJsonDate(b []byte, t *time.Time) []byte {
+	if t == nil {
+		return append(b, "null"...)
+	}
+	b = append(b, '"')
+	b = t.AppendFormat(b, jsonDateLayout)
+	return append(b, '"')
+}
+func appendJsonTimestamp(b []byte, t *time.Time) []byte {
+	if t == nil {
+		return append(b, "null"...)
+	}
+	b = append(b, '"')
+	b = t.AppendFormat(b, jsonTimestampLayout)
+	b = append(b, jsonMarketTimeOffset...)
+	return append(b, '"')
+}
+
+// appendJsonLine appends one JSON object for a single interval reading, carrying its 200 context, 300/400 metadata and source.
+func appendJsonLine(b []byte, meterReadingsJob *MeterReadingsJob) ([]byte, error) {
+	consumption, err := nem12.ParseIntervalValue(meterReadingsJob.Consumption)
+	if err != nil {
+		return b, err
+	}
+
+	b = append(b, `{"nmi":`...)
+	b = appendJsonString(b, meterReadingsJob.Nmi)
+	b = append(b, `,"nmi_suffix":`...)
+	b = appendJsonString(b, meterReadingsJob.NmiSuffix)
+
+	if nmiDataDetails := meterReadingsJob.NmiDataDetails; nmiDataDetails != nil {
+		b = append(b, `,"nmi_configuration":`...)
+		b = appendJsonString(b, nmiDataDetails.NmiConfiguration)
+		b = append(b, `,"register_id":`...)
+		if nmiDataDetails.RegisterId != nil {
+			b = appendJsonByteString(b, nmiDataDetails.RegisterId[:])
+		} else {
+			b = append(b, "null"...)
+		}
+		b = append(b, `,"mdm_data_stream_identifier":`...)
+		if nmiDataDetails.MdmDataStreamIdentifier != nil {
+			b = appendJsonByteString(b, nmiDataDetails.MdmDataStreamIdentifier[:])
+		} else {
+			b = append(b, "null"...)
+		}
+		b = append(b, `,"meter_serial_number":`...)
+		if nmiDataDetails.MeterSerialNumber != nil {
+			b = appendJsonByteString(b, nmiDataDetails.MeterSerialNumber[:])
+		} else {
+			b = append(b, "null"...)
+		}
+		b = append(b, `,"uom":`...)
+		b = appendJsonByteString(b, nmiDataDetails.Uom[:])
+		b = append(b, `,"next_scheduled_read_date":`...)
+		b = appendJsonDate(b, nmiDataDetails.NextScheduledReadDate)
+	}
+
+	if intervalData := meterReadingsJob.IntervalData; intervalData != nil {
+		b = append(b, `,"interval_date":`...)
+		b = appendJsonDate(b, &intervalData.IntervalDate)
+	}
+	b = append(b, `,"interval_length":`...)
+	b = strconv.AppendInt(b, int64(meterReadingsJob.IntervalLength/time.Minute), 10)
+	b = append(b, `,"interval_number":`...)
+	b = strconv.AppendInt(b, int64(meterReadingsJob.IntervalNumber), 10)
+	b = append(b, `,"timestamp":`...)
+	b = appendJsonTimestamp(b, &meterReadingsJob.Timestamp)
+	b = append(b, `,"consumption":`...)
+	b = strconv.AppendFloat(b, consumption, 'f', -1, 64)
+	b = append(b, `,"quality_method":`...)
+	b = appendJsonString(b, meterReadingsJob.QualityMethod)
+
+	// Reason comes from the 400 record covering the interval, otherwise from the 300 record.
+	var reasonCode *[3]byte
+	var reasonDescription *string
+	if meterReadingsJob.IntervalEvent != nil {
+		reasonCode = meterReadingsJob.IntervalEvent.ReasonCode
+		reasonDescription = meterReadingsJob.IntervalEvent.ReasonDescription
+	} else if meterReadingsJob.IntervalData != nil {
+		reasonCode = meterReadingsJob.IntervalData.ReasonCode
+		reasonDescription = meterReadingsJob.IntervalData.ReasonDescription
+	}
+	b = append(b, `,"reason_code":`...)
+	if reasonCode != nil {
+		b = appendJsonByteString(b, reasonCode[:])
+	} else {
+		b = append(b, "null"...)
+	}
+	b = append(b, `,"reason_description":`...)
+	if reasonDescription != nil {
+		b = appendJsonString(b, *reasonDescription)
+	} else {
+		b = append(b, "null"...)
+	}
+
+	if intervalData := meterReadingsJob.IntervalData; intervalData != nil {
+		b = append(b, `,"update_datetime":`...)
+		b = appendJsonTimestamp(b, intervalData.UpdateDateTime)
+		b = append(b, `,"msats_load_datetime":`...)
+		b = appendJsonTimestamp(b, intervalData.MsatsLoadDateTime)
+	}
+
+	if source := meterReadingsJob.Source; source != nil {
+		b = append(b, `,"source":{"file":`...)
+		b = appendJsonString(b, source.Name)
+		b = append(b, `,"line":`...)
+		b = strconv.AppendInt(b, int64(meterReadingsJob.LineNumber), 10)
+		if header := source.Header; header != nil {
+			b = append(b, `,"version_header":`...)
+			b = appendJsonByteString(b, header.VersionHeader[:])
+			b = append(b, `,"datetime":`...)
+			b = appendJsonTimestamp(b, &header.DateTime)
+			b = append(b, `,"from_participant":`...)
+			b = appendJsonByteString(b, header.FromParticipant[:])
+			b = append(b, `,"to_participant":`...)
+			b = appendJsonByteString(b, header.ToParticipant[:])
+		}
+		b = append(b, '}')
+	}
+
+	return append(b, '}', '\n'), nil
+}
+func writeJsonLines(writer *bufio.Writer, meterReadingsJob []*MeterReadingsJob) error {
+	defer writer.Flush()
+
+	line := make([]byte, 0, 1024)
+	for i := range meterReadingsJob {
+		var err error
+		line, err = appendJsonLine(line[:0], meterReadingsJob[i])
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write(line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// appendJsonDecimal appends a decimal number checked by checkIndexRead as a JSON number, without the leading zeros JSON does not allow.
+func appendJsonDecimal(b []byte, decimal string) []byte {
+	if decimal[0] == '-' {
+		b = append(b, '-')
+		decimal = decimal[1:]
+	}
+	for len(decimal) > 1 && decimal[0] == '0' && decimal[1] != '.' {
+		decimal = decimal[1:]
+	}
+	return append(b, decimal...)
+}
+
+// appendB2bJsonLine appends one JSON object for a 500 record, carrying its channel, the IntervalDate of its 300 record and source. Its IndexRead must have been checked by checkB2bDetails.
+func appendB2bJsonLine(b []byte, b2bDetailsJob *B2bDetailsJob) []byte {
+	b2bDetails := b2bDetailsJob.B2bDetails
+
+	b = append(b, `{"nmi":`...)
+	b = appendJsonString(b, b2bDetailsJob.Nmi)
+	b = append(b, `,"nmi_suffix":`...)
+	b = appendJsonString(b, b2bDetailsJob.NmiSuffix)
+	b = append(b, `,"uom":`...)
+	b = appendJsonString(b, b2bDetailsJob.Uom)
+	b = append(b, `,"interval_date":`...)
+	b = appendJsonDate(b, &b2bDetailsJob.IntervalDate)
+	b = append(b, `,"trans_code":`...)
+	b = appendJsonByteString(b, b2bDetails.TransCode[:])
+	b = append(b, `,"ret_service_order":`...)
+	if b2bDetails.RetServiceOrder != nil {
+		b = appendJsonByteString(b, b2bDetails.RetServiceOrder[:])
+	} else {
+		b = append(b, "null"...)
+	}
+	b = append(b, `,"read_datetime":`...)
+	b = appendJsonTimestamp(b, b2bDetails.ReadDateTime)
+	b = append(b, `,"index_read":`...)
+	if b2bDetails.IndexRead != nil {
+		b = appendJsonDecimal(b, nem12.ParseByteString(b2bDetails.IndexRead[:]))
+	} else {
+		b = append(b, "null"...)
+	}
+
+	if source := b2bDetailsJob.Source; source != nil {
+		b = append(b, `,"source":{"file":`...)
+		b = appendJsonString(b, source.Name)
+		b = append(b, `,"line":`...)
+		b = strconv.AppendInt(b, int64(b2bDetailsJob.LineNumber), 10)
+		if header := source.Header; header != nil {
+			b = append(b, `,"version_header":`...)
+			b = appendJsonByteString(b, header.VersionHeader[:])
+			b = append(b, `,"datetime":`...)
+			b = appendJsonTimestamp(b, &header.DateTime)
+			b = append(b, `,"from_participant":`...)
+			b = appendJsonByteString(b, header.FromParticipant[:])
+			b = append(b, `,"to_participant":`...)
+			b = appendJsonByteString(b, header.ToParticipant[:])
+		}
+		b = append(b, '}')
+	}
+
+	return append(b, '}', '\n')
+}
+func writeB2bJsonLines(writer *bufio.Writer, b2bDetailsJob []*B2bDetailsJob) error {
+	if err := checkB2bDetails(b2bDetailsJob); err != nil {
+		return err
+	}
+	defer writer.Flush()
+
+	line := make([]byte, 0, 512)
+	for i := range b2bDetailsJob {
+		line = appendB2bJsonLine(line[:0], b2bDetailsJob[i])
+		if _, err := writer.Write(line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,252 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Cheejyg/Flo-Energy-Tech-Assessment/nem12"
+)
+
+const (
+	LedgerStatusLoading  string = "loading"
+	LedgerStatusLoaded   string = "loaded"
+	LedgerStatusFailed   string = "failed"
+	LedgerStatusSkipped  string = "skipped"
+	LedgerStatusRejected string = "rejected"
+)
+
+var ErrDuplicateFile = errors.New("file already loaded")
+var ErrMissingHeader = errors.New("missing 100 header record")
+
+// LedgerEntry records one attempt to load a NEM12 file. A file is identified by its 100 header record and the SHA-256 of its content.
+type LedgerEntry struct {
+	FromParticipant string    `json:"from_participant"`
+	ToParticipant   string    `json:"to_participant"`
+	DateTime        time.Time `json:"datetime"`
+	Sha256          string    `json:"sha256"`
+
+	File        string     `json:"file"`
+	Size        int64      `json:"size"`
+	Status      string     `json:"status"`
+	RowsWritten int64      `json:"rows_written"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// MarshalJSON writes DateTime, which is market time, with its offset.
+func (ledgerEntry LedgerEntry) MarshalJSON() ([]byte, error) {
+	type ledgerEntryJson LedgerEntry
+	return json.Marshal(struct {
+		ledgerEntryJson
+		DateTime string `json:"datetime"`
+	}{ledgerEntryJson(ledgerEntry), ledgerEntry.DateTime.Format(jsonTimestampLayout) + jsonMarketTimeOffset})
+}
+func (ledgerEntry *LedgerEntry) UnmarshalJSON(b []byte) error {
+	type ledgerEntryJson LedgerEntry
+	entry := struct {
+		*ledgerEntryJson
+		DateTime string `json:"datetime"`
+	}{ledgerEntryJson: (*ledgerEntryJson)(ledgerEntry)}
+	if err := json.Unmarshal(b, &entry); err != nil {
+		return err
+	}
+
+	// Only the wall clock is kept, so that entries written with a Z suffix before the offset was recorded still match.
+	datetime, err := time.Parse(time.RFC3339, entry.DateTime)
+	if err != nil {
+		return err
+	}
+	ledgerEntry.DateTime = time.Date(datetime.Year(), datetime.Month(), datetime.Day(), datetime.Hour(), datetime.Minute(), datetime.Second(), datetime.Nanosecond(), time.UTC)
+
+	return nil
+}
+func (ledgerEntry *LedgerEntry) Key() string {
+	return ledgerEntry.FromParticipant + "\x00" + ledgerEntry.ToParticipant + "\x00" + ledgerEntry.DateTime.Format(time.RFC3339) + "\x00" + ledgerEntry.Sha256
+}
+
+// Ledger is an append-only JSON Lines file of LedgerEntry, optionally mirrored as INSERT statements for the ingestion_ledger table (see ledger_PostgreSQL.sql).
+type Ledger struct {
+	file    *os.File
+	sqlFile *os.File
+	loaded  map[string]*LedgerEntry // Latest successful load of each file.
+}
+
+func OpenLedger(name string, sqlName string) (*Ledger, error) {
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	ledger := &Ledger{
+		file:   file,
+		loaded: make(map[string]*LedgerEntry, 64),
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 1<<12), 1<<20)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var ledgerEntry LedgerEntry
+		if err := json.Unmarshal(scanner.Bytes(), &ledgerEntry); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%s:%d: %w", name, lineNumber, err)
+		}
+		if ledgerEntry.Status == LedgerStatusLoaded {
+			ledger.loaded[ledgerEntry.Key()] = &ledgerEntry
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if sqlName != "" {
+		ledger.sqlFile, err = os.OpenFile(sqlName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	return ledger, nil
+}
+
+// Loaded returns the latest successful load of the same file as ledgerEntry, or nil.
+func (ledger *Ledger) Loaded(ledgerEntry *LedgerEntry) *LedgerEntry {
+	return ledger.loaded[ledgerEntry.Key()]
+}
+
+// Record appends a copy of ledgerEntry to the ledger.
+func (ledger *Ledger) Record(ledgerEntry *LedgerEntry) error {
+	b, err := json.Marshal(ledgerEntry)
+	if err != nil {
+		return err
+	}
+	if _, err := ledger.file.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if err := ledger.file.Sync(); err != nil {
+		return err
+	}
+
+	if ledgerEntry.Status == LedgerStatusLoaded {
+		entry := *ledgerEntry
+		ledger.loaded[entry.Key()] = &entry
+	}
+
+	// Only final statuses go to the database.
+	if ledger.sqlFile != nil && ledgerEntry.Status != LedgerStatusLoading {
+		if _, err := ledger.sqlFile.WriteString(generateLedgerInsertStatement(ledgerEntry)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ledger *Ledger) Close() error {
+	var err error
+	if ledger.sqlFile != nil {
+		err = ledger.sqlFile.Close()
+	}
+	return errors.Join(err, ledger.file.Close())
+}
+
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+func sqlTimestamp(t *time.Time) string {
+	if t == nil {
+		return "NULL"
+	}
+	return "'" + t.Format(sqlTimestampLayout) + "'"
+}
+
+func generateLedgerInsertStatement(ledgerEntry *LedgerEntry) string {
+	var stringBuilder strings.Builder
+	stringBuilder.Grow(512)
+
+	stringBuilder.WriteString("INSERT INTO ingestion_ledger (from_participant, to_participant, file_datetime, sha256, file, size, status, rows_written, started_at, finished_at, error) VALUES (")
+	stringBuilder.WriteString(sqlString(ledgerEntry.FromParticipant))
+	stringBuilder.WriteString(",")
+	stringBuilder.WriteString(sqlString(ledgerEntry.ToParticipant))
+	stringBuilder.WriteString(",")
+	stringBuilder.WriteString(sqlTimestamp(&ledgerEntry.DateTime))
+	stringBuilder.WriteString(",")
+	stringBuilder.WriteString(sqlString(ledgerEntry.Sha256))
+	stringBuilder.WriteString(",")
+	stringBuilder.WriteString(sqlString(ledgerEntry.File))
+	stringBuilder.WriteString(",")
+	stringBuilder.WriteString(strconv.FormatInt(ledgerEntry.Size, 10))
+	stringBuilder.WriteString(",")
+	stringBuilder.WriteString(sqlString(ledgerEntry.Status))
+	stringBuilder.WriteString(",")
+	stringBuilder.WriteString(strconv.FormatInt(ledgerEntry.RowsWritten, 10))
+	stringBuilder.WriteString(",")
+	stringBuilder.WriteString(sqlTimestamp(&ledgerEntry.StartedAt))
+	stringBuilder.WriteString(",")
+	stringBuilder.WriteString(sqlTimestamp(ledgerEntry.FinishedAt))
+	stringBuilder.WriteString(",")
+	if ledgerEntry.Error != "" {
+		stringBuilder.WriteString(sqlString(ledgerEntry.Error))
+	} else {
+		stringBuilder.WriteString("NULL")
+	}
+	stringBuilder.WriteString(");\n")
+
+	return stringBuilder.String()
+}
+
+// NewLedgerEntry identifies file by its 100 header record and content hash, leaving it positioned at the start.
+func NewLedgerEntry(file *os.File, name string) (*LedgerEntry, error) {
+	headerLine, err := bufio.NewReader(file).ReadSlice('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if !bytes.HasPrefix(headerLine, nem12.RecordIndicatorHeaderBytes) {
+		return nil, fmt.Errorf("%w: %s", ErrMissingHeader, name)
+	}
+	record := lineSplit(&headerLine, COMMA, nil)
+	if len(record) < 5 {
+		return nil, fmt.Errorf("%w: %s", nem12.ErrInvalidHeaderRecord, name)
+	}
+	headerRecord, err := nem12.ParseHeaderRecord(record)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return &LedgerEntry{
+		FromParticipant: nem12.ParseByteString(headerRecord.FromParticipant[:]),
+		ToParticipant:   nem12.ParseByteString(headerRecord.ToParticipant[:]),
+		DateTime:        headerRecord.DateTime,
+		Sha256:          fmt.Sprintf("%x", hash.Sum(nil)),
+		File:            name,
+		Size:            size,
+	}, nil
+}
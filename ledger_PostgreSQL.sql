@@ -0,0 +1,20 @@
+-- Ingestion ledger, loaded from the -ledger-sql script.
+
+CREATE TABLE IF NOT EXISTS ingestion_ledger (
+    id SERIAL PRIMARY KEY,
+    from_participant VARCHAR(10) NOT NULL,
+    to_participant VARCHAR(10) NOT NULL,
+    file_datetime TIMESTAMP NOT NULL,
+    sha256 CHAR(64) NOT NULL,
+    file TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    rows_written BIGINT NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP,
+    error TEXT
+);
+
+-- Files are identified by their 100 header record and content hash; -force may load one more than once.
+CREATE INDEX IF NOT EXISTS ingestion_ledger_file
+    ON ingestion_ledger (from_participant, to_participant, file_datetime, sha256);
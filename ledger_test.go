@@ -0,0 +1,136 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Cheejyg/Flo-Energy-Tech-Assessment/nem12"
+)
+
+func openTestFile(t *testing.T, content string) *os.File {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "test.csv")
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	return file
+}
+
+func TestNewLedgerEntry(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     error
+	}{
+		{"header", testNem12(testHeaderLine, "900"), nil},
+		{"header without a newline", testHeaderLine, nil},
+		{"300 first", "300,20050301\n", ErrMissingHeader},
+		{"empty", "", ErrMissingHeader},
+		{"bare 100", "100", nem12.ErrInvalidHeaderRecord},
+		{"bad datetime", "100,NEM12,2005060811,UNITEDDP,NEMMCO\n", nem12.ErrInvalidDateTime},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ledgerEntry, err := NewLedgerEntry(openTestFile(t, test.content), "test.csv")
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got %v, want %v", err, test.err)
+			}
+			if err != nil {
+				return
+			}
+			if ledgerEntry.FromParticipant != "UNITEDDP" || ledgerEntry.ToParticipant != "NEMMCO" || !ledgerEntry.DateTime.Equal(time.Date(2005, 6, 8, 11, 49, 0, 0, time.UTC)) {
+				t.Errorf("got %+v", ledgerEntry)
+			}
+			if ledgerEntry.Size != int64(len(test.content)) || len(ledgerEntry.Sha256) != 64 {
+				t.Errorf("got size %d and SHA-256 %q", ledgerEntry.Size, ledgerEntry.Sha256)
+			}
+		})
+	}
+}
+
+func TestLedger(t *testing.T) {
+	dir := t.TempDir()
+	name, sqlName := filepath.Join(dir, "ledger.jsonl"), filepath.Join(dir, "ledger.sql")
+
+	ledgerEntry, err := NewLedgerEntry(openTestFile(t, testNem12(testHeaderLine, "900")), "a.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := *ledgerEntry
+	other.Sha256 = strings.Repeat("0", 64)
+
+	ledger, err := OpenLedger(name, sqlName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range []string{LedgerStatusLoading, LedgerStatusFailed} {
+		ledgerEntry.Status = status
+		if err := ledger.Record(ledgerEntry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if loaded := ledger.Loaded(ledgerEntry); loaded != nil {
+		t.Errorf("a failed load counts as loaded: %+v", loaded)
+	}
+	ledgerEntry.Status, ledgerEntry.RowsWritten = LedgerStatusLoaded, 96
+	if err := ledger.Record(ledgerEntry); err != nil {
+		t.Fatal(err)
+	}
+	if err := ledger.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopened, the ledger still knows the file, but not one with other content.
+	ledger, err = OpenLedger(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ledger.Close()
+	if loaded := ledger.Loaded(ledgerEntry); loaded == nil || loaded.RowsWritten != 96 {
+		t.Errorf("got %+v, want the load of 96 rows", loaded)
+	}
+	if loaded := ledger.Loaded(&other); loaded != nil {
+		t.Errorf("got %+v for other content", loaded)
+	}
+
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(b), "\n"); lines != 3 || !strings.Contains(string(b), `"datetime":"2005-06-08T11:49:00+10:00"`) {
+		t.Errorf("got ledger\n%s", b)
+	}
+	// The loading status is not final, so it is not written to the database.
+	if b, err := os.ReadFile(sqlName); err != nil || strings.Count(string(b), "INSERT INTO ingestion_ledger") != 2 {
+		t.Errorf("got SQL %s, %v", b, err)
+	}
+}
+
+// TestLedgerUtcEntry reads an entry written with a Z suffix before DateTime was written with its offset.
+func TestLedgerUtcEntry(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "ledger.jsonl")
+	entry := `{"from_participant":"UNITEDDP","to_participant":"NEMMCO","datetime":"2005-06-08T11:49:00Z","sha256":"abc","file":"a.csv","size":1,"status":"loaded","rows_written":1,"started_at":"2025-01-01T00:00:00Z"}` + "\n"
+	if err := os.WriteFile(name, []byte(entry), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ledger, err := OpenLedger(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ledger.Close()
+
+	if ledger.Loaded(&LedgerEntry{FromParticipant: "UNITEDDP", ToParticipant: "NEMMCO", DateTime: time.Date(2005, 6, 8, 11, 49, 0, 0, time.UTC), Sha256: "abc"}) == nil {
+		t.Error("the entry does not match its file")
+	}
+}
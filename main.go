@@ -5,6 +5,9 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"errors"
+	"flag"
+	"fmt"
 	"io"
 	"log"
 	"os"
@@ -19,18 +22,76 @@ const COMMA = ','
 const sqlInsertBatchSize int = 16_384
 const sqlTimestampLayout string = "2006-01-02 15:04:05" // YYYY-MM-DD HH:MM:SS
 
+// NEM12 dates and times are in market time (AEST, UTC+10), which has no daylight saving.
+const marketTimeOffset time.Duration = 10 * time.Hour
+
 var sep []byte = []byte{COMMA}
 
+type SourceFile struct {
+	Name   string
+	Header *nem12.HeaderRecord
+}
 type MeterReadingsJob struct {
-	Nmi         string
-	Timestamp   time.Time
-	Consumption []byte
+	Nmi            string
+	NmiSuffix      string
+	Uom            string
+	Timestamp      time.Time
+	Consumption    []byte
+	QualityMethod  string
+	IntervalLength time.Duration
+	IntervalNumber int // 1-based position of the interval within its IntervalDate.
+
+	NmiDataDetails *nem12.NmiDataDetailsRecord
+	IntervalData   *nem12.IntervalDataRecord
+	IntervalEvent  *nem12.IntervalEventRecord // 400 record covering this interval, if any.
+	Source         *SourceFile
+	LineNumber     int // Line of the 300 record in Source.
+}
+
+// B2bDetailsJob is a 500 record, with the channel and IntervalDate of the 300 record it follows.
+type B2bDetailsJob struct {
+	Nmi           string
+	NmiSuffix     string
+	Uom           string
+	IntervalDate  time.Time
+	QualityMethod string // Of the 300 record.
+
+	B2bDetails *nem12.B2bDetailsRecord
+	Source     *SourceFile
+	LineNumber int // Line of the 500 record in Source.
 }
 type IntervalDataJob struct {
 	Nmi            string
+	NmiSuffix      string
+	Uom            string
 	IntervalDate   time.Time
 	IntervalLength time.Duration
 	IntervalValue  [][]byte
+	QualityMethod  []string
+
+	NmiDataDetails *nem12.NmiDataDetailsRecord
+	IntervalData   *nem12.IntervalDataRecord
+	IntervalEvent  []*nem12.IntervalEventRecord
+	Source         *SourceFile
+	LineNumber     int
+}
+type ProcessLineState struct {
+	Nmi            string
+	NmiSuffix      string
+	Uom            string
+	IntervalLength int
+	NmiDataDetails *nem12.NmiDataDetailsRecord
+	IntervalData   *IntervalDataJob // Pending 300 record, held back until its 400 and 500 records have been read.
+	Source         *SourceFile
+	LineNumber     int
+	Offset         int64 // Byte offset of the current line in Source.
+	EndOfData      bool  // Whether the 900 record has been read.
+	Pipeline       *Pipeline
+
+	NmiDataDetailsOffset     int64 // Byte offset of the current 200 record.
+	NmiDataDetailsLineNumber int
+	NmiDataDetailsRows       int64 // Rows produced since the current 200 record.
+	SkipRows                 int64 // Rows still to be skipped when resuming.
 }
 
 func generateInsertStatement(meterReadingsJob *MeterReadingsJob) string {
@@ -110,29 +171,238 @@ func writeCopyStatements(writer *bufio.Writer, meterReadingsJob []*MeterReadings
 	writer.WriteString("\n")
 }
 
-var sqlInsertBufferedWriter *bufio.Writer
-var sqlCopyBufferedWriter *bufio.Writer
-var sqlInsertBatch []*MeterReadingsJob = make([]*MeterReadingsJob, 0, sqlInsertBatchSize)
+var ErrInvalidIndexRead = errors.New("invalid index read, want a decimal number")
+
+// checkIndexRead checks that an IndexRead is a plain decimal number, e.g. 12345.6, 007 or -0.5, which every sink writes as it is read: unquoted in SQL and CSV, and as a JSON number.
+func checkIndexRead(indexRead string) error {
+	whole, fraction, hasFraction := strings.Cut(strings.TrimPrefix(indexRead, "-"), ".")
+	if whole == "" || (hasFraction && fraction == "") || strings.Trim(whole, "0123456789") != "" || strings.Trim(fraction, "0123456789") != "" {
+		return fmt.Errorf("%w: %q", ErrInvalidIndexRead, indexRead)
+	}
+	return nil
+}
+
+// checkB2bDetails checks every IndexRead before anything of the batch is written.
+func checkB2bDetails(b2bDetailsJob []*B2bDetailsJob) error {
+	for i := range b2bDetailsJob {
+		if b2bDetailsJob[i].B2bDetails.IndexRead == nil {
+			continue
+		}
+		if err := checkIndexRead(nem12.ParseByteString(b2bDetailsJob[i].B2bDetails.IndexRead[:])); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeB2bInsertStatements(writer *bufio.Writer, b2bDetailsJob []*B2bDetailsJob) error {
+	if err := checkB2bDetails(b2bDetailsJob); err != nil {
+		return err
+	}
+	defer writer.Flush()
+
+	writer.WriteString("INSERT INTO b2b_details (nmi, nmi_suffix, uom, interval_date, trans_code, ret_service_order, read_datetime, index_read)\n  VALUES\n")
+
+	for i := range b2bDetailsJob {
+		b2bDetails := b2bDetailsJob[i].B2bDetails
+		writer.WriteString("    (")
+		writer.WriteString(sqlString(b2bDetailsJob[i].Nmi))
+		writer.WriteByte(',')
+		writer.WriteString(sqlString(b2bDetailsJob[i].NmiSuffix))
+		writer.WriteByte(',')
+		writer.WriteString(sqlString(b2bDetailsJob[i].Uom))
+		writer.WriteString(",'")
+		writer.WriteString(b2bDetailsJob[i].IntervalDate.Format(jsonDateLayout))
+		writer.WriteString("',")
+		writer.WriteString(sqlString(nem12.ParseByteString(b2bDetails.TransCode[:])))
+		writer.WriteByte(',')
+		if b2bDetails.RetServiceOrder != nil {
+			writer.WriteString(sqlString(nem12.ParseByteString(b2bDetails.RetServiceOrder[:])))
+		} else {
+			writer.WriteString("NULL")
+		}
+		writer.WriteByte(',')
+		writer.WriteString(sqlTimestamp(b2bDetails.ReadDateTime))
+		writer.WriteByte(',')
+		if b2bDetails.IndexRead != nil {
+			writer.WriteString(nem12.ParseByteString(b2bDetails.IndexRead[:]))
+		} else {
+			writer.WriteString("NULL")
+		}
+		if i < len(b2bDetailsJob)-1 {
+			writer.WriteString("),\n")
+		}
+	}
+
+	writer.WriteString(");\n")
+
+	return nil
+}
+func writeB2bCopyStatements(writer *bufio.Writer, b2bDetailsJob []*B2bDetailsJob) error {
+	if err := checkB2bDetails(b2bDetailsJob); err != nil {
+		return err
+	}
+	defer writer.Flush()
+
+	for i := range b2bDetailsJob {
+		b2bDetails := b2bDetailsJob[i].B2bDetails
+		writer.WriteString(csvQuote(b2bDetailsJob[i].Nmi))
+		writer.WriteByte(',')
+		writer.WriteString(csvQuote(b2bDetailsJob[i].NmiSuffix))
+		writer.WriteByte(',')
+		writer.WriteString(csvQuote(b2bDetailsJob[i].Uom))
+		writer.WriteByte(',')
+		writer.WriteString(b2bDetailsJob[i].IntervalDate.Format(jsonDateLayout))
+		writer.WriteByte(',')
+		writer.WriteString(csvQuote(nem12.ParseByteString(b2bDetails.TransCode[:])))
+		writer.WriteByte(',')
+		if b2bDetails.RetServiceOrder != nil {
+			writer.WriteString(csvQuote(nem12.ParseByteString(b2bDetails.RetServiceOrder[:])))
+		}
+		writer.WriteByte(',')
+		if b2bDetails.ReadDateTime != nil {
+			writer.WriteString(b2bDetails.ReadDateTime.Format(sqlTimestampLayout))
+		}
+		writer.WriteByte(',')
+		if b2bDetails.IndexRead != nil {
+			writer.WriteString(csvQuote(nem12.ParseByteString(b2bDetails.IndexRead[:])))
+		}
+		writer.WriteByte('\n')
+	}
+
+	return nil
+}
+
+// Pipeline collects meter readings into batches of BatchSize and writes each batch to Sink, with the 500 records read since the last batch if Sink is a B2bDetailsSink.
+type Pipeline struct {
+	Sink       Sink
+	BatchSize  int
+	Rows       int64        // Rows written to Sink.
+	AfterFlush func() error // Called after each batch has been written and flushed, e.g. to checkpoint.
+	batch      []*MeterReadingsJob
+	b2bDetails []*B2bDetailsJob
+}
+
+func NewPipeline(sink Sink, batchSize int) *Pipeline {
+	return &Pipeline{
+		Sink:      sink,
+		BatchSize: batchSize,
+		batch:     make([]*MeterReadingsJob, 0, batchSize),
+	}
+}
+func (pipeline *Pipeline) Write(meterReadingsJob *MeterReadingsJob) error {
+	pipeline.batch = append(pipeline.batch, meterReadingsJob)
+
+	if len(pipeline.batch) >= pipeline.BatchSize {
+		return pipeline.Flush()
+	}
+
+	return nil
+}
+
+// WriteB2bDetails queues a 500 record to be written with the next batch. It does not start a batch of its own.
+func (pipeline *Pipeline) WriteB2bDetails(b2bDetailsJob *B2bDetailsJob) {
+	pipeline.b2bDetails = append(pipeline.b2bDetails, b2bDetailsJob)
+}
+func (pipeline *Pipeline) Flush() error {
+	if len(pipeline.batch) == 0 && len(pipeline.b2bDetails) == 0 {
+		return pipeline.Sink.Flush()
+	}
+
+	if len(pipeline.b2bDetails) > 0 {
+		if err := writeB2bDetails(pipeline.Sink, pipeline.b2bDetails); err != nil {
+			return err
+		}
+		pipeline.b2bDetails = pipeline.b2bDetails[:0]
+	}
+	if len(pipeline.batch) > 0 {
+		if err := pipeline.Sink.WriteBatch(pipeline.batch); err != nil {
+			return err
+		}
+		pipeline.Rows += int64(len(pipeline.batch))
+		pipeline.batch = pipeline.batch[:0]
+	}
+
+	if err := pipeline.Sink.Flush(); err != nil {
+		return err
+	}
+	if pipeline.AfterFlush != nil {
+		return pipeline.AfterFlush()
+	}
+
+	return nil
+}
+func (pipeline *Pipeline) Close() error {
+	err := pipeline.Flush()
+	return errors.Join(err, pipeline.Sink.Close())
+}
+
+func processMeterReadings(state *ProcessLineState, intervalDataJob *IntervalDataJob, timestamp *time.Time, i int) error {
+	state.NmiDataDetailsRows++
+	if state.SkipRows > 0 {
+		// Already written before the load was interrupted.
+		state.SkipRows--
+		return nil
+	}
 
-func processMeterReadings(nmi *string, timestamp *time.Time, consumption []byte) {
-	sqlInsertBatch = append(sqlInsertBatch, &MeterReadingsJob{
-		Nmi:         *nmi,
-		Timestamp:   *timestamp,
-		Consumption: consumption,
+	return state.Pipeline.Write(&MeterReadingsJob{
+		Nmi:           intervalDataJob.Nmi,
+		NmiSuffix:     intervalDataJob.NmiSuffix,
+		Uom:           intervalDataJob.Uom,
+		Timestamp:     *timestamp,
+		Consumption:   intervalDataJob.IntervalValue[i],
+		QualityMethod: intervalDataJob.QualityMethod[i],
+
+		IntervalLength: intervalDataJob.IntervalLength,
+		IntervalNumber: i + 1,
+		NmiDataDetails: intervalDataJob.NmiDataDetails,
+		IntervalData:   intervalDataJob.IntervalData,
+		IntervalEvent:  intervalDataJob.IntervalEvent[i],
+		Source:         intervalDataJob.Source,
+		LineNumber:     intervalDataJob.LineNumber,
 	})
+}
+func processIntervalData(state *ProcessLineState, intervalDataJob *IntervalDataJob) error {
+	timestamp := intervalDataJob.IntervalDate.Add(intervalDataJob.IntervalLength)
+	for i := range intervalDataJob.IntervalValue {
+		if err := processMeterReadings(state, intervalDataJob, &timestamp, i); err != nil {
+			return err
+		}
+		timestamp = timestamp.Add(intervalDataJob.IntervalLength)
+	}
+
+	return nil
+}
+func processIntervalEvent(intervalDataJob *IntervalDataJob, intervalEventRecord *nem12.IntervalEventRecord) error {
+	startInterval, err := strconv.Atoi(nem12.ParseByteString(intervalEventRecord.StartInterval[:]))
+	if err != nil {
+		return nem12.ErrInvalidIntervalEventRecord
+	}
+	endInterval, err := strconv.Atoi(nem12.ParseByteString(intervalEventRecord.EndInterval[:]))
+	if err != nil {
+		return nem12.ErrInvalidIntervalEventRecord
+	}
+	if startInterval < 1 || endInterval < startInterval || endInterval > len(intervalDataJob.QualityMethod) {
+		return nem12.ErrInvalidIntervalEventRecord
+	}
 
-	if len(sqlInsertBatch) >= sqlInsertBatchSize {
-		writeInsertStatements(sqlInsertBufferedWriter, sqlInsertBatch)
-		writeCopyStatements(sqlCopyBufferedWriter, sqlInsertBatch)
-		sqlInsertBatch = sqlInsertBatch[:0]
+	qualityMethod := nem12.ParseByteString(intervalEventRecord.QualityMethod[:])
+	for i := startInterval - 1; i < endInterval; i++ {
+		intervalDataJob.QualityMethod[i] = qualityMethod
+		intervalDataJob.IntervalEvent[i] = intervalEventRecord
 	}
+
+	return nil
 }
-func processIntervalData(nmi *string, intervalDate *time.Time, intervalLength time.Duration, intervalValue *[][]byte) {
-	timestamp := intervalDate.Add(intervalLength)
-	for i := range *intervalValue {
-		processMeterReadings(nmi, &timestamp, (*intervalValue)[i])
-		timestamp = timestamp.Add(intervalLength)
+func flushIntervalData(state *ProcessLineState) error {
+	if state.IntervalData == nil {
+		return nil
 	}
+
+	intervalDataJob := state.IntervalData
+	state.IntervalData = nil
+	return processIntervalData(state, intervalDataJob)
 }
 func lineSplit(line *[]byte, sep byte, intervalLength *int) (record [][]byte) {
 	if len(*line) < 3 {
@@ -145,7 +415,7 @@ func lineSplit(line *[]byte, sep byte, intervalLength *int) (record [][]byte) {
 	case bytes.Equal((*line)[0:3], nem12.RecordIndicatorNmiDataDetailsBytes):
 		record = make([][]byte, 1, 3)
 	case bytes.Equal((*line)[0:3], nem12.RecordIndicatorIntervalDataBytes):
-		record = make([][]byte, 1, 7 + 1440 / *intervalLength)
+		record = make([][]byte, 1, 7+1440/max(*intervalLength, 1))
 	case bytes.Equal((*line)[0:3], nem12.RecordIndicatorIntervalEventBytes):
 		record = make([][]byte, 1, 4)
 	case bytes.Equal((*line)[0:3], nem12.RecordIndicatorB2bDetailsBytes):
@@ -159,8 +429,9 @@ func lineSplit(line *[]byte, sep byte, intervalLength *int) (record [][]byte) {
 
 	record[0] = (*line)[0:3]
 
+	// A bare record indicator, e.g. a truncated last line, splits into an empty field, which the caller rejects as too short.
 	var left, right int
-	for left, right = 4, 4; right < len(*line); right++ {
+	for left, right = min(4, len(*line)), min(4, len(*line)); right < len(*line); right++ {
 		if (*line)[right] == sep {
 			record = append(record, (*line)[left:right])
 			left = right + 1
@@ -171,95 +442,153 @@ func lineSplit(line *[]byte, sep byte, intervalLength *int) (record [][]byte) {
 
 	return
 }
-func processLine(line []byte, nmi *string, intervalLength *int) {
+func processLine(line []byte, state *ProcessLineState) error {
+	state.LineNumber++
 	if len(line) < 1 {
-		return
+		return nil
+	}
+
+	if bytes.HasPrefix(line, nem12.RecordIndicatorIntervalDataBytes) {
+		// Interval values outlive the reader's buffer until their batch has been written.
+		line = bytes.Clone(line)
+	}
+
+	record := lineSplit(&line, COMMA, &state.IntervalLength)
+	if len(record) == 0 {
+		return nil
+	}
+	if !bytes.Equal(record[0], nem12.RecordIndicatorIntervalEventBytes) && !bytes.Equal(record[0], nem12.RecordIndicatorB2bDetailsBytes) {
+		if err := flushIntervalData(state); err != nil {
+			return err
+		}
 	}
 
-	record := lineSplit(&line, COMMA, intervalLength)
 	switch {
 	case bytes.Equal(record[0], nem12.RecordIndicatorHeaderBytes):
-		break
+		if len(record) < 5 {
+			return nem12.ErrInvalidHeaderRecord
+		}
+		headerRecord, err := nem12.ParseHeaderRecord(record)
+		if err != nil {
+			return err
+		}
+
+		if state.Source == nil {
+			state.Source = &SourceFile{}
+		}
+		state.Source.Header = headerRecord
 	case bytes.Equal(record[0], nem12.RecordIndicatorNmiDataDetailsBytes):
+		if len(record) < 9 {
+			return nem12.ErrInvalidNmiDataDetailsRecord
+		}
 		nmiDataDetailsRecord, err := nem12.ParseNmiDataDetailsRecord(record)
 		if err != nil {
-			log.Fatalln(err)
-			return
+			return err
 		}
 
-		*nmi = nem12.ParseByteString(nmiDataDetailsRecord.Nmi[:])
+		state.NmiDataDetails = nmiDataDetailsRecord
+		state.NmiDataDetailsOffset = state.Offset
+		state.NmiDataDetailsLineNumber = state.LineNumber
+		state.NmiDataDetailsRows = 0
+		state.Nmi = nem12.ParseByteString(nmiDataDetailsRecord.Nmi[:])
+		state.NmiSuffix = nem12.ParseByteString(nmiDataDetailsRecord.NmiSuffix[:])
+		state.Uom = nem12.ParseByteString(nmiDataDetailsRecord.Uom[:])
 
 		i, err := strconv.Atoi(nem12.ParseByteString(nmiDataDetailsRecord.IntervalLength[:]))
-		if err != nil {
-			log.Fatalln(err)
-			return
+		if err != nil || i <= 0 || 1440%i != 0 {
+			return nem12.ErrInvalidNmiDataDetailsRecord
 		}
-		*intervalLength = i
+		state.IntervalLength = i
 	case bytes.Equal(record[0], nem12.RecordIndicatorIntervalDataBytes):
-		intervalDataRecord, err := nem12.ParseIntervalDataRecord(record, *intervalLength)
+		if state.NmiDataDetails == nil {
+			return ErrUnexpectedRecord
+		}
+		if len(record) < 3+1440/state.IntervalLength {
+			return nem12.ErrInvalidIntervalDataRecord
+		}
+		intervalDataRecord, err := nem12.ParseIntervalDataRecord(record, state.IntervalLength)
 		if err != nil {
-			log.Fatalln(err)
-			return
+			return err
 		}
 
-		processIntervalData(nmi, &intervalDataRecord.IntervalDate, time.Duration(*intervalLength)*time.Minute, &intervalDataRecord.IntervalValue)
+		qualityMethod := make([]string, len(intervalDataRecord.IntervalValue))
+		qualityMethod[0] = nem12.ParseByteString(intervalDataRecord.QualityMethod[:])
+		for i := 1; i < len(qualityMethod); i++ {
+			qualityMethod[i] = qualityMethod[0]
+		}
+
+		state.IntervalData = &IntervalDataJob{
+			Nmi:            state.Nmi,
+			NmiSuffix:      state.NmiSuffix,
+			Uom:            state.Uom,
+			IntervalDate:   intervalDataRecord.IntervalDate,
+			IntervalLength: time.Duration(state.IntervalLength) * time.Minute,
+			IntervalValue:  intervalDataRecord.IntervalValue,
+			QualityMethod:  qualityMethod,
+
+			NmiDataDetails: state.NmiDataDetails,
+			IntervalData:   intervalDataRecord,
+			IntervalEvent:  make([]*nem12.IntervalEventRecord, len(intervalDataRecord.IntervalValue)),
+			Source:         state.Source,
+			LineNumber:     state.LineNumber,
+		}
 	case bytes.Equal(record[0], nem12.RecordIndicatorIntervalEventBytes):
-		break
+		if len(record) < 6 {
+			return nem12.ErrInvalidIntervalEventRecord
+		}
+		intervalEventRecord, err := nem12.ParseIntervalEventRecord(record)
+		if err != nil {
+			return err
+		}
+		if state.IntervalData == nil {
+			return nem12.ErrInvalidIntervalEventRecord
+		}
+
+		if err := processIntervalEvent(state.IntervalData, intervalEventRecord); err != nil {
+			return err
+		}
 	case bytes.Equal(record[0], nem12.RecordIndicatorB2bDetailsBytes):
-		break
+		if len(record) < 2 {
+			return nem12.ErrInvalidB2bDetailsRecord
+		}
+		b2bDetailsRecord, err := nem12.ParseB2bDetailsRecord(record)
+		if err != nil {
+			return err
+		}
+		if state.IntervalData == nil {
+			return nem12.ErrInvalidB2bDetailsRecord
+		}
+
+		// Queued ahead of its day's readings, so it was written with them if they are skipped on resume.
+		if state.SkipRows > 0 {
+			break
+		}
+		state.Pipeline.WriteB2bDetails(&B2bDetailsJob{
+			Nmi:           state.Nmi,
+			NmiSuffix:     state.NmiSuffix,
+			Uom:           state.Uom,
+			IntervalDate:  state.IntervalData.IntervalDate,
+			QualityMethod: nem12.ParseByteString(state.IntervalData.IntervalData.QualityMethod[:]),
+
+			B2bDetails: b2bDetailsRecord,
+			Source:     state.Source,
+			LineNumber: state.LineNumber,
+		})
 	case bytes.Equal(record[0], nem12.RecordIndicatorEndOfDataBytes):
-		return
+		state.EndOfData = true
+		return nil
 	default:
 		break
 	}
-}
-
-func main() {
-	name := "NEM12#200506081149#UNITEDDP#NEMMCO.csv"
-	nem12File, err := os.Open(name)
-	if err != nil {
-		log.Fatalln(err)
-		return
-	}
-	defer nem12File.Close()
-
-	sqlInsertFileName := strings.ReplaceAll(name, ".csv", "") + ".sql"
-	sqlCopyFileName := "meter_readings.sql.csv"
-
-	sqlInsertFile, err := os.Create(sqlInsertFileName)
-	if err != nil {
-		log.Fatalln(err)
-		return
-	}
-	defer sqlInsertFile.Close()
-
-	sqlCopyFile, err := os.Create(sqlCopyFileName)
-	if err != nil {
-		log.Fatalln(err)
-		return
-	}
-	defer sqlCopyFile.Close()
-
-	sqlInsertBufferedWriter = bufio.NewWriterSize(sqlInsertFile, 1<<27)
-	defer sqlInsertBufferedWriter.Flush()
 
-	sqlCopyBufferedWriter = bufio.NewWriterSize(sqlCopyFile, 1<<27)
-	defer sqlCopyBufferedWriter.Flush()
-
-	sqlInsertBatch = make([]*MeterReadingsJob, 0, sqlInsertBatchSize)
-	defer func() {
-		if len(sqlInsertBatch) > 0 {
-			writeInsertStatements(sqlInsertBufferedWriter, sqlInsertBatch)
-			writeCopyStatements(sqlCopyBufferedWriter, sqlInsertBatch)
-		}
-	}()
+	return nil
+}
 
-	bufferedReader := bufio.NewReaderSize(nem12File, 1<<20)
+func processNem12(reader io.Reader, state *ProcessLineState) error {
+	bufferedReader := bufio.NewReaderSize(reader, 1<<20)
 	var bufferedLine bytes.Buffer
 	bufferedLine.Grow(1 << 21)
 
-	var nmi string
-	var intervalLength int
 	for {
 		line, err := bufferedReader.ReadSlice('\n')
 		if err != nil {
@@ -269,13 +598,19 @@ func main() {
 			} else if err == io.EOF {
 				if bufferedLine.Len() > 0 {
 					bufferedLine.Write(line)
-					processLine(bufferedLine.Bytes(), &nmi, &intervalLength)
+					if err := processLine(bufferedLine.Bytes(), state); err != nil {
+						return err
+					}
+					state.Offset += int64(bufferedLine.Len())
 					// bufferedLine.Reset()
 				} else {
-					processLine(line, &nmi, &intervalLength)
+					if err := processLine(line, state); err != nil {
+						return err
+					}
+					state.Offset += int64(len(line))
 				}
 			} else {
-				log.Fatalln(err)
+				return err
 			}
 
 			break
@@ -283,10 +618,209 @@ func main() {
 
 		if bufferedLine.Len() > 0 {
 			bufferedLine.Write(line)
-			processLine(bufferedLine.Bytes(), &nmi, &intervalLength)
+			err = processLine(bufferedLine.Bytes(), state)
+			state.Offset += int64(bufferedLine.Len())
 			bufferedLine.Reset()
 		} else {
-			processLine(line, &nmi, &intervalLength)
+			err = processLine(line, state)
+			state.Offset += int64(len(line))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return flushIntervalData(state)
+}
+
+type sinkFlag []string
+
+func (sinkFlag *sinkFlag) String() string {
+	return strings.Join(*sinkFlag, " ")
+}
+func (sinkFlag *sinkFlag) Set(value string) error {
+	*sinkFlag = append(*sinkFlag, value)
+	return nil
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		var command func(args []string) error
+		switch os.Args[1] {
+		case "serve":
+			command = runServe
+		case "watch":
+			command = runWatch
+		case "query":
+			command = runQuery
+		case "diff":
+			command = runDiff
+		case "merge":
+			command = runMerge
+		case "split":
+			command = runSplit
+		case "generate":
+			command = runGenerate
+		case "redact":
+			command = runRedact
+		case "stats":
+			command = runStats
+		}
+		if command != nil {
+			if err := command(os.Args[2:]); err != nil {
+				log.Fatalln(err)
+			}
+			return
 		}
 	}
+
+	var sinkSpecs sinkFlag
+	flag.Var(&sinkSpecs, "sink", "write meter readings to `name:target?options`, may be repeated (default insert:<file>.sql and copy:meter_readings.sql.csv, and for b2b_details insert:<file>.b2b_details.sql and copy:b2b_details.sql.csv)")
+	checkpointName := flag.String("checkpoint", "", "write a checkpoint to `path` after each batch (default <file>.checkpoint)")
+	resume := flag.Bool("resume", false, "resume an interrupted load from its checkpoint")
+	ledgerName := flag.String("ledger", "", "record loaded files in the ledger at `path`, and skip or reject files already loaded")
+	ledgerSqlName := flag.String("ledger-sql", "", "also append ledger entries as INSERT statements for ingestion_ledger to `path`")
+	duplicates := flag.String("duplicates", "skip", "`skip` or `reject` files already in the ledger")
+	force := flag.Bool("force", false, "load files even if already in the ledger")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %[1]s [flags] [file]\n       %[1]s serve [flags]\n       %[1]s watch [flags] dir\n       %[1]s query [flags] dir\n       %[1]s diff [flags] old new\n       %[1]s merge [flags] file...\n       %[1]s split [flags] file...\n       %[1]s generate [flags]\n       %[1]s redact [flags] file...\n       %[1]s stats [flags] file...\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintf(flag.CommandLine.Output(), "Sinks: %s\n", strings.Join(SinkNames(), ", "))
+	}
+	flag.Parse()
+
+	name := "NEM12#200506081149#UNITEDDP#NEMMCO.csv"
+	if flag.NArg() > 0 {
+		name = flag.Arg(0)
+	}
+
+	nem12File, err := os.Open(name)
+	if err != nil {
+		log.Fatalln(err)
+		return
+	}
+	defer nem12File.Close()
+
+	nem12FileInfo, err := nem12File.Stat()
+	if err != nil {
+		log.Fatalln(err)
+		return
+	}
+
+	if *duplicates != "skip" && *duplicates != "reject" {
+		log.Fatalln("invalid -duplicates, want skip or reject:", *duplicates)
+		return
+	}
+
+	var ledger *Ledger
+	var ledgerEntry *LedgerEntry
+	if *ledgerName != "" {
+		ledgerEntry, err = NewLedgerEntry(nem12File, name)
+		if err != nil {
+			log.Fatalln(err)
+			return
+		}
+		ledger, err = OpenLedger(*ledgerName, *ledgerSqlName)
+		if err != nil {
+			log.Fatalln(err)
+			return
+		}
+
+		if loaded := ledger.Loaded(ledgerEntry); loaded != nil && !*force {
+			ledgerEntry.Status = LedgerStatusSkipped
+			if *duplicates == "reject" {
+				ledgerEntry.Status = LedgerStatusRejected
+			}
+			ledgerEntry.StartedAt = time.Now()
+			err := fmt.Errorf("%w: %s (as %s at %s)", ErrDuplicateFile, name, loaded.File, loaded.StartedAt.Format(time.RFC3339))
+			ledgerEntry.Error = err.Error()
+			if err := ledger.Record(ledgerEntry); err != nil {
+				log.Fatalln(err)
+				return
+			}
+
+			ledger.Close()
+			if *duplicates == "reject" {
+				log.Fatalln(err)
+				return
+			}
+			log.Println("skipped:", err)
+			return
+		}
+
+		ledgerEntry.Status = LedgerStatusLoading
+		ledgerEntry.StartedAt = time.Now()
+		if err := ledger.Record(ledgerEntry); err != nil {
+			log.Fatalln(err)
+			return
+		}
+	}
+
+	if *checkpointName == "" {
+		*checkpointName = name + ".checkpoint"
+	}
+	var checkpoint *Checkpoint
+	if *resume {
+		checkpoint, err = ReadCheckpoint(*checkpointName)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Fatalln(err)
+			return
+		}
+		if checkpoint != nil && len(sinkSpecs) == 0 {
+			sinkSpecs = checkpoint.Sinks
+		}
+	}
+
+	if len(sinkSpecs) == 0 {
+		sqlInsertFileName := strings.ReplaceAll(name, ".csv", "") + ".sql"
+		sqlCopyFileName := "meter_readings.sql.csv"
+		sqlB2bInsertFileName := strings.ReplaceAll(name, ".csv", "") + ".b2b_details.sql"
+		sqlB2bCopyFileName := "b2b_details.sql.csv"
+		sinkSpecs = sinkFlag{"insert:" + sqlInsertFileName, "copy:" + sqlCopyFileName, "insert:" + sqlB2bInsertFileName + "?table=b2b_details", "copy:" + sqlB2bCopyFileName + "?table=b2b_details"}
+	}
+
+	var outputs map[string]int64
+	if checkpoint != nil {
+		outputs = checkpoint.Outputs
+	}
+	sink, err := OpenSinks(sinkSpecs, outputs)
+	if err != nil {
+		log.Fatalln(err)
+		return
+	}
+
+	pipeline := NewPipeline(sink, sqlInsertBatchSize)
+	state := ProcessLineState{
+		Source:   &SourceFile{Name: name},
+		Pipeline: pipeline,
+	}
+	pipeline.AfterFlush = func() error {
+		return WriteCheckpoint(*checkpointName, NewCheckpoint(&state, nem12FileInfo.Size(), sinkSpecs))
+	}
+
+	if checkpoint != nil {
+		err = resumeNem12(nem12File, &state, checkpoint)
+	} else {
+		err = processNem12(nem12File, &state)
+	}
+	err = errors.Join(err, pipeline.Close())
+
+	if ledger != nil {
+		finishedAt := time.Now()
+		ledgerEntry.Status = LedgerStatusLoaded
+		ledgerEntry.RowsWritten = pipeline.Rows
+		ledgerEntry.FinishedAt = &finishedAt
+		if err != nil {
+			ledgerEntry.Status = LedgerStatusFailed
+			ledgerEntry.Error = err.Error()
+		}
+		err = errors.Join(err, ledger.Record(ledgerEntry), ledger.Close())
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if err := os.Remove(*checkpointName); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Fatalln(err)
+	}
 }
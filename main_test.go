@@ -0,0 +1,85 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheckIndexRead(t *testing.T) {
+	tests := []struct {
+		indexRead string
+		err       error
+	}{
+		{"12345.6", nil},
+		{"007", nil},
+		{"-0.5", nil},
+		{"0", nil},
+		{"", ErrInvalidIndexRead},
+		{"-", ErrInvalidIndexRead},
+		{".5", ErrInvalidIndexRead},
+		{"1.", ErrInvalidIndexRead},
+		{"1.2.3", ErrInvalidIndexRead},
+		{"+1", ErrInvalidIndexRead},
+		{"1e3", ErrInvalidIndexRead},
+		{"--1", ErrInvalidIndexRead},
+		{"1);DROP", ErrInvalidIndexRead},
+	}
+	for _, test := range tests {
+		if err := checkIndexRead(test.indexRead); !errors.Is(err, test.err) {
+			t.Errorf("checkIndexRead(%q) = %v, want %v", test.indexRead, err, test.err)
+		}
+	}
+}
+
+// TestB2bDetailsWriters writes IndexReads as they were read with every writer, and checks that a batch with an invalid IndexRead writes nothing.
+func TestB2bDetailsWriters(t *testing.T) {
+	file := func(indexRead string) []byte {
+		return []byte(testNem12(
+			testHeaderLine,
+			testBlockLine("NEM1201009", "E1"),
+			testDayLine("20050301", "1", ""),
+			"500,O,S01009,20050310121004,-0.5",
+			testDayLine("20050302", "1", ""),
+			"500,O,S01010,20050310121004,"+indexRead,
+			"900",
+		))
+	}
+	valid := loadTestNem12(t, file("00012345.60")).b2bDetails
+	invalid := loadTestNem12(t, file("12345.6x")).b2bDetails
+
+	writers := []struct {
+		name  string
+		write func(*bufio.Writer, []*B2bDetailsJob) error
+		want  []string
+	}{
+		{"insert", writeB2bInsertStatements, []string{",-0.5)", ",00012345.60);"}},
+		{"copy", writeB2bCopyStatements, []string{",-0.5\n", ",00012345.60\n"}},
+		{"jsonl", writeB2bJsonLines, []string{`"index_read":-0.5,`, `"index_read":12345.60,`}},
+	}
+	for _, writer := range writers {
+		t.Run(writer.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := writer.write(bufio.NewWriter(&b), valid); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range writer.want {
+				if !strings.Contains(b.String(), want) {
+					t.Errorf("got\n%s\nwant it to contain %q", b.String(), want)
+				}
+			}
+
+			b.Reset()
+			if err := writer.write(bufio.NewWriter(&b), invalid); !errors.Is(err, ErrInvalidIndexRead) {
+				t.Errorf("got %v, want %v", err, ErrInvalidIndexRead)
+			}
+			if b.Len() > 0 {
+				t.Errorf("wrote %q of a batch with an invalid IndexRead", b.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/Cheejyg/Flo-Energy-Tech-Assessment/nem12"
+)
+
+type mergeKey struct {
+	Nmi          string
+	NmiSuffix    string
+	IntervalDate time.Time
+}
+
+// mergeDay is the version of a day that wins so far, with the 200 record it was read under.
+type mergeDay struct {
+	BlockLine []byte
+	Day       *Nem12Day
+}
+
+// Nem12Merger merges the days of NEM12 files: for each NMI, suffix and IntervalDate, the 300 record with the newest UpdateDateTime wins, with its 400 and 500 records. Of versions equally new, or without an UpdateDateTime, the last added wins.
+type Nem12Merger struct {
+	Header *nem12.HeaderRecord // Of the first file added.
+
+	days map[mergeKey]*mergeDay
+}
+
+func NewNem12Merger() *Nem12Merger {
+	return &Nem12Merger{days: make(map[mergeKey]*mergeDay, 1024)}
+}
+
+func mergeUpdateDateTime(day *Nem12Day) time.Time {
+	if day.IntervalData.UpdateDateTime == nil {
+		return time.Time{}
+	}
+	return *day.IntervalData.UpdateDateTime
+}
+
+// Add reads a NEM12 file into the merge.
+func (merger *Nem12Merger) Add(reader io.Reader) error {
+	nem12Reader := NewNem12Reader(reader)
+	for {
+		block, err := nem12Reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		for _, day := range block.Days {
+			key := mergeKey{block.Nmi, block.NmiSuffix, day.IntervalData.IntervalDate}
+			if current := merger.days[key]; current != nil && mergeUpdateDateTime(day).Before(mergeUpdateDateTime(current.Day)) {
+				continue
+			}
+			merger.days[key] = &mergeDay{BlockLine: block.Line, Day: day}
+		}
+	}
+	if merger.Header == nil {
+		merger.Header = nem12Reader.Header
+	}
+
+	return nil
+}
+
+// WriteTo writes the merged days as one NEM12 file with the given 100 record, sorted by NMI, suffix and date. A 200 record is written before each channel's days, and again wherever the winning days were read under a different 200 record.
+func (merger *Nem12Merger) WriteTo(writer io.Writer, headerLine []byte) error {
+	keys := make([]mergeKey, 0, len(merger.days))
+	for key := range merger.days {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Nmi != keys[j].Nmi {
+			return keys[i].Nmi < keys[j].Nmi
+		}
+		if keys[i].NmiSuffix != keys[j].NmiSuffix {
+			return keys[i].NmiSuffix < keys[j].NmiSuffix
+		}
+		return keys[i].IntervalDate.Before(keys[j].IntervalDate)
+	})
+
+	nem12Writer, err := NewNem12Writer(writer, headerLine)
+	if err != nil {
+		return err
+	}
+	var block *Nem12Block
+	for i, key := range keys {
+		day := merger.days[key]
+		if block == nil || key.Nmi != keys[i-1].Nmi || key.NmiSuffix != keys[i-1].NmiSuffix || !bytes.Equal(day.BlockLine, block.Line) {
+			if block != nil {
+				if err := nem12Writer.WriteBlock(block); err != nil {
+					return err
+				}
+			}
+			block = &Nem12Block{Line: day.BlockLine}
+		}
+		block.Days = append(block.Days, day.Day)
+	}
+	if block != nil {
+		if err := nem12Writer.WriteBlock(block); err != nil {
+			return err
+		}
+	}
+
+	return nem12Writer.Close()
+}
+
+// runMerge runs the merge command: several NEM12 files, e.g. overlapping files from several MDPs and their resends, merged into one.
+func runMerge(args []string) error {
+	flagSet := flag.NewFlagSet("merge", flag.ExitOnError)
+	output := flagSet.String("o", "-", "write the merged file to `path`, - for stdout")
+	fromParticipant := flagSet.String("from", "", "FromParticipant of the merged file (default that of the first file)")
+	toParticipant := flagSet.String("to", "", "ToParticipant of the merged file (default that of the first file)")
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), "Usage: %s merge [flags] file...\n", os.Args[0])
+		flagSet.PrintDefaults()
+	}
+	flagSet.Parse(args)
+
+	if flagSet.NArg() == 0 {
+		flagSet.Usage()
+		os.Exit(2)
+	}
+
+	merger := NewNem12Merger()
+	for _, name := range flagSet.Args() {
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		err = merger.Add(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	if *fromParticipant == "" {
+		*fromParticipant = nem12.ParseByteString(merger.Header.FromParticipant[:])
+	}
+	if *toParticipant == "" {
+		*toParticipant = nem12.ParseByteString(merger.Header.ToParticipant[:])
+	}
+	headerLine := appendHeaderRecord(nil, time.Now().UTC().Add(marketTimeOffset), *fromParticipant, *toParticipant)
+
+	if *output == "-" {
+		return merger.WriteTo(os.Stdout, headerLine)
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	return errors.Join(merger.WriteTo(file, headerLine), file.Close())
+}
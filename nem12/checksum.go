@@ -0,0 +1,24 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package nem12
+
+// NmiAlphabet holds the characters allowed in an NMI: digits, and letters other than I and O.
+const NmiAlphabet = "0123456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+
+// NmiChecksum returns the checksum digit of a 10-character NMI, as specified in the AEMO National Metering Identifier Procedure: from the rightmost character, the ASCII value of every second character is doubled, the digits of all the values are summed, and the checksum is what brings the sum up to the next multiple of 10.
+func NmiChecksum(nmi string) byte {
+	sum := 0
+	double := true
+	for i := len(nmi) - 1; i >= 0; i-- {
+		v := int(nmi[i])
+		if double {
+			v *= 2
+		}
+		double = !double
+		for ; v > 0; v /= 10 {
+			sum += v % 10
+		}
+	}
+
+	return byte('0' + (10-sum%10)%10)
+}
@@ -0,0 +1,30 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package nem12
+
+import "testing"
+
+// TestNmiChecksum checks the examples of the AEMO National Metering Identifier Procedure.
+func TestNmiChecksum(t *testing.T) {
+	tests := []struct {
+		nmi  string
+		want byte
+	}{
+		{"2001985732", '8'},
+		{"2001985733", '6'},
+		{"3075621875", '8'},
+		{"4316854005", '9'},
+		{"QAAAVZZZZZ", '3'},
+		{"QCDWW00010", '2'},
+		{"SMVEW00085", '8'},
+		{"VAAA000065", '7'},
+		{"NAAAMYS582", '6'},
+		{"NBBBX11110", '0'},
+		{"VKTS786150", '2'},
+	}
+	for _, test := range tests {
+		if got := NmiChecksum(test.nmi); got != test.want {
+			t.Errorf("NmiChecksum(%s) = %c, want %c", test.nmi, got, test.want)
+		}
+	}
+}
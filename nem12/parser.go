@@ -147,6 +147,31 @@ func ParseIntervalValue(intervalValue []byte) (float64, error) {
 
 	return float64(mantissa) * math.Pow10(exp), nil
 }
+func ParseIntervalValueDecimal(intervalValue []byte, scale int) (int64, error) {
+	mantissa, exp, trunc, i, ok := readFloat(intervalValue)
+	if !ok || trunc || i != len(intervalValue) {
+		return 0, ErrInvalidIntervalValue
+	}
+
+	// Rescale to exactly scale decimal places, rejecting values that would lose precision.
+	for exp += scale; exp > 0; exp-- {
+		if mantissa > math.MaxInt64/10 {
+			return 0, ErrInvalidIntervalValue
+		}
+		mantissa *= 10
+	}
+	for ; exp < 0; exp++ {
+		if mantissa%10 != 0 {
+			return 0, ErrInvalidIntervalValue
+		}
+		mantissa /= 10
+	}
+	if mantissa > math.MaxInt64 {
+		return 0, ErrInvalidIntervalValue
+	}
+
+	return int64(mantissa), nil
+}
 
 func ParseHeaderRecord(record [][]byte) (headerRecord *HeaderRecord, err error) {
 	headerRecord = &HeaderRecord{}
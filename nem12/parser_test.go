@@ -0,0 +1,61 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package nem12
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseIntervalValueDecimal(t *testing.T) {
+	tests := []struct {
+		value string
+		scale int
+		want  int64
+		err   error
+	}{
+		{"12.5", 3, 12500, nil},
+		{"0.001", 3, 1, nil},
+		{"007", 3, 7000, nil},
+		{"+1.25", 3, 1250, nil},
+		{"10.000", 0, 10, nil},
+		{"9223372036854775807", 0, 9223372036854775807, nil},
+		{"12.5x", 3, 0, ErrInvalidIntervalValue},
+		{"12 ", 3, 0, ErrInvalidIntervalValue},
+		{"1.2.3", 3, 0, ErrInvalidIntervalValue},
+		{"1e3", 3, 0, ErrInvalidIntervalValue},
+		{"-1", 3, 0, ErrInvalidIntervalValue},
+		{"", 3, 0, ErrInvalidIntervalValue},
+		{".", 3, 0, ErrInvalidIntervalValue},
+		{"1.2345", 3, 0, ErrInvalidIntervalValue},
+		{"9223372036854775808", 0, 0, ErrInvalidIntervalValue},
+		{"92233720368547758", 3, 0, ErrInvalidIntervalValue},
+	}
+	for _, test := range tests {
+		got, err := ParseIntervalValueDecimal([]byte(test.value), test.scale)
+		if !errors.Is(err, test.err) || got != test.want {
+			t.Errorf("ParseIntervalValueDecimal(%q, %d) = %d, %v, want %d, %v", test.value, test.scale, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestParseIntervalValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64
+		err   error
+	}{
+		{"12.5", 12.5, nil},
+		{"0.001", 0.001, nil},
+		{"1.000", 1, nil},
+		{"", 0, ErrInvalidIntervalValue},
+		{"-1", 0, ErrInvalidIntervalValue},
+		{"x", 0, ErrInvalidIntervalValue},
+	}
+	for _, test := range tests {
+		got, err := ParseIntervalValue([]byte(test.value))
+		if !errors.Is(err, test.err) || got != test.want {
+			t.Errorf("ParseIntervalValue(%q) = %g, %v, want %g, %v", test.value, got, err, test.want, test.err)
+		}
+	}
+}
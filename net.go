@@ -0,0 +1,153 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Cheejyg/Flo-Energy-Tech-Assessment/nem12"
+)
+
+func init() {
+	RegisterSink("net", func(config *SinkConfig) (Sink, error) {
+		if config.Append {
+			return nil, ErrSinkNotResumable
+		}
+
+		missing := sinkOption(config.Options, "missing", "null")
+		if missing != "null" && missing != "zero" {
+			return nil, fmt.Errorf("%w: missing %q, want null or zero", ErrInvalidSinkOption, missing)
+		}
+		format := reportFormat(config)
+
+		return newFileSink(config, func(writer io.Writer) (Sink, error) {
+			return NewNetWriter(writer, missing == "zero", format)
+		})
+	})
+}
+
+// netInterval values are scaled by 10^aggregateScale.
+type netInterval struct {
+	Timestamp      time.Time
+	IntervalLength time.Duration
+	Import         int64
+	Export         int64
+	HasImport      bool
+	HasExport      bool
+}
+
+// NetWriter pairs each NMI's import (E) and export (B) channels by element and interval, and writes gross import, gross export and net (import less export) per interval as CSV or JSON on Close.
+//
+// Where one of the channels has no reading for an interval, e.g. for a day it was not sent, its value and the net are empty (null), or, if MissingAsZero, taken as zero. Other channels are ignored, and a reading sent again replaces the earlier one.
+type NetWriter struct {
+	report        *reportWriter
+	missingAsZero bool
+
+	// By channel, with the element it pairs in place of the NMI suffix, e.g. 1 for E1 and B1.
+	intervals map[StoreSeries]map[int64]*netInterval
+}
+
+func NewNetWriter(writer io.Writer, missingAsZero bool, format string) (*NetWriter, error) {
+	report, err := newReportWriter(writer, format)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NetWriter{
+		report:        report,
+		missingAsZero: missingAsZero,
+		intervals:     make(map[StoreSeries]map[int64]*netInterval, 16),
+	}, nil
+}
+
+func (netWriter *NetWriter) WriteBatch(meterReadingsJob []*MeterReadingsJob) error {
+	for _, job := range meterReadingsJob {
+		if len(job.NmiSuffix) < 2 || (job.NmiSuffix[0] != 'E' && job.NmiSuffix[0] != 'B') {
+			continue
+		}
+		value, err := nem12.ParseIntervalValueDecimal(job.Consumption, aggregateScale)
+		if err != nil {
+			return err
+		}
+
+		channel := StoreSeries{job.Nmi, job.NmiSuffix[1:], job.Uom}
+		intervals := netWriter.intervals[channel]
+		if intervals == nil {
+			intervals = make(map[int64]*netInterval, 1024)
+			netWriter.intervals[channel] = intervals
+		}
+		interval := intervals[job.Timestamp.Unix()]
+		if interval == nil {
+			interval = &netInterval{Timestamp: job.Timestamp, IntervalLength: job.IntervalLength}
+			intervals[job.Timestamp.Unix()] = interval
+		}
+		if job.NmiSuffix[0] == 'E' {
+			interval.Import, interval.HasImport = value, true
+		} else {
+			interval.Export, interval.HasExport = value, true
+		}
+	}
+
+	return nil
+}
+
+func (netWriter *NetWriter) Flush() error {
+	return nil
+}
+
+// Close writes one row per NMI, element and interval, in order. It does not close the underlying writer.
+func (netWriter *NetWriter) Close() error {
+	report := netWriter.report
+	if err := report.Begin("nmi,element,uom,timestamp,interval_length,import,export,net"); err != nil {
+		return err
+	}
+
+	number := func(b []byte, v int64, ok bool) []byte {
+		if !ok {
+			return report.AppendNull(b)
+		}
+		return appendScaledDecimal(b, v, aggregateScale)
+	}
+
+	line := make([]byte, 0, 256)
+	for _, channel := range sortedChannels(netWriter.intervals) {
+		intervals := make([]*netInterval, 0, len(netWriter.intervals[channel]))
+		for _, interval := range netWriter.intervals[channel] {
+			intervals = append(intervals, interval)
+		}
+		sort.Slice(intervals, func(i, j int) bool {
+			return intervals[i].Timestamp.Before(intervals[j].Timestamp)
+		})
+
+		for _, interval := range intervals {
+			hasImport := interval.HasImport || netWriter.missingAsZero
+			hasExport := interval.HasExport || netWriter.missingAsZero
+
+			line = report.Field(line[:0], "nmi")
+			line = report.AppendString(line, channel.Nmi)
+			line = report.Field(line, "element")
+			line = report.AppendString(line, channel.NmiSuffix)
+			line = report.Field(line, "uom")
+			line = report.AppendString(line, channel.Uom)
+			line = report.Field(line, "timestamp")
+			line = report.AppendTimestamp(line, interval.Timestamp)
+			line = report.Field(line, "interval_length")
+			line = strconv.AppendInt(line, int64(interval.IntervalLength/time.Minute), 10)
+			line = report.Field(line, "import")
+			line = number(line, interval.Import, hasImport)
+			line = report.Field(line, "export")
+			line = number(line, interval.Export, hasExport)
+			line = report.Field(line, "net")
+			line = number(line, interval.Import-interval.Export, hasImport && hasExport)
+			if err := report.Record(line); err != nil {
+				return err
+			}
+		}
+	}
+
+	return report.End()
+}
@@ -0,0 +1,223 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Cheejyg/Flo-Energy-Tech-Assessment/nem12"
+)
+
+func init() {
+	RegisterSink("openmetrics", func(config *SinkConfig) (Sink, error) {
+		if config.Append {
+			return nil, ErrSinkNotResumable
+		}
+		return newFileSink(config, func(writer io.Writer) (Sink, error) {
+			return NewOpenMetricsWriter(writer)
+		})
+	})
+}
+
+const openMetricsMetricName string = "nem12_interval_energy"
+const openMetricsScale int = 6 // Counter values are cumulated as fixed-point decimals, so they stay exact.
+
+var openMetricsLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+type openMetricsPoint struct {
+	Timestamp int64 // Unix seconds.
+	Value     int64 // Scaled by 10^openMetricsScale.
+}
+type openMetricsSegment struct {
+	Offset int64
+	Count  int
+}
+type openMetricsSeries struct {
+	Nmi       string
+	NmiSuffix string
+	Uom       string
+	Segments  []openMetricsSegment
+}
+
+// OpenMetricsWriter writes meter readings as an OpenMetrics exposition for `promtool tsdb create-blocks-from openmetrics`.
+//
+// OpenMetrics requires every series to be contiguous and in time order, while a NEM12 file may spread a channel over several 200 blocks. Points are therefore spilled to a temporary file as they arrive, and each series is read back, sorted and cumulated on Close.
+type OpenMetricsWriter struct {
+	writer      *bufio.Writer
+	spill       *os.File
+	spillWriter *bufio.Writer
+	spillOffset int64
+	series      map[string]*openMetricsSeries
+}
+
+func NewOpenMetricsWriter(writer io.Writer) (*OpenMetricsWriter, error) {
+	spill, err := os.CreateTemp("", "openmetrics-*.spill")
+	if err != nil {
+		return nil, err
+	}
+
+	return &OpenMetricsWriter{
+		writer:      bufio.NewWriterSize(writer, 1<<22),
+		spill:       spill,
+		spillWriter: bufio.NewWriterSize(spill, 1<<20),
+		series:      make(map[string]*openMetricsSeries, 64),
+	}, nil
+}
+
+func (openMetricsWriter *OpenMetricsWriter) WriteBatch(meterReadingsJob []*MeterReadingsJob) error {
+	var point [16]byte
+	var series *openMetricsSeries
+	for i := range meterReadingsJob {
+		if i == 0 || meterReadingsJob[i].Nmi != meterReadingsJob[i-1].Nmi || meterReadingsJob[i].NmiSuffix != meterReadingsJob[i-1].NmiSuffix || meterReadingsJob[i].Uom != meterReadingsJob[i-1].Uom {
+			key := meterReadingsJob[i].Nmi + "\x00" + meterReadingsJob[i].NmiSuffix + "\x00" + meterReadingsJob[i].Uom
+			series = openMetricsWriter.series[key]
+			if series == nil {
+				series = &openMetricsSeries{
+					Nmi:       meterReadingsJob[i].Nmi,
+					NmiSuffix: meterReadingsJob[i].NmiSuffix,
+					Uom:       meterReadingsJob[i].Uom,
+				}
+				openMetricsWriter.series[key] = series
+			}
+			series.Segments = append(series.Segments, openMetricsSegment{Offset: openMetricsWriter.spillOffset})
+		}
+
+		value, err := nem12.ParseIntervalValueDecimal(meterReadingsJob[i].Consumption, openMetricsScale)
+		if err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint64(point[0:], uint64(meterReadingsJob[i].Timestamp.Add(-marketTimeOffset).Unix()))
+		binary.LittleEndian.PutUint64(point[8:], uint64(value))
+		if _, err := openMetricsWriter.spillWriter.Write(point[:]); err != nil {
+			return err
+		}
+		openMetricsWriter.spillOffset += int64(len(point))
+		series.Segments[len(series.Segments)-1].Count++
+	}
+
+	return nil
+}
+
+func (openMetricsWriter *OpenMetricsWriter) readSeries(series *openMetricsSeries) ([]openMetricsPoint, error) {
+	n := 0
+	for i := range series.Segments {
+		n += series.Segments[i].Count
+	}
+
+	points := make([]openMetricsPoint, 0, n)
+	for i := range series.Segments {
+		b := make([]byte, 16*series.Segments[i].Count)
+		if _, err := openMetricsWriter.spill.ReadAt(b, series.Segments[i].Offset); err != nil {
+			return nil, err
+		}
+		for j := 0; j < len(b); j += 16 {
+			points = append(points, openMetricsPoint{
+				Timestamp: int64(binary.LittleEndian.Uint64(b[j:])),
+				Value:     int64(binary.LittleEndian.Uint64(b[j+8:])),
+			})
+		}
+	}
+
+	// Resent days repeat timestamps; the reading seen last wins.
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].Timestamp < points[j].Timestamp
+	})
+	deduplicated := points[:0]
+	for i := range points {
+		if len(deduplicated) > 0 && deduplicated[len(deduplicated)-1].Timestamp == points[i].Timestamp {
+			deduplicated[len(deduplicated)-1] = points[i]
+		} else {
+			deduplicated = append(deduplicated, points[i])
+		}
+	}
+
+	return deduplicated, nil
+}
+
+func (openMetricsWriter *OpenMetricsWriter) Flush() error {
+	return openMetricsWriter.spillWriter.Flush()
+}
+
+// Close writes every series, cumulated in time order, followed by the # EOF marker. It does not close the underlying writer.
+func (openMetricsWriter *OpenMetricsWriter) Close() error {
+	defer os.Remove(openMetricsWriter.spill.Name())
+	defer openMetricsWriter.spill.Close()
+
+	if err := openMetricsWriter.spillWriter.Flush(); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(openMetricsWriter.series))
+	for key := range openMetricsWriter.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	writer := openMetricsWriter.writer
+	writer.WriteString("# HELP " + openMetricsMetricName + " Interval energy from NEM12 interval data, cumulated per NMI channel.\n")
+	writer.WriteString("# TYPE " + openMetricsMetricName + " counter\n")
+
+	line := make([]byte, 0, 128)
+	for _, key := range keys {
+		series := openMetricsWriter.series[key]
+		points, err := openMetricsWriter.readSeries(series)
+		if err != nil {
+			return err
+		}
+
+		var labels strings.Builder
+		labels.WriteString(openMetricsMetricName + "_total{nmi=\"")
+		labels.WriteString(openMetricsLabelEscaper.Replace(series.Nmi))
+		labels.WriteString("\",suffix=\"")
+		labels.WriteString(openMetricsLabelEscaper.Replace(series.NmiSuffix))
+		labels.WriteString("\",uom=\"")
+		labels.WriteString(openMetricsLabelEscaper.Replace(series.Uom))
+		labels.WriteString("\"} ")
+
+		var total int64
+		for i := range points {
+			total += points[i].Value
+
+			line = append(line[:0], labels.String()...)
+			line = appendScaledDecimal(line, total, openMetricsScale)
+			line = append(line, ' ')
+			line = strconv.AppendInt(line, points[i].Timestamp, 10)
+			line = append(line, '\n')
+			if _, err := writer.Write(line); err != nil {
+				return err
+			}
+		}
+	}
+
+	writer.WriteString("# EOF\n")
+
+	return writer.Flush()
+}
+
+// appendScaledDecimal appends v / 10^scale without going through floating point.
+func appendScaledDecimal(b []byte, v int64, scale int) []byte {
+	if v < 0 {
+		b = append(b, '-')
+		v = -v
+	}
+
+	digits := strconv.FormatInt(v, 10)
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+
+	integer, fraction := digits[:len(digits)-scale], strings.TrimRight(digits[len(digits)-scale:], "0")
+	b = append(b, integer...)
+	if fraction != "" {
+		b = append(b, '.')
+		b = append(b, fraction...)
+	}
+
+	return b
+}
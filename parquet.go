@@ -0,0 +1,577 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/bits"
+
+	"github.com/Cheejyg/Flo-Energy-Tech-Assessment/nem12"
+)
+
+func init() {
+	RegisterSink("parquet", func(config *SinkConfig) (Sink, error) {
+		if config.Append {
+			return nil, ErrSinkNotResumable
+		}
+		return newFileSink(config, func(writer io.Writer) (Sink, error) {
+			return NewParquetWriter(writer)
+		})
+	})
+}
+
+// Apache Parquet format constants, as defined in parquet.thrift.
+const (
+	parquetTypeInt64     int32 = 2
+	parquetTypeDouble    int32 = 5
+	parquetTypeByteArray int32 = 6
+
+	parquetRepetitionRequired int32 = 0
+
+	parquetConvertedTypeUtf8 int32 = 0
+
+	parquetEncodingPlain         int32 = 0
+	parquetEncodingRle           int32 = 3
+	parquetEncodingRleDictionary int32 = 8
+
+	parquetCodecGzip int32 = 2
+
+	parquetPageTypeDataPage       int32 = 0
+	parquetPageTypeDictionaryPage int32 = 2
+)
+
+const parquetMagic string = "PAR1"
+const parquetCreatedBy string = "Flo-Energy-Tech-Assessment"
+
+var ErrParquetWriterClosed = errors.New("parquet writer closed")
+
+type parquetColumn struct {
+	Name        string
+	Type        int32
+	LogicalType func(thrift *thriftCompactWriter)
+	Utf8        bool // Dictionary encoded UTF-8 string.
+}
+
+// meter_readings schema: nmi, suffix, timestamp, value, quality.
+var parquetColumns = []parquetColumn{
+	{Name: "nmi", Type: parquetTypeByteArray, LogicalType: parquetLogicalTypeString, Utf8: true},
+	{Name: "suffix", Type: parquetTypeByteArray, LogicalType: parquetLogicalTypeString, Utf8: true},
+	{Name: "timestamp", Type: parquetTypeInt64, LogicalType: parquetLogicalTypeTimestampMillis},
+	{Name: "value", Type: parquetTypeDouble},
+	{Name: "quality", Type: parquetTypeByteArray, LogicalType: parquetLogicalTypeString, Utf8: true},
+}
+
+func parquetLogicalTypeString(thrift *thriftCompactWriter) {
+	thrift.StructBegin(1) // STRING
+	thrift.StructEnd()
+}
+func parquetLogicalTypeTimestampMillis(thrift *thriftCompactWriter) {
+	thrift.StructBegin(8) // TIMESTAMP
+	// NEM12 timestamps are local market time, not UTC.
+	thrift.BoolField(1, false)
+	thrift.StructBegin(2) // unit
+	thrift.StructBegin(1) // MILLIS
+	thrift.StructEnd()
+	thrift.StructEnd()
+	thrift.StructEnd()
+}
+
+type parquetStatistics struct {
+	Min           []byte
+	Max           []byte
+	DistinctCount int64
+	Unsigned      bool // Ordered as unsigned bytes, as strings are, so the deprecated min and max, which readers compare as signed, are left out.
+}
+type parquetColumnChunk struct {
+	Type                  int32
+	Encodings             []int32
+	Path                  string
+	NumValues             int64
+	TotalUncompressedSize int64
+	TotalCompressedSize   int64
+	DataPageOffset        int64
+	DictionaryPageOffset  int64
+	Statistics            parquetStatistics
+}
+type parquetRowGroup struct {
+	Columns             []parquetColumnChunk
+	NumRows             int64
+	FileOffset          int64
+	TotalByteSize       int64
+	TotalCompressedSize int64
+}
+
+// ParquetWriter writes meter readings as an Apache Parquet file, one row group per batch.
+type ParquetWriter struct {
+	writer     *bufio.Writer
+	offset     int64
+	numRows    int64
+	rowGroups  []parquetRowGroup
+	gzipWriter *gzip.Writer
+	closed     bool
+}
+
+func NewParquetWriter(writer io.Writer) (*ParquetWriter, error) {
+	parquetWriter := &ParquetWriter{
+		writer:     bufio.NewWriterSize(writer, 1<<22),
+		gzipWriter: gzip.NewWriter(io.Discard),
+	}
+
+	if err := parquetWriter.write([]byte(parquetMagic)); err != nil {
+		return nil, err
+	}
+
+	return parquetWriter, nil
+}
+
+func (parquetWriter *ParquetWriter) write(b []byte) error {
+	n, err := parquetWriter.writer.Write(b)
+	parquetWriter.offset += int64(n)
+	return err
+}
+func (parquetWriter *ParquetWriter) compress(page []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.Grow(len(page) / 2)
+
+	parquetWriter.gzipWriter.Reset(&buffer)
+	if _, err := parquetWriter.gzipWriter.Write(page); err != nil {
+		return nil, err
+	}
+	if err := parquetWriter.gzipWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+func (parquetWriter *ParquetWriter) writePage(pageType int32, page []byte, numValues int, encoding int32, statistics *parquetStatistics) (size int64, compressedSize int64, err error) {
+	compressed, err := parquetWriter.compress(page)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var thrift thriftCompactWriter
+	thrift.I32Field(1, pageType)
+	thrift.I32Field(2, int32(len(page)))
+	thrift.I32Field(3, int32(len(compressed)))
+	switch pageType {
+	case parquetPageTypeDataPage:
+		thrift.StructBegin(5)
+		thrift.I32Field(1, int32(numValues))
+		thrift.I32Field(2, encoding)
+		thrift.I32Field(3, parquetEncodingRle)
+		thrift.I32Field(4, parquetEncodingRle)
+		if statistics != nil {
+			writeParquetStatistics(&thrift, 5, statistics)
+		}
+		thrift.StructEnd()
+	case parquetPageTypeDictionaryPage:
+		thrift.StructBegin(7)
+		thrift.I32Field(1, int32(numValues))
+		thrift.I32Field(2, encoding)
+		thrift.StructEnd()
+	}
+	thrift.Stop()
+
+	if err := parquetWriter.write(thrift.Bytes()); err != nil {
+		return 0, 0, err
+	}
+	if err := parquetWriter.write(compressed); err != nil {
+		return 0, 0, err
+	}
+
+	return int64(len(thrift.Bytes()) + len(page)), int64(len(thrift.Bytes()) + len(compressed)), nil
+}
+
+func (parquetWriter *ParquetWriter) writeDictionaryColumn(column *parquetColumn, value func(i int) []byte, n int) (columnChunk parquetColumnChunk, err error) {
+	dictionaryIndex := make(map[string]uint32, 64)
+	var dictionary [][]byte
+	indices := make([]uint32, n)
+
+	var minValue, maxValue []byte
+	for i := range n {
+		v := value(i)
+		index, ok := dictionaryIndex[string(v)]
+		if !ok {
+			index = uint32(len(dictionary))
+			dictionaryIndex[string(v)] = index
+			dictionary = append(dictionary, v)
+
+			if minValue == nil || bytes.Compare(v, minValue) < 0 {
+				minValue = v
+			}
+			if maxValue == nil || bytes.Compare(v, maxValue) > 0 {
+				maxValue = v
+			}
+		}
+		indices[i] = index
+	}
+
+	var dictionaryPage bytes.Buffer
+	for i := range dictionary {
+		dictionaryPage.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(dictionary[i]))))
+		dictionaryPage.Write(dictionary[i])
+	}
+
+	bitWidth := max(1, bits.Len32(uint32(len(dictionary)-1)))
+	dataPage := make([]byte, 1, 1+n)
+	dataPage[0] = byte(bitWidth)
+	dataPage = appendRleRuns(dataPage, indices, bitWidth)
+
+	columnChunk = parquetColumnChunk{
+		Type:                 column.Type,
+		Encodings:            []int32{parquetEncodingPlain, parquetEncodingRle, parquetEncodingRleDictionary},
+		Path:                 column.Name,
+		NumValues:            int64(n),
+		DictionaryPageOffset: parquetWriter.offset,
+		Statistics: parquetStatistics{
+			Min:           minValue,
+			Max:           maxValue,
+			DistinctCount: int64(len(dictionary)),
+			Unsigned:      column.Type == parquetTypeByteArray,
+		},
+	}
+
+	size, compressedSize, err := parquetWriter.writePage(parquetPageTypeDictionaryPage, dictionaryPage.Bytes(), len(dictionary), parquetEncodingPlain, nil)
+	if err != nil {
+		return
+	}
+	columnChunk.TotalUncompressedSize += size
+	columnChunk.TotalCompressedSize += compressedSize
+
+	columnChunk.DataPageOffset = parquetWriter.offset
+	size, compressedSize, err = parquetWriter.writePage(parquetPageTypeDataPage, dataPage, n, parquetEncodingRleDictionary, &columnChunk.Statistics)
+	if err != nil {
+		return
+	}
+	columnChunk.TotalUncompressedSize += size
+	columnChunk.TotalCompressedSize += compressedSize
+
+	return
+}
+func (parquetWriter *ParquetWriter) writePlainColumn(column *parquetColumn, page []byte, n int, statistics parquetStatistics) (columnChunk parquetColumnChunk, err error) {
+	columnChunk = parquetColumnChunk{
+		Type:           column.Type,
+		Encodings:      []int32{parquetEncodingPlain, parquetEncodingRle},
+		Path:           column.Name,
+		NumValues:      int64(n),
+		DataPageOffset: parquetWriter.offset,
+		Statistics:     statistics,
+	}
+
+	size, compressedSize, err := parquetWriter.writePage(parquetPageTypeDataPage, page, n, parquetEncodingPlain, &columnChunk.Statistics)
+	if err != nil {
+		return
+	}
+	columnChunk.TotalUncompressedSize = size
+	columnChunk.TotalCompressedSize = compressedSize
+
+	return
+}
+
+// WriteBatch writes meterReadingsJob as a single row group, so row groups are sized by the batch size.
+func (parquetWriter *ParquetWriter) WriteBatch(meterReadingsJob []*MeterReadingsJob) error {
+	if parquetWriter.closed {
+		return ErrParquetWriterClosed
+	}
+	n := len(meterReadingsJob)
+	if n == 0 {
+		return nil
+	}
+
+	rowGroup := parquetRowGroup{
+		Columns:    make([]parquetColumnChunk, 0, len(parquetColumns)),
+		NumRows:    int64(n),
+		FileOffset: parquetWriter.offset,
+	}
+
+	for c := range parquetColumns {
+		column := &parquetColumns[c]
+
+		var columnChunk parquetColumnChunk
+		var err error
+		switch column.Name {
+		case "nmi":
+			columnChunk, err = parquetWriter.writeDictionaryColumn(column, func(i int) []byte { return []byte(meterReadingsJob[i].Nmi) }, n)
+		case "suffix":
+			columnChunk, err = parquetWriter.writeDictionaryColumn(column, func(i int) []byte { return []byte(meterReadingsJob[i].NmiSuffix) }, n)
+		case "quality":
+			columnChunk, err = parquetWriter.writeDictionaryColumn(column, func(i int) []byte { return []byte(meterReadingsJob[i].QualityMethod) }, n)
+		case "timestamp":
+			page := make([]byte, 0, 8*n)
+			minValue, maxValue := int64(math.MaxInt64), int64(math.MinInt64)
+			for i := range meterReadingsJob {
+				v := meterReadingsJob[i].Timestamp.UnixMilli()
+				minValue, maxValue = min(minValue, v), max(maxValue, v)
+				page = binary.LittleEndian.AppendUint64(page, uint64(v))
+			}
+			columnChunk, err = parquetWriter.writePlainColumn(column, page, n, parquetStatistics{
+				Min: binary.LittleEndian.AppendUint64(nil, uint64(minValue)),
+				Max: binary.LittleEndian.AppendUint64(nil, uint64(maxValue)),
+			})
+		case "value":
+			page := make([]byte, 0, 8*n)
+			minValue, maxValue := math.Inf(1), math.Inf(-1)
+			for i := range meterReadingsJob {
+				v, err := nem12.ParseIntervalValue(meterReadingsJob[i].Consumption)
+				if err != nil {
+					return err
+				}
+				minValue, maxValue = min(minValue, v), max(maxValue, v)
+				page = binary.LittleEndian.AppendUint64(page, math.Float64bits(v))
+			}
+			columnChunk, err = parquetWriter.writePlainColumn(column, page, n, parquetStatistics{
+				Min: binary.LittleEndian.AppendUint64(nil, math.Float64bits(minValue)),
+				Max: binary.LittleEndian.AppendUint64(nil, math.Float64bits(maxValue)),
+			})
+		}
+		if err != nil {
+			return err
+		}
+
+		rowGroup.TotalByteSize += columnChunk.TotalUncompressedSize
+		rowGroup.TotalCompressedSize += columnChunk.TotalCompressedSize
+		rowGroup.Columns = append(rowGroup.Columns, columnChunk)
+	}
+
+	parquetWriter.rowGroups = append(parquetWriter.rowGroups, rowGroup)
+	parquetWriter.numRows += int64(n)
+
+	return parquetWriter.writer.Flush()
+}
+
+func (parquetWriter *ParquetWriter) Flush() error {
+	return parquetWriter.writer.Flush()
+}
+
+// Close writes the file footer. It does not close the underlying writer.
+func (parquetWriter *ParquetWriter) Close() error {
+	if parquetWriter.closed {
+		return nil
+	}
+	parquetWriter.closed = true
+
+	var thrift thriftCompactWriter
+	thrift.I32Field(1, 1) // version
+
+	thrift.ListBegin(2, thriftTypeStruct, 1+len(parquetColumns))
+	thrift.ListStructBegin()
+	thrift.BinaryField(4, []byte("schema"))
+	thrift.I32Field(5, int32(len(parquetColumns)))
+	thrift.StructEnd()
+	for c := range parquetColumns {
+		thrift.ListStructBegin()
+		thrift.I32Field(1, parquetColumns[c].Type)
+		thrift.I32Field(3, parquetRepetitionRequired)
+		thrift.BinaryField(4, []byte(parquetColumns[c].Name))
+		if parquetColumns[c].Utf8 {
+			thrift.I32Field(6, parquetConvertedTypeUtf8)
+		}
+		if parquetColumns[c].LogicalType != nil {
+			thrift.StructBegin(10)
+			parquetColumns[c].LogicalType(&thrift)
+			thrift.StructEnd()
+		}
+		thrift.StructEnd()
+	}
+
+	thrift.I64Field(3, parquetWriter.numRows)
+
+	thrift.ListBegin(4, thriftTypeStruct, len(parquetWriter.rowGroups))
+	for r := range parquetWriter.rowGroups {
+		rowGroup := &parquetWriter.rowGroups[r]
+
+		thrift.ListStructBegin()
+		thrift.ListBegin(1, thriftTypeStruct, len(rowGroup.Columns))
+		for c := range rowGroup.Columns {
+			writeParquetColumnChunk(&thrift, &rowGroup.Columns[c])
+		}
+		thrift.I64Field(2, rowGroup.TotalByteSize)
+		thrift.I64Field(3, rowGroup.NumRows)
+		thrift.I64Field(5, rowGroup.FileOffset)
+		thrift.I64Field(6, rowGroup.TotalCompressedSize)
+		thrift.I16Field(7, int16(r))
+		thrift.StructEnd()
+	}
+
+	thrift.BinaryField(6, []byte(parquetCreatedBy))
+
+	// TypeDefinedOrder for every column, so that min_value/max_value statistics can be used for pruning.
+	thrift.ListBegin(7, thriftTypeStruct, len(parquetColumns))
+	for range parquetColumns {
+		thrift.ListStructBegin()
+		thrift.StructBegin(1)
+		thrift.StructEnd()
+		thrift.StructEnd()
+	}
+	thrift.Stop()
+
+	footer := thrift.Bytes()
+	if err := parquetWriter.write(footer); err != nil {
+		return err
+	}
+	if err := parquetWriter.write(binary.LittleEndian.AppendUint32(nil, uint32(len(footer)))); err != nil {
+		return err
+	}
+	if err := parquetWriter.write([]byte(parquetMagic)); err != nil {
+		return err
+	}
+
+	return parquetWriter.writer.Flush()
+}
+
+func writeParquetStatistics(thrift *thriftCompactWriter, id int16, statistics *parquetStatistics) {
+	thrift.StructBegin(id)
+	if !statistics.Unsigned {
+		thrift.BinaryField(1, statistics.Max)
+		thrift.BinaryField(2, statistics.Min)
+	}
+	thrift.I64Field(3, 0) // null_count
+	if statistics.DistinctCount > 0 {
+		thrift.I64Field(4, statistics.DistinctCount)
+	}
+	thrift.BinaryField(5, statistics.Max)
+	thrift.BinaryField(6, statistics.Min)
+	thrift.StructEnd()
+}
+func writeParquetColumnChunk(thrift *thriftCompactWriter, columnChunk *parquetColumnChunk) {
+	thrift.ListStructBegin()
+	if columnChunk.DictionaryPageOffset > 0 {
+		thrift.I64Field(2, columnChunk.DictionaryPageOffset)
+	} else {
+		thrift.I64Field(2, columnChunk.DataPageOffset)
+	}
+
+	thrift.StructBegin(3)
+	thrift.I32Field(1, columnChunk.Type)
+	thrift.ListBegin(2, thriftTypeI32, len(columnChunk.Encodings))
+	for i := range columnChunk.Encodings {
+		thrift.ListI32(columnChunk.Encodings[i])
+	}
+	thrift.ListBegin(3, thriftTypeBinary, 1)
+	thrift.ListBinary([]byte(columnChunk.Path))
+	thrift.I32Field(4, parquetCodecGzip)
+	thrift.I64Field(5, columnChunk.NumValues)
+	thrift.I64Field(6, columnChunk.TotalUncompressedSize)
+	thrift.I64Field(7, columnChunk.TotalCompressedSize)
+	thrift.I64Field(9, columnChunk.DataPageOffset)
+	if columnChunk.DictionaryPageOffset > 0 {
+		thrift.I64Field(11, columnChunk.DictionaryPageOffset)
+	}
+	writeParquetStatistics(thrift, 12, &columnChunk.Statistics)
+	thrift.StructEnd()
+
+	thrift.StructEnd()
+}
+
+// appendRleRuns appends values in the RLE/bit-packing hybrid encoding, using RLE runs only.
+func appendRleRuns(b []byte, values []uint32, bitWidth int) []byte {
+	byteWidth := (bitWidth + 7) / 8
+	for i := 0; i < len(values); {
+		j := i + 1
+		for j < len(values) && values[j] == values[i] {
+			j++
+		}
+
+		b = binary.AppendUvarint(b, uint64(j-i)<<1)
+		for k := range byteWidth {
+			b = append(b, byte(values[i]>>(8*k)))
+		}
+
+		i = j
+	}
+
+	return b
+}
+
+// Thrift compact protocol types.
+const (
+	thriftTypeBoolTrue  byte = 1
+	thriftTypeBoolFalse byte = 2
+	thriftTypeI16       byte = 4
+	thriftTypeI32       byte = 5
+	thriftTypeI64       byte = 6
+	thriftTypeBinary    byte = 8
+	thriftTypeList      byte = 9
+	thriftTypeStruct    byte = 12
+)
+
+// thriftCompactWriter is the subset of the Thrift compact protocol needed for Parquet metadata.
+type thriftCompactWriter struct {
+	buffer      []byte
+	lastFieldId int16
+	stack       []int16
+}
+
+func (thrift *thriftCompactWriter) Bytes() []byte {
+	return thrift.buffer
+}
+func (thrift *thriftCompactWriter) fieldBegin(id int16, fieldType byte) {
+	if delta := id - thrift.lastFieldId; delta > 0 && delta <= 15 {
+		thrift.buffer = append(thrift.buffer, byte(delta)<<4|fieldType)
+	} else {
+		thrift.buffer = append(thrift.buffer, fieldType)
+		thrift.buffer = binary.AppendVarint(thrift.buffer, int64(id))
+	}
+	thrift.lastFieldId = id
+}
+func (thrift *thriftCompactWriter) BoolField(id int16, v bool) {
+	if v {
+		thrift.fieldBegin(id, thriftTypeBoolTrue)
+	} else {
+		thrift.fieldBegin(id, thriftTypeBoolFalse)
+	}
+}
+func (thrift *thriftCompactWriter) I16Field(id int16, v int16) {
+	thrift.fieldBegin(id, thriftTypeI16)
+	thrift.buffer = binary.AppendVarint(thrift.buffer, int64(v))
+}
+func (thrift *thriftCompactWriter) I32Field(id int16, v int32) {
+	thrift.fieldBegin(id, thriftTypeI32)
+	thrift.buffer = binary.AppendVarint(thrift.buffer, int64(v))
+}
+func (thrift *thriftCompactWriter) I64Field(id int16, v int64) {
+	thrift.fieldBegin(id, thriftTypeI64)
+	thrift.buffer = binary.AppendVarint(thrift.buffer, v)
+}
+func (thrift *thriftCompactWriter) BinaryField(id int16, v []byte) {
+	thrift.fieldBegin(id, thriftTypeBinary)
+	thrift.ListBinary(v)
+}
+func (thrift *thriftCompactWriter) StructBegin(id int16) {
+	thrift.fieldBegin(id, thriftTypeStruct)
+	thrift.ListStructBegin()
+}
+func (thrift *thriftCompactWriter) StructEnd() {
+	thrift.Stop()
+	thrift.lastFieldId = thrift.stack[len(thrift.stack)-1]
+	thrift.stack = thrift.stack[:len(thrift.stack)-1]
+}
+func (thrift *thriftCompactWriter) Stop() {
+	thrift.buffer = append(thrift.buffer, 0)
+}
+func (thrift *thriftCompactWriter) ListBegin(id int16, elementType byte, size int) {
+	thrift.fieldBegin(id, thriftTypeList)
+	if size < 15 {
+		thrift.buffer = append(thrift.buffer, byte(size)<<4|elementType)
+	} else {
+		thrift.buffer = append(thrift.buffer, 0xF0|elementType)
+		thrift.buffer = binary.AppendUvarint(thrift.buffer, uint64(size))
+	}
+}
+func (thrift *thriftCompactWriter) ListStructBegin() {
+	thrift.stack = append(thrift.stack, thrift.lastFieldId)
+	thrift.lastFieldId = 0
+}
+func (thrift *thriftCompactWriter) ListI32(v int32) {
+	thrift.buffer = binary.AppendVarint(thrift.buffer, int64(v))
+}
+func (thrift *thriftCompactWriter) ListBinary(v []byte) {
+	thrift.buffer = binary.AppendUvarint(thrift.buffer, uint64(len(v)))
+	thrift.buffer = append(thrift.buffer, v...)
+}
@@ -0,0 +1,352 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Cheejyg/Flo-Energy-Tech-Assessment/nem12"
+)
+
+// testMeterReadingsJobs returns readings of two NMIs over two intervals, with a zero and a repeated value.
+func testMeterReadingsJobs() []*MeterReadingsJob {
+	start := time.Date(2005, 3, 1, 0, 30, 0, 0, time.UTC)
+	job := func(nmi string, nmiSuffix string, interval int, consumption string, qualityMethod string) *MeterReadingsJob {
+		return &MeterReadingsJob{
+			Nmi:            nmi,
+			NmiSuffix:      nmiSuffix,
+			Uom:            "kWh",
+			Timestamp:      start.Add(time.Duration(interval) * 30 * time.Minute),
+			Consumption:    []byte(consumption),
+			QualityMethod:  qualityMethod,
+			IntervalLength: 30 * time.Minute,
+			IntervalNumber: interval + 1,
+		}
+	}
+
+	return []*MeterReadingsJob{
+		job("NEM1201009", "E1", 0, "1.5", "A"),
+		job("NEM1201009", "E1", 1, "0", "A"),
+		job("NEM1201009", "B1", 0, "0.25", "S14"),
+		job("NEM1201010", "E1", 0, "123456.789", "A"),
+		job("NEM1201010", "E1", 1, "123456.789", "E52"),
+	}
+}
+
+// thriftCompactReader decodes the Thrift compact protocol, as written by thriftCompactWriter, into maps of field values by id.
+type thriftCompactReader struct {
+	b []byte
+	i int
+}
+
+func (thrift *thriftCompactReader) varint() int64 {
+	v, n := binary.Varint(thrift.b[thrift.i:])
+	thrift.i += n
+	return v
+}
+func (thrift *thriftCompactReader) uvarint() uint64 {
+	v, n := binary.Uvarint(thrift.b[thrift.i:])
+	thrift.i += n
+	return v
+}
+func (thrift *thriftCompactReader) value(fieldType byte) any {
+	switch fieldType {
+	case thriftTypeBoolTrue:
+		return true
+	case thriftTypeBoolFalse:
+		return false
+	case thriftTypeI16, thriftTypeI32, thriftTypeI64:
+		return thrift.varint()
+	case thriftTypeBinary:
+		n := int(thrift.uvarint())
+		thrift.i += n
+		return thrift.b[thrift.i-n : thrift.i]
+	case thriftTypeList:
+		header := thrift.b[thrift.i]
+		thrift.i++
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(thrift.uvarint())
+		}
+		list := make([]any, size)
+		for i := range list {
+			list[i] = thrift.value(header & 0x0F)
+		}
+		return list
+	case thriftTypeStruct:
+		return thrift.Struct()
+	}
+	panic("unknown thrift type")
+}
+func (thrift *thriftCompactReader) Struct() map[int16]any {
+	fields := make(map[int16]any)
+	var id int16
+	for {
+		header := thrift.b[thrift.i]
+		thrift.i++
+		if header == 0 {
+			return fields
+		}
+		if delta := int16(header >> 4); delta > 0 {
+			id += delta
+		} else {
+			id = int16(thrift.varint())
+		}
+		fields[id] = thrift.value(header & 0x0F)
+	}
+}
+
+func TestThriftCompactWriter(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(thrift *thriftCompactWriter)
+		want  []byte
+	}{
+		{"i32", func(thrift *thriftCompactWriter) { thrift.I32Field(1, 1) }, []byte{0x15, 0x02}},
+		{"negative i32", func(thrift *thriftCompactWriter) { thrift.I32Field(1, -1) }, []byte{0x15, 0x01}},
+		{"long field id", func(thrift *thriftCompactWriter) { thrift.I64Field(20, 3) }, []byte{0x06, 0x28, 0x06}},
+		{"bools", func(thrift *thriftCompactWriter) { thrift.BoolField(1, true); thrift.BoolField(2, false) }, []byte{0x11, 0x12}},
+		{"binary", func(thrift *thriftCompactWriter) { thrift.BinaryField(4, []byte("ab")) }, []byte{0x48, 0x02, 'a', 'b'}},
+		{"struct", func(thrift *thriftCompactWriter) {
+			thrift.StructBegin(3)
+			thrift.I32Field(1, 5)
+			thrift.StructEnd()
+			thrift.I32Field(4, 1)
+		}, []byte{0x3C, 0x15, 0x0A, 0x00, 0x15, 0x02}},
+		{"list", func(thrift *thriftCompactWriter) {
+			thrift.ListBegin(2, thriftTypeI32, 2)
+			thrift.ListI32(1)
+			thrift.ListI32(2)
+		}, []byte{0x29, 0x25, 0x02, 0x04}},
+		{"long list", func(thrift *thriftCompactWriter) { thrift.ListBegin(1, thriftTypeStruct, 16) }, []byte{0x19, 0xFC, 0x10}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var thrift thriftCompactWriter
+			test.write(&thrift)
+			if got := thrift.Bytes(); !bytes.Equal(got, test.want) {
+				t.Errorf("got % x, want % x", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAppendRleRuns(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   []uint32
+		bitWidth int
+		want     []byte
+	}{
+		{"empty", nil, 1, nil},
+		{"runs", []uint32{1, 1, 1, 0}, 1, []byte{0x06, 0x01, 0x02, 0x00}},
+		{"two byte width", []uint32{300, 300}, 9, []byte{0x04, 0x2C, 0x01}},
+		{"long run", make([]uint32, 100), 1, []byte{0xC8, 0x01, 0x00}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := appendRleRuns(nil, test.values, test.bitWidth); !bytes.Equal(got, test.want) {
+				t.Errorf("got % x, want % x", got, test.want)
+			}
+		})
+	}
+}
+
+func TestWriteParquetStatistics(t *testing.T) {
+	tests := []struct {
+		name       string
+		statistics parquetStatistics
+		want       map[int16]any
+	}{
+		{"signed", parquetStatistics{Min: []byte{1}, Max: []byte{2}}, map[int16]any{1: []byte{2}, 2: []byte{1}, 3: int64(0), 5: []byte{2}, 6: []byte{1}}},
+		{"unsigned", parquetStatistics{Min: []byte("a"), Max: []byte("b"), DistinctCount: 2, Unsigned: true}, map[int16]any{3: int64(0), 4: int64(2), 5: []byte("b"), 6: []byte("a")}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var thrift thriftCompactWriter
+			writeParquetStatistics(&thrift, 1, &test.statistics)
+			thrift.Stop()
+
+			got := (&thriftCompactReader{b: thrift.Bytes()}).Struct()[1].(map[int16]any)
+			if len(got) != len(test.want) {
+				t.Fatalf("got fields %v, want %v", got, test.want)
+			}
+			for id, want := range test.want {
+				if b, ok := want.([]byte); ok {
+					if !bytes.Equal(got[id].([]byte), b) {
+						t.Errorf("field %d: got %v, want %v", id, got[id], want)
+					}
+				} else if got[id] != want {
+					t.Errorf("field %d: got %v, want %v", id, got[id], want)
+				}
+			}
+		})
+	}
+}
+
+// readParquetPage reads the page at offset, returning its header and uncompressed body.
+func readParquetPage(t *testing.T, file []byte, offset int64) (map[int16]any, []byte) {
+	t.Helper()
+	thrift := &thriftCompactReader{b: file, i: int(offset)}
+	header := thrift.Struct()
+	compressedSize := int(header[3].(int64))
+
+	gzipReader, err := gzip.NewReader(bytes.NewReader(file[thrift.i : thrift.i+compressedSize]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := io.ReadAll(gzipReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != int(header[2].(int64)) {
+		t.Fatalf("page at %d: uncompressed size %d, header says %d", offset, len(page), header[2])
+	}
+
+	return header, page
+}
+
+// readParquetColumn decodes a column chunk into one string per value.
+func readParquetColumn(t *testing.T, file []byte, metaData map[int16]any) []string {
+	t.Helper()
+	var values []string
+
+	if offset, ok := metaData[11].(int64); ok {
+		header, page := readParquetPage(t, file, offset)
+		var dictionary []string
+		for range header[7].(map[int16]any)[1].(int64) {
+			n := binary.LittleEndian.Uint32(page)
+			dictionary = append(dictionary, string(page[4:4+n]))
+			page = page[4+n:]
+		}
+
+		_, page = readParquetPage(t, file, metaData[9].(int64))
+		byteWidth := (int(page[0]) + 7) / 8
+		for page = page[1:]; len(page) > 0; {
+			run, n := binary.Uvarint(page)
+			if run&1 != 0 {
+				t.Fatal("bit-packed run, want RLE runs only")
+			}
+			var index uint32
+			for k := range byteWidth {
+				index |= uint32(page[n+k]) << (8 * k)
+			}
+			for range run >> 1 {
+				values = append(values, dictionary[index])
+			}
+			page = page[n+byteWidth:]
+		}
+		return values
+	}
+
+	_, page := readParquetPage(t, file, metaData[9].(int64))
+	for i := 0; i < len(page); i += 8 {
+		v := binary.LittleEndian.Uint64(page[i:])
+		if metaData[1].(int64) == int64(parquetTypeDouble) {
+			values = append(values, strconv.FormatFloat(math.Float64frombits(v), 'f', -1, 64))
+		} else {
+			values = append(values, time.UnixMilli(int64(v)).UTC().Format(jsonTimestampLayout))
+		}
+	}
+	return values
+}
+
+func TestParquetWriter(t *testing.T) {
+	jobs := testMeterReadingsJobs()
+	tests := []struct {
+		name    string
+		batches [][]*MeterReadingsJob
+	}{
+		{"empty", nil},
+		{"one batch", [][]*MeterReadingsJob{jobs}},
+		{"two batches", [][]*MeterReadingsJob{jobs[:2], jobs[2:]}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			parquetWriter, err := NewParquetWriter(&buffer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, batch := range test.batches {
+				if err := parquetWriter.WriteBatch(batch); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := parquetWriter.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err := parquetWriter.WriteBatch(jobs); !errors.Is(err, ErrParquetWriterClosed) {
+				t.Errorf("WriteBatch after Close: got %v, want %v", err, ErrParquetWriterClosed)
+			}
+
+			file := buffer.Bytes()
+			if !bytes.HasPrefix(file, []byte(parquetMagic)) || !bytes.HasSuffix(file, []byte(parquetMagic)) {
+				t.Fatal("missing PAR1 magic")
+			}
+			footerLength := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+			footer := &thriftCompactReader{b: file[len(file)-8-footerLength : len(file)-8]}
+			metaData := footer.Struct()
+			if footer.i != footerLength {
+				t.Fatalf("footer decoded %d bytes, want %d", footer.i, footerLength)
+			}
+
+			var want []*MeterReadingsJob
+			for _, batch := range test.batches {
+				want = append(want, batch...)
+			}
+			if numRows := metaData[3].(int64); numRows != int64(len(want)) {
+				t.Errorf("num_rows %d, want %d", numRows, len(want))
+			}
+			if schema := metaData[2].([]any); len(schema) != 1+len(parquetColumns) {
+				t.Errorf("schema has %d elements, want %d", len(schema), 1+len(parquetColumns))
+			}
+			rowGroups := metaData[4].([]any)
+			if len(rowGroups) != len(test.batches) {
+				t.Fatalf("%d row groups, want %d", len(rowGroups), len(test.batches))
+			}
+
+			columns := make([][]string, len(parquetColumns))
+			for _, rowGroup := range rowGroups {
+				for c, columnChunk := range rowGroup.(map[int16]any)[1].([]any) {
+					columnMetaData := columnChunk.(map[int16]any)[3].(map[int16]any)
+					statistics := columnMetaData[12].(map[int16]any)
+					if _, ok := statistics[1]; ok == (parquetColumns[c].Type == parquetTypeByteArray) {
+						t.Errorf("%s: deprecated max present: %v", parquetColumns[c].Name, ok)
+					}
+					columns[c] = append(columns[c], readParquetColumn(t, file, columnMetaData)...)
+				}
+			}
+
+			for i, job := range want {
+				row := []string{job.Nmi, job.NmiSuffix, job.Timestamp.Format(jsonTimestampLayout), string(job.Consumption), job.QualityMethod}
+				for c := range parquetColumns {
+					if columns[c][i] != row[c] {
+						t.Errorf("row %d %s: got %q, want %q", i, parquetColumns[c].Name, columns[c][i], row[c])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParquetWriterInvalidValue(t *testing.T) {
+	jobs := testMeterReadingsJobs()
+	jobs[1].Consumption = []byte("x")
+
+	parquetWriter, err := NewParquetWriter(io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parquetWriter.WriteBatch(jobs); !errors.Is(err, nem12.ErrInvalidIntervalValue) {
+		t.Errorf("got %v, want %v", err, nem12.ErrInvalidIntervalValue)
+	}
+}
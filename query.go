@@ -0,0 +1,281 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var ErrInvalidQuery = errors.New("invalid query")
+
+var queryTimeLayouts = []string{"2006-01-02", "2006-01-02T15:04", "2006-01-02T15:04:05"}
+
+func parseQueryTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range queryTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: time %q, want YYYY-MM-DD[THH:MM[:SS]]", ErrInvalidQuery, value)
+}
+
+// queryBucket truncates start to the start of its bucket: a duration that divides a day, or a calendar day or month.
+func queryBucket(start time.Time, interval string, duration time.Duration) time.Time {
+	switch interval {
+	case "":
+		return start
+	case "day":
+		return time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	case "month":
+		return time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return start.Truncate(duration)
+}
+func queryBucketEnd(start time.Time, interval string, duration time.Duration) time.Time {
+	switch interval {
+	case "day":
+		return start.AddDate(0, 0, 1)
+	case "month":
+		return start.AddDate(0, 1, 0)
+	}
+	return start.Add(duration)
+}
+
+type queryReading struct {
+	Start         string      `json:"start"`
+	End           string      `json:"end"`
+	Consumption   json.Number `json:"consumption"`
+	Count         int         `json:"count"` // Intervals summed.
+	QualityMethod string      `json:"quality_method"`
+}
+type querySeries struct {
+	Nmi       string         `json:"nmi"`
+	NmiSuffix string         `json:"nmi_suffix"`
+	Uom       string         `json:"uom"`
+	Total     json.Number    `json:"total"`
+	Readings  []queryReading `json:"readings"`
+}
+
+func queryNumber(value int64) json.Number {
+	return json.Number(appendScaledDecimal(nil, value, storeScale))
+}
+func queryTimestamp(t time.Time) string {
+	return t.Format(jsonTimestampLayout) + jsonMarketTimeOffset
+}
+
+func queryFilter(values []string) map[string]bool {
+	filter := make(map[string]bool)
+	for _, value := range values {
+		for _, v := range strings.Split(value, ",") {
+			if v != "" {
+				filter[v] = true
+			}
+		}
+	}
+	return filter
+}
+
+// QueryServer answers JSON queries over a Store:
+//
+//	GET /series
+//	GET /readings?nmi=NMI1,NMI2&suffix=E1&uom=kWh&from=2005-03-01&to=2005-03-08&interval=day
+//
+// Readings are filtered by the start of their interval, from inclusive and to exclusive, in market time. interval resamples them by summing into buckets of a duration that divides a day (e.g. 30m, 1h) and is a multiple of the stored interval length, or a calendar day or month. A bucket's quality method is that of its readings if they all agree, otherwise V.
+type QueryServer struct {
+	Store *Store
+}
+
+func (queryServer *QueryServer) series(request *http.Request) ([]StoreSeries, error) {
+	query := request.URL.Query()
+	nmis := queryFilter(query["nmi"])
+	suffixes := queryFilter(query["suffix"])
+	uoms := queryFilter(query["uom"])
+
+	all, err := queryServer.Store.Series()
+	if err != nil {
+		return nil, err
+	}
+	series := all[:0]
+	for _, storeSeries := range all {
+		if (len(nmis) == 0 || nmis[storeSeries.Nmi]) && (len(suffixes) == 0 || suffixes[storeSeries.NmiSuffix]) && (len(uoms) == 0 || uoms[storeSeries.Uom]) {
+			series = append(series, storeSeries)
+		}
+	}
+
+	return series, nil
+}
+
+func (queryServer *QueryServer) readings(request *http.Request) ([]querySeries, error) {
+	query := request.URL.Query()
+	from, err := parseQueryTime(query.Get("from"))
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseQueryTime(query.Get("to"))
+	if err != nil {
+		return nil, err
+	}
+
+	interval := query.Get("interval")
+	var duration time.Duration
+	if interval != "" && interval != "day" && interval != "month" {
+		duration, err = time.ParseDuration(interval)
+		if err != nil || duration < time.Minute || (24*time.Hour)%duration != 0 {
+			return nil, fmt.Errorf("%w: interval %q, want a duration dividing a day, day or month", ErrInvalidQuery, interval)
+		}
+	}
+
+	series, err := queryServer.series(request)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]querySeries, 0, len(series))
+	for _, storeSeries := range series {
+		readings, err := queryServer.Store.Readings(storeSeries, from, to)
+		if err != nil {
+			return nil, err
+		}
+
+		resampled := querySeries{
+			Nmi:       storeSeries.Nmi,
+			NmiSuffix: storeSeries.NmiSuffix,
+			Uom:       storeSeries.Uom,
+			Readings:  make([]queryReading, 0, len(readings)),
+		}
+		var total, value int64
+		var bucket, end time.Time
+		for i := range readings {
+			// Readings are summed, never split, so a bucket must hold a whole number of them.
+			if duration > 0 && duration%readings[i].IntervalLength != 0 {
+				return nil, fmt.Errorf("%w: interval %q is not a multiple of the %s readings of %s %s", ErrInvalidQuery, interval, readings[i].IntervalLength, storeSeries.Nmi, storeSeries.NmiSuffix)
+			}
+			start := queryBucket(readings[i].Start(), interval, duration)
+			if i == 0 || !start.Equal(bucket) {
+				if i > 0 {
+					resampled.Readings[len(resampled.Readings)-1].Consumption = queryNumber(value)
+				}
+				bucket, value = start, 0
+				end = readings[i].Timestamp
+				if interval != "" {
+					end = queryBucketEnd(bucket, interval, duration)
+				}
+				resampled.Readings = append(resampled.Readings, queryReading{
+					Start:         queryTimestamp(bucket),
+					End:           queryTimestamp(end),
+					QualityMethod: readings[i].QualityMethod,
+				})
+			}
+
+			queryReading := &resampled.Readings[len(resampled.Readings)-1]
+			queryReading.Count++
+			if queryReading.QualityMethod != readings[i].QualityMethod {
+				queryReading.QualityMethod = "V"
+			}
+			value += readings[i].Value
+			total += readings[i].Value
+		}
+		if len(resampled.Readings) > 0 {
+			resampled.Readings[len(resampled.Readings)-1].Consumption = queryNumber(value)
+		}
+		resampled.Total = queryNumber(total)
+
+		result = append(result, resampled)
+	}
+
+	return result, nil
+}
+
+func (queryServer *QueryServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writer.Header().Set("Allow", http.MethodGet)
+		http.Error(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var response any
+	var err error
+	switch request.URL.Path {
+	case "/series":
+		var series []StoreSeries
+		series, err = queryServer.series(request)
+		list := make([]map[string]string, 0, len(series))
+		for _, storeSeries := range series {
+			list = append(list, map[string]string{"nmi": storeSeries.Nmi, "nmi_suffix": storeSeries.NmiSuffix, "uom": storeSeries.Uom})
+		}
+		response = map[string]any{"series": list}
+	case "/readings":
+		var series []querySeries
+		series, err = queryServer.readings(request)
+		response = map[string]any{"series": series}
+	default:
+		http.NotFound(writer, request)
+		return
+	}
+
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrInvalidQuery) {
+			status = http.StatusBadRequest
+		}
+		http.Error(writer, err.Error(), status)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(response)
+}
+
+// runQuery runs the query command: an HTTP/JSON query API over a store written by the store sink, until interrupted.
+func runQuery(args []string) error {
+	flagSet := flag.NewFlagSet("query", flag.ExitOnError)
+	listen := flagSet.String("listen", ":8081", "listen on `address`")
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), "Usage: %s query [flags] dir\n", os.Args[0])
+		flagSet.PrintDefaults()
+	}
+	flagSet.Parse(args)
+
+	if flagSet.NArg() != 1 {
+		flagSet.Usage()
+		os.Exit(2)
+	}
+	store, err := OpenStore(flagSet.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Addr:              *listen,
+		Handler:           &QueryServer{Store: store},
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+
+	log.Println("listening on", *listen)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
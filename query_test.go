@@ -0,0 +1,146 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestQueryServer loads files, in order, into a new store.
+func newTestQueryServer(t *testing.T, files ...string) *QueryServer {
+	t.Helper()
+	store, err := OpenStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		summary, err := loadNem12(strings.NewReader(file), "test.csv", store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !summary.Loaded {
+			t.Fatalf("not loaded: %v", summary.Errors)
+		}
+	}
+	return &QueryServer{Store: store}
+}
+
+func getQuery(t *testing.T, queryServer *QueryServer, target string) (int, []querySeries) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	queryServer.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+	var response struct {
+		Series []querySeries `json:"series"`
+	}
+	if recorder.Code == http.StatusOK {
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return recorder.Code, response.Series
+}
+
+func TestQueryServerReadings(t *testing.T) {
+	queryServer := newTestQueryServer(t, testNem12(
+		testHeaderLine,
+		testBlockLine("NEM1201009", "E1"),
+		testDayLine("20050301", "1", ""),
+		"400,1,2,S53,,",
+		testDayLine("20050302", "2", ""),
+		testBlockLine("NEM1201010", "E1"),
+		testDayLine("20050301", "0.5", ""),
+		"900",
+	))
+
+	type reading struct {
+		start         string
+		consumption   string
+		count         int
+		qualityMethod string
+	}
+	tests := []struct {
+		name     string
+		query    string
+		status   int
+		total    string
+		readings []reading // Of NEM1201009 E1.
+	}{
+		{"day", "nmi=NEM1201009&interval=day", http.StatusOK, "144", []reading{
+			{"2005-03-01T00:00:00+10:00", "48", 48, "V"},
+			{"2005-03-02T00:00:00+10:00", "96", 48, "A"},
+		}},
+		{"month", "nmi=NEM1201009&interval=month", http.StatusOK, "144", []reading{
+			{"2005-03-01T00:00:00+10:00", "144", 96, "V"},
+		}},
+		{"hours of a day", "nmi=NEM1201009&interval=1h&from=2005-03-01&to=2005-03-01T02:00", http.StatusOK, "4", []reading{
+			{"2005-03-01T00:00:00+10:00", "2", 2, "S53"},
+			{"2005-03-01T01:00:00+10:00", "2", 2, "A"},
+		}},
+		{"stored intervals", "nmi=NEM1201009&from=2005-03-02T23:00", http.StatusOK, "4", []reading{
+			{"2005-03-02T23:00:00+10:00", "2", 1, "A"},
+			{"2005-03-02T23:30:00+10:00", "2", 1, "A"},
+		}},
+		{"90 minutes", "nmi=NEM1201009&interval=90m&from=2005-03-02&to=2005-03-02T03:00", http.StatusOK, "12", []reading{
+			{"2005-03-02T00:00:00+10:00", "6", 3, "A"},
+			{"2005-03-02T01:30:00+10:00", "6", 3, "A"},
+		}},
+		{"finer than the readings", "interval=15m", http.StatusBadRequest, "", nil},
+		{"straddling the readings", "interval=45m", http.StatusBadRequest, "", nil},
+		{"not dividing a day", "interval=7m", http.StatusBadRequest, "", nil},
+		{"bad time", "from=2005-03", http.StatusBadRequest, "", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, series := getQuery(t, queryServer, "/readings?"+test.query)
+			if status != test.status {
+				t.Fatalf("got status %d, want %d", status, test.status)
+			}
+			if status != http.StatusOK {
+				return
+			}
+			if len(series) != 1 || series[0].Nmi != "NEM1201009" {
+				t.Fatalf("got series %+v", series)
+			}
+			if string(series[0].Total) != test.total {
+				t.Errorf("got total %s, want %s", series[0].Total, test.total)
+			}
+			if len(series[0].Readings) != len(test.readings) {
+				t.Fatalf("got %d readings, want %d: %+v", len(series[0].Readings), len(test.readings), series[0].Readings)
+			}
+			for i, want := range test.readings {
+				got := series[0].Readings[i]
+				if got.Start != want.start || string(got.Consumption) != want.consumption || got.Count != want.count || got.QualityMethod != want.qualityMethod {
+					t.Errorf("reading %d: got %+v, want %+v", i, got, want)
+				}
+			}
+		})
+	}
+
+	if status, series := getQuery(t, queryServer, "/series"); status != http.StatusOK || len(series) != 2 {
+		t.Errorf("got status %d and %d series, want 200 and 2", status, len(series))
+	}
+}
+
+// TestQueryServerReplacedReadings loads a day again, which replaces its readings.
+func TestQueryServerReplacedReadings(t *testing.T) {
+	block := testBlockLine("NEM1201009", "E1")
+	queryServer := newTestQueryServer(t,
+		testNem12(testHeaderLine, block, testDayLine("20050301", "1", ""), testDayLine("20050302", "1", ""), "900"),
+		testNem12(testHeaderLine, block, testDayLine("20050302", "3", ""), "900"),
+	)
+
+	_, series := getQuery(t, queryServer, "/readings?interval=day")
+	if len(series) != 1 || len(series[0].Readings) != 2 {
+		t.Fatalf("got %+v", series)
+	}
+	if got := series[0].Readings[1]; got.Consumption != "144" || got.Count != 48 {
+		t.Errorf("got %+v, want the 48 readings loaded last", got)
+	}
+	if series[0].Total != "192" {
+		t.Errorf("got total %s, want 192", series[0].Total)
+	}
+}
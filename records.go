@@ -0,0 +1,230 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/Cheejyg/Flo-Energy-Tech-Assessment/nem12"
+)
+
+var ErrUnexpectedRecord = errors.New("unexpected record")
+
+// Nem12Day is a 300 record with the 400 and 500 records that follow it, as lines without their line endings.
+type Nem12Day struct {
+	IntervalData *nem12.IntervalDataRecord
+	Lines        [][]byte
+}
+
+// Nem12Block is a 200 record with the days that follow it.
+type Nem12Block struct {
+	NmiDataDetails *nem12.NmiDataDetailsRecord
+	Nmi            string
+	NmiSuffix      string
+	Line           []byte
+	Days           []*Nem12Day
+}
+
+// Size returns the size of the block's records as written, line endings included.
+func (block *Nem12Block) Size() int64 {
+	size := int64(len(block.Line) + 1)
+	for _, day := range block.Days {
+		size += day.Size()
+	}
+	return size
+}
+func (day *Nem12Day) Size() int64 {
+	var size int64
+	for _, line := range day.Lines {
+		size += int64(len(line) + 1)
+	}
+	return size
+}
+
+// Nem12Reader reads a NEM12 file block by block: each 200 record with its days. Header is the 100 record, parsed and as read, once it has been read.
+type Nem12Reader struct {
+	Header     *nem12.HeaderRecord
+	HeaderLine []byte
+	LineNumber int
+	Records    map[string]int // Records read, by record indicator.
+
+	reader         *bufio.Reader
+	current        *Nem12Block
+	intervalLength int
+	eof            bool
+}
+
+func NewNem12Reader(reader io.Reader) *Nem12Reader {
+	return &Nem12Reader{
+		reader:         bufio.NewReaderSize(reader, 1<<20),
+		intervalLength: 30,
+		Records:        make(map[string]int, 6),
+	}
+}
+
+// Next returns the next block once its days have been read, or io.EOF after the last one.
+func (nem12Reader *Nem12Reader) Next() (*Nem12Block, error) {
+	for !nem12Reader.eof {
+		line, err := nem12Reader.reader.ReadBytes('\n')
+		if err == io.EOF {
+			nem12Reader.eof = true
+		} else if err != nil {
+			return nil, err
+		}
+		nem12Reader.LineNumber++
+
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) < 3 {
+			continue
+		}
+		nem12Reader.Records[string(line[:3])]++
+		block, err := nem12Reader.readRecord(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", nem12Reader.LineNumber, err)
+		}
+		if block != nil {
+			return block, nil
+		}
+	}
+
+	if nem12Reader.Header == nil {
+		return nil, ErrMissingHeader
+	}
+	if block := nem12Reader.current; block != nil {
+		nem12Reader.current = nil
+		return block, nil
+	}
+	return nil, io.EOF
+}
+
+// readRecord reads one record, and returns the previous block if the record starts another.
+func (nem12Reader *Nem12Reader) readRecord(line []byte) (*Nem12Block, error) {
+	record := lineSplit(&line, COMMA, &nem12Reader.intervalLength)
+	current := nem12Reader.current
+
+	switch {
+	case bytes.Equal(record[0], nem12.RecordIndicatorHeaderBytes):
+		if len(record) < 5 {
+			return nil, nem12.ErrInvalidHeaderRecord
+		}
+		headerRecord, err := nem12.ParseHeaderRecord(record)
+		if err != nil {
+			return nil, err
+		}
+		nem12Reader.Header, nem12Reader.HeaderLine = headerRecord, line
+	case bytes.Equal(record[0], nem12.RecordIndicatorNmiDataDetailsBytes):
+		if nem12Reader.Header == nil {
+			return nil, ErrMissingHeader
+		}
+		if len(record) < 9 {
+			return nil, nem12.ErrInvalidNmiDataDetailsRecord
+		}
+		nmiDataDetailsRecord, err := nem12.ParseNmiDataDetailsRecord(record)
+		if err != nil {
+			return nil, err
+		}
+		length, err := strconv.Atoi(nem12.ParseByteString(nmiDataDetailsRecord.IntervalLength[:]))
+		if err != nil || length <= 0 || 1440%length != 0 {
+			return nil, nem12.ErrInvalidNmiDataDetailsRecord
+		}
+		nem12Reader.intervalLength = length
+
+		nem12Reader.current = &Nem12Block{
+			NmiDataDetails: nmiDataDetailsRecord,
+			Nmi:            nem12.ParseByteString(nmiDataDetailsRecord.Nmi[:]),
+			NmiSuffix:      nem12.ParseByteString(nmiDataDetailsRecord.NmiSuffix[:]),
+			Line:           line,
+		}
+		return current, nil
+	case bytes.Equal(record[0], nem12.RecordIndicatorIntervalDataBytes):
+		if current == nil {
+			return nil, ErrUnexpectedRecord
+		}
+		if len(record) < 3+1440/nem12Reader.intervalLength {
+			return nil, nem12.ErrInvalidIntervalDataRecord
+		}
+		intervalDataRecord, err := nem12.ParseIntervalDataRecord(record, nem12Reader.intervalLength)
+		if err != nil {
+			return nil, err
+		}
+		current.Days = append(current.Days, &Nem12Day{IntervalData: intervalDataRecord, Lines: [][]byte{line}})
+	case bytes.Equal(record[0], nem12.RecordIndicatorIntervalEventBytes), bytes.Equal(record[0], nem12.RecordIndicatorB2bDetailsBytes):
+		if current == nil || len(current.Days) == 0 {
+			return nil, ErrUnexpectedRecord
+		}
+		if bytes.Equal(record[0], nem12.RecordIndicatorIntervalEventBytes) && len(record) < 6 {
+			return nil, nem12.ErrInvalidIntervalEventRecord
+		}
+		if bytes.Equal(record[0], nem12.RecordIndicatorB2bDetailsBytes) && (len(record) < 2 || len(record[1]) == 0) {
+			return nil, nem12.ErrInvalidB2bDetailsRecord
+		}
+		day := current.Days[len(current.Days)-1]
+		day.Lines = append(day.Lines, line)
+	case bytes.Equal(record[0], nem12.RecordIndicatorEndOfDataBytes):
+		break
+	default:
+		break
+	}
+
+	return nil, nil
+}
+
+// appendHeaderRecord appends a 100 record for a NEM12 file created at datetime, in market time.
+func appendHeaderRecord(b []byte, datetime time.Time, fromParticipant string, toParticipant string) []byte {
+	b = append(b, nem12.RecordIndicatorHeaderString...)
+	b = append(b, ",NEM12,"...)
+	b = datetime.AppendFormat(b, "200601021504")
+	b = append(b, COMMA)
+	b = append(b, fromParticipant...)
+	b = append(b, COMMA)
+	b = append(b, toParticipant...)
+	return b
+}
+
+// Nem12Writer writes a NEM12 file: the 100 record, then blocks, then the 900 record on Close. Size counts the bytes written.
+type Nem12Writer struct {
+	writer *bufio.Writer
+	Size   int64
+}
+
+func NewNem12Writer(writer io.Writer, headerLine []byte) (*Nem12Writer, error) {
+	nem12Writer := &Nem12Writer{writer: bufio.NewWriterSize(writer, 1<<20)}
+	if err := nem12Writer.WriteLine(headerLine); err != nil {
+		return nil, err
+	}
+	return nem12Writer, nil
+}
+func (nem12Writer *Nem12Writer) WriteLine(line []byte) error {
+	nem12Writer.Size += int64(len(line) + 1)
+	if _, err := nem12Writer.writer.Write(line); err != nil {
+		return err
+	}
+	return nem12Writer.writer.WriteByte('\n')
+}
+func (nem12Writer *Nem12Writer) WriteBlock(block *Nem12Block) error {
+	if err := nem12Writer.WriteLine(block.Line); err != nil {
+		return err
+	}
+	for _, day := range block.Days {
+		for _, line := range day.Lines {
+			if err := nem12Writer.WriteLine(line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close writes the 900 record and flushes. It does not close the underlying writer.
+func (nem12Writer *Nem12Writer) Close() error {
+	if err := nem12Writer.WriteLine(nem12.RecordIndicatorEndOfDataBytes); err != nil {
+		return err
+	}
+	return nem12Writer.writer.Flush()
+}
@@ -0,0 +1,289 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Cheejyg/Flo-Energy-Tech-Assessment/nem12"
+)
+
+const testHeaderLine = "100,NEM12,200506081149,UNITEDDP,NEMMCO"
+
+// testNem12 joins lines into a NEM12 file.
+func testNem12(lines ...string) string {
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// testBlockLine returns a 200 record of 30-minute intervals.
+func testBlockLine(nmi string, nmiSuffix string) string {
+	return "200," + nmi + ",E1B1," + nmiSuffix[1:] + "," + nmiSuffix + ",N1,01009,kWh,30,20050610"
+}
+
+// testDayLine returns a 300 record of 30-minute intervals all of value, updated at updateDateTime if not empty.
+func testDayLine(date string, value string, updateDateTime string) string {
+	return "300," + date + strings.Repeat(","+value, 48) + ",A,,," + updateDateTime + ","
+}
+
+func TestNem12Reader(t *testing.T) {
+	type block struct {
+		nmi       string
+		nmiSuffix string
+		days      []int // Lines of each day.
+	}
+	tests := []struct {
+		name    string
+		file    string
+		blocks  []block
+		records map[string]int
+		err     error
+	}{
+		{"blocks", testNem12(
+			testHeaderLine,
+			testBlockLine("NEM1201009", "E1"),
+			testDayLine("20050301", "1", "20050310121004"),
+			testDayLine("20050302", "1", "20050310121004"),
+			"400,1,20,A,,",
+			"400,21,48,S53,32,",
+			"500,O,S01009,20050310121004,",
+			testBlockLine("NEM1201009", "B1"),
+			testDayLine("20050301", "0.5", ""),
+			"900",
+		), []block{{"NEM1201009", "E1", []int{1, 4}}, {"NEM1201009", "B1", []int{1}}}, map[string]int{"100": 1, "200": 2, "300": 3, "400": 2, "500": 1, "900": 1}, nil},
+		{"CRLF and blank lines", strings.ReplaceAll(testNem12(
+			testHeaderLine,
+			"",
+			testBlockLine("NEM1201010", "E1"),
+			testDayLine("20050301", "1", ""),
+			"900",
+		), "\n", "\r\n"), []block{{"NEM1201010", "E1", []int{1}}}, map[string]int{"100": 1, "200": 1, "300": 1, "900": 1}, nil},
+		{"no 900", testNem12(
+			testHeaderLine,
+			testBlockLine("NEM1201010", "E1"),
+			testDayLine("20050301", "1", ""),
+		), []block{{"NEM1201010", "E1", []int{1}}}, map[string]int{"100": 1, "200": 1, "300": 1}, nil},
+		{"block without days", testNem12(
+			testHeaderLine,
+			testBlockLine("NEM1201010", "E1"),
+			"900",
+		), []block{{"NEM1201010", "E1", nil}}, map[string]int{"100": 1, "200": 1, "900": 1}, nil},
+		{"empty", "", nil, nil, ErrMissingHeader},
+		{"200 before 100", testNem12(testBlockLine("NEM1201010", "E1")), nil, nil, ErrMissingHeader},
+		{"300 before 200", testNem12(testHeaderLine, testDayLine("20050301", "1", "")), nil, nil, ErrUnexpectedRecord},
+		{"400 before 300", testNem12(testHeaderLine, testBlockLine("NEM1201010", "E1"), "400,1,48,A,,"), nil, nil, ErrUnexpectedRecord},
+		{"short 100", testNem12("100,NEM12"), nil, nil, nem12.ErrInvalidHeaderRecord},
+		{"short 200", testNem12(testHeaderLine, "200,NEM1201010,E1"), nil, nil, nem12.ErrInvalidNmiDataDetailsRecord},
+		{"interval length not dividing a day", testNem12(testHeaderLine, strings.Replace(testBlockLine("NEM1201010", "E1"), ",30,", ",7,", 1)), nil, nil, nem12.ErrInvalidNmiDataDetailsRecord},
+		{"short 300", testNem12(testHeaderLine, testBlockLine("NEM1201010", "E1"), "300,20050301,1,2,3"), nil, nil, nem12.ErrInvalidIntervalDataRecord},
+		{"bare 100", testNem12("100"), nil, nil, nem12.ErrInvalidHeaderRecord},
+		{"bare 200", testNem12(testHeaderLine, "200"), nil, nil, nem12.ErrInvalidNmiDataDetailsRecord},
+		{"bare 200 without a newline", testHeaderLine + "\n200", nil, nil, nem12.ErrInvalidNmiDataDetailsRecord},
+		{"bare 300", testNem12(testHeaderLine, testBlockLine("NEM1201010", "E1"), "300"), nil, nil, nem12.ErrInvalidIntervalDataRecord},
+		{"bare 400", testNem12(testHeaderLine, testBlockLine("NEM1201010", "E1"), testDayLine("20050301", "1", ""), "400"), nil, nil, nem12.ErrInvalidIntervalEventRecord},
+		{"bare 500", testNem12(testHeaderLine, testBlockLine("NEM1201010", "E1"), testDayLine("20050301", "1", ""), "500\r"), nil, nil, nem12.ErrInvalidB2bDetailsRecord},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nem12Reader := NewNem12Reader(strings.NewReader(test.file))
+			var blocks []*Nem12Block
+			var err error
+			for {
+				var block *Nem12Block
+				if block, err = nem12Reader.Next(); err != nil {
+					break
+				}
+				blocks = append(blocks, block)
+			}
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("got %v, want %v", err, test.err)
+				}
+				return
+			}
+			if err != io.EOF {
+				t.Fatalf("got %v, want io.EOF", err)
+			}
+
+			if string(nem12Reader.HeaderLine) != testHeaderLine {
+				t.Errorf("got header line %q", nem12Reader.HeaderLine)
+			}
+			if len(blocks) != len(test.blocks) {
+				t.Fatalf("got %d blocks, want %d", len(blocks), len(test.blocks))
+			}
+			for i, want := range test.blocks {
+				if blocks[i].Nmi != want.nmi || blocks[i].NmiSuffix != want.nmiSuffix {
+					t.Errorf("block %d: got %s %s, want %s %s", i, blocks[i].Nmi, blocks[i].NmiSuffix, want.nmi, want.nmiSuffix)
+				}
+				if len(blocks[i].Days) != len(want.days) {
+					t.Fatalf("block %d: got %d days, want %d", i, len(blocks[i].Days), len(want.days))
+				}
+				for j, day := range blocks[i].Days {
+					if len(day.Lines) != want.days[j] {
+						t.Errorf("block %d day %d: got %d lines, want %d", i, j, len(day.Lines), want.days[j])
+					}
+				}
+			}
+			if len(nem12Reader.Records) != len(test.records) {
+				t.Errorf("got records %v, want %v", nem12Reader.Records, test.records)
+			}
+			for recordIndicator, want := range test.records {
+				if got := nem12Reader.Records[recordIndicator]; got != want {
+					t.Errorf("%s records: got %d, want %d", recordIndicator, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNem12ReaderErrorLine(t *testing.T) {
+	nem12Reader := NewNem12Reader(strings.NewReader(testNem12(testHeaderLine, testBlockLine("NEM1201010", "E1"), "300,20050301,1")))
+	if _, err := nem12Reader.Next(); err == nil || !strings.HasPrefix(err.Error(), "line 3: ") {
+		t.Errorf("got %v, want an error on line 3", err)
+	}
+}
+
+// TestNem12Writer reads files block by block and writes them back unchanged.
+func TestNem12Writer(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+	}{
+		{"no blocks", testNem12(testHeaderLine, "900")},
+		{"blocks", testNem12(
+			testHeaderLine,
+			testBlockLine("NEM1201009", "E1"),
+			testDayLine("20050301", "1", "20050310121004"),
+			"400,1,48,E52,,",
+			"500,O,S01009,20050310121004,",
+			testBlockLine("NEM1201009", "B1"),
+			testDayLine("20050301", "0.5", ""),
+			testDayLine("20050302", "0.5", ""),
+			"900",
+		)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nem12Reader := NewNem12Reader(strings.NewReader(test.file))
+			var blocks []*Nem12Block
+			for {
+				block, err := nem12Reader.Next()
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatal(err)
+				}
+				blocks = append(blocks, block)
+			}
+
+			var buffer bytes.Buffer
+			nem12Writer, err := NewNem12Writer(&buffer, nem12Reader.HeaderLine)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, block := range blocks {
+				if err := nem12Writer.WriteBlock(block); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := nem12Writer.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if buffer.String() != test.file {
+				t.Errorf("got\n%s\nwant\n%s", buffer.String(), test.file)
+			}
+			if nem12Writer.Size != int64(len(test.file)) {
+				t.Errorf("got size %d, want %d", nem12Writer.Size, len(test.file))
+			}
+			var size int64
+			for _, block := range blocks {
+				size += block.Size()
+			}
+			if want := int64(len(test.file) - len(testHeaderLine+"\n900\n")); size != want {
+				t.Errorf("got block size %d, want %d", size, want)
+			}
+		})
+	}
+}
+
+func TestNem12Merger(t *testing.T) {
+	blockE1 := testBlockLine("NEM1201009", "E1")
+	tests := []struct {
+		name  string
+		files []string
+		want  string
+	}{
+		{"newer wins", []string{
+			testNem12(testHeaderLine, blockE1, testDayLine("20050301", "2", "20050312000000"), "900"),
+			testNem12(testHeaderLine, blockE1, testDayLine("20050301", "1", "20050310000000"), "900"),
+		}, testNem12(testHeaderLine, blockE1, testDayLine("20050301", "2", "20050312000000"), "900")},
+		{"equally new, last added wins", []string{
+			testNem12(testHeaderLine, blockE1, testDayLine("20050301", "1", "20050310000000"), "900"),
+			testNem12(testHeaderLine, blockE1, testDayLine("20050301", "2", "20050310000000"), "900"),
+		}, testNem12(testHeaderLine, blockE1, testDayLine("20050301", "2", "20050310000000"), "900")},
+		{"without UpdateDateTime loses", []string{
+			testNem12(testHeaderLine, blockE1, testDayLine("20050301", "1", "20050310000000"), "900"),
+			testNem12(testHeaderLine, blockE1, testDayLine("20050301", "2", ""), "900"),
+		}, testNem12(testHeaderLine, blockE1, testDayLine("20050301", "1", "20050310000000"), "900")},
+		{"400 and 500 records follow their day", []string{
+			testNem12(testHeaderLine, blockE1, testDayLine("20050301", "1", "20050310000000"), "400,1,48,E52,,", "900"),
+			testNem12(testHeaderLine, blockE1, testDayLine("20050301", "2", "20050311000000"), "500,O,S01009,20050311000000,", "900"),
+		}, testNem12(testHeaderLine, blockE1, testDayLine("20050301", "2", "20050311000000"), "500,O,S01009,20050311000000,", "900")},
+		{"sorted by NMI, suffix and date", []string{
+			testNem12(testHeaderLine,
+				testBlockLine("NEM1201010", "E1"), testDayLine("20050302", "4", ""),
+				blockE1, testDayLine("20050302", "2", ""),
+			),
+			testNem12(testHeaderLine,
+				testBlockLine("NEM1201009", "B1"), testDayLine("20050301", "3", ""),
+				blockE1, testDayLine("20050301", "1", ""),
+			),
+		}, testNem12(testHeaderLine,
+			testBlockLine("NEM1201009", "B1"), testDayLine("20050301", "3", ""),
+			blockE1, testDayLine("20050301", "1", ""), testDayLine("20050302", "2", ""),
+			testBlockLine("NEM1201010", "E1"), testDayLine("20050302", "4", ""),
+			"900",
+		)},
+		{"200 record written again where it changes", []string{
+			testNem12(testHeaderLine, blockE1, testDayLine("20050301", "1", ""), testDayLine("20050302", "1", ""), testDayLine("20050303", "1", "")),
+			testNem12(testHeaderLine, strings.Replace(blockE1, ",01009,", ",01011,", 1), testDayLine("20050302", "2", "20050310000000")),
+		}, testNem12(testHeaderLine,
+			blockE1, testDayLine("20050301", "1", ""),
+			strings.Replace(blockE1, ",01009,", ",01011,", 1), testDayLine("20050302", "2", "20050310000000"),
+			blockE1, testDayLine("20050303", "1", ""),
+			"900",
+		)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			merger := NewNem12Merger()
+			for _, file := range test.files {
+				if err := merger.Add(strings.NewReader(file)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if merger.Header == nil {
+				t.Fatal("no header")
+			}
+
+			var buffer bytes.Buffer
+			if err := merger.WriteTo(&buffer, []byte(testHeaderLine)); err != nil {
+				t.Fatal(err)
+			}
+			if buffer.String() != test.want {
+				t.Errorf("got\n%s\nwant\n%s", buffer.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestNem12MergerInvalidFile(t *testing.T) {
+	merger := NewNem12Merger()
+	if err := merger.Add(strings.NewReader(testNem12(testHeaderLine, testDayLine("20050301", "1", "")))); !errors.Is(err, ErrUnexpectedRecord) {
+		t.Errorf("got %v, want %v", err, ErrUnexpectedRecord)
+	}
+}
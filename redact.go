@@ -0,0 +1,350 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Cheejyg/Flo-Energy-Tech-Assessment/nem12"
+)
+
+var ErrPseudonymCollision = errors.New("pseudonym collision")
+var ErrReservedNmiPrefix = errors.New("NMI starts with the character reserved for pseudonyms")
+
+const (
+	redactNmi             = "nmi"
+	redactMeterSerial     = "meter_serial_number"
+	redactRetServiceOrder = "ret_service_order"
+)
+
+// redactDescription replaces ReasonDescriptions, which are free text.
+const redactDescription = "Redacted"
+
+// redactNmiPrefix starts every NMI pseudonym, and no NMI that is redacted, so a pseudonym is a well-formed NMI that can never be mistaken for a real one.
+const redactNmiPrefix = "Z"
+
+// redactChecksums is the file written alongside the redacted files with the checksum digit of each NMI pseudonym.
+const redactChecksums = "nmi_checksums.csv"
+
+// Redactor rewrites NEM12 files with keyed pseudonyms for NMIs, MeterSerialNumbers and RetServiceOrders, and optionally shifts their dates by ShiftDays.
+//
+// A pseudonym is derived from the value with HMAC-SHA256 under the key, so the same key maps a value to the same pseudonym in every file, and without the key pseudonyms cannot be traced back. Pseudonyms are 10 characters of the NMI alphabet, and NMI pseudonyms start with redactNmiPrefix, which the NMIs redacted may not; NEM12 does not carry their checksum digits, so WriteChecksums writes them to share with the files. ReasonDescriptions, which are free text, are replaced.
+type Redactor struct {
+	ShiftDays int
+	Mapping   map[string]map[string]string // Pseudonyms by kind and value.
+
+	key        []byte
+	pseudonyms map[string]string // Values by kind and pseudonym.
+}
+
+func NewRedactor(key []byte, shiftDays int) *Redactor {
+	return &Redactor{
+		ShiftDays:  shiftDays,
+		Mapping:    map[string]map[string]string{redactNmi: {}, redactMeterSerial: {}, redactRetServiceOrder: {}},
+		key:        key,
+		pseudonyms: make(map[string]string, 1024),
+	}
+}
+
+func (redactor *Redactor) pseudonym(kind string, value []byte) ([]byte, error) {
+	if len(value) == 0 {
+		return value, nil
+	}
+	if pseudonym, ok := redactor.Mapping[kind][string(value)]; ok {
+		return []byte(pseudonym), nil
+	}
+	if kind == redactNmi && bytes.HasPrefix(value, []byte(redactNmiPrefix)) {
+		return nil, fmt.Errorf("%w %s: %s", ErrReservedNmiPrefix, redactNmiPrefix, value)
+	}
+
+	mac := hmac.New(sha256.New, redactor.key)
+	mac.Write([]byte(kind))
+	mac.Write([]byte{0})
+	mac.Write(value)
+	sum := mac.Sum(nil)
+	pseudonym := make([]byte, 10)
+	prefix := 0
+	if kind == redactNmi {
+		prefix = copy(pseudonym, redactNmiPrefix)
+	}
+	for i := prefix; i < len(pseudonym); i++ {
+		pseudonym[i] = nem12.NmiAlphabet[int(sum[i])%len(nem12.NmiAlphabet)]
+	}
+
+	if original, ok := redactor.pseudonyms[kind+"\x00"+string(pseudonym)]; ok && original != string(value) {
+		return nil, fmt.Errorf("%w: %s %s", ErrPseudonymCollision, kind, pseudonym)
+	}
+	redactor.pseudonyms[kind+"\x00"+string(pseudonym)] = string(value)
+	redactor.Mapping[kind][string(value)] = string(pseudonym)
+
+	return pseudonym, nil
+}
+
+// shift shifts a date or datetime field in layout by ShiftDays.
+func (redactor *Redactor) shift(field []byte, layout string) ([]byte, error) {
+	if len(field) == 0 || redactor.ShiftDays == 0 {
+		return field, nil
+	}
+	t, err := time.Parse(layout, string(field))
+	if err != nil {
+		return nil, nem12.ErrInvalidDateTime
+	}
+	return t.AddDate(0, 0, redactor.ShiftDays).AppendFormat(nil, layout), nil
+}
+
+// redactFields rewrites the fields of a line.
+func redactFields(line []byte, rewrite func(fields [][]byte) error) ([]byte, error) {
+	fields := bytes.Split(line, []byte{COMMA})
+	if err := rewrite(fields); err != nil {
+		return nil, err
+	}
+	return bytes.Join(fields, []byte{COMMA}), nil
+}
+
+func (redactor *Redactor) redactBlock(block *Nem12Block) error {
+	var err error
+	block.Line, err = redactFields(block.Line, func(fields [][]byte) error {
+		if fields[1], err = redactor.pseudonym(redactNmi, fields[1]); err != nil {
+			return err
+		}
+		if fields[6], err = redactor.pseudonym(redactMeterSerial, fields[6]); err != nil {
+			return err
+		}
+		if len(fields) > 9 {
+			fields[9], err = redactor.shift(fields[9], "20060102")
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	intervalLength, err := strconv.Atoi(nem12.ParseByteString(block.NmiDataDetails.IntervalLength[:]))
+	if err != nil || intervalLength <= 0 || 1440%intervalLength != 0 {
+		return nem12.ErrInvalidNmiDataDetailsRecord
+	}
+	n := 1440 / intervalLength
+	for _, day := range block.Days {
+		for i, line := range day.Lines {
+			switch {
+			case bytes.HasPrefix(line, nem12.RecordIndicatorIntervalDataBytes):
+				line, err = redactFields(line, func(fields [][]byte) error {
+					if fields[1], err = redactor.shift(fields[1], "20060102"); err != nil {
+						return err
+					}
+					if len(fields) > n+4 && len(fields[n+4]) > 0 {
+						fields[n+4] = []byte(redactDescription)
+					}
+					for j := n + 5; j <= n+6 && j < len(fields); j++ {
+						if fields[j], err = redactor.shift(fields[j], "20060102150405"); err != nil {
+							return err
+						}
+					}
+					return nil
+				})
+			case bytes.HasPrefix(line, nem12.RecordIndicatorIntervalEventBytes):
+				line, err = redactFields(line, func(fields [][]byte) error {
+					if len(fields) > 5 && len(fields[5]) > 0 {
+						fields[5] = []byte(redactDescription)
+					}
+					return nil
+				})
+			case bytes.HasPrefix(line, nem12.RecordIndicatorB2bDetailsBytes):
+				line, err = redactFields(line, func(fields [][]byte) error {
+					if len(fields) > 2 {
+						if fields[2], err = redactor.pseudonym(redactRetServiceOrder, fields[2]); err != nil {
+							return err
+						}
+					}
+					if len(fields) > 3 {
+						fields[3], err = redactor.shift(fields[3], "20060102150405")
+					}
+					return err
+				})
+			}
+			if err != nil {
+				return err
+			}
+			day.Lines[i] = line
+		}
+	}
+
+	return nil
+}
+
+// Redact reads a NEM12 file and writes it redacted.
+func (redactor *Redactor) Redact(reader io.Reader, writer io.Writer) error {
+	nem12Reader := NewNem12Reader(reader)
+	var nem12Writer *Nem12Writer
+	for {
+		block, err := nem12Reader.Next()
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if nem12Writer == nil {
+			headerLine, err := redactFields(nem12Reader.HeaderLine, func(fields [][]byte) (err error) {
+				fields[2], err = redactor.shift(fields[2], "200601021504")
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			if nem12Writer, err = NewNem12Writer(writer, headerLine); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+
+		if err := redactor.redactBlock(block); err != nil {
+			return fmt.Errorf("%s %s: %w", block.Nmi, block.NmiSuffix, err)
+		}
+		if err := nem12Writer.WriteBlock(block); err != nil {
+			return err
+		}
+	}
+
+	return nem12Writer.Close()
+}
+
+// WriteMapping writes Mapping as CSV, with the checksum digit of NMI pseudonyms.
+func (redactor *Redactor) WriteMapping(writer io.Writer) error {
+	var b []byte
+	b = append(b, "kind,value,pseudonym,checksum\n"...)
+	for _, kind := range []string{redactNmi, redactMeterSerial, redactRetServiceOrder} {
+		values := make([]string, 0, len(redactor.Mapping[kind]))
+		for value := range redactor.Mapping[kind] {
+			values = append(values, value)
+		}
+		sort.Strings(values)
+
+		for _, value := range values {
+			pseudonym := redactor.Mapping[kind][value]
+			b = append(b, kind...)
+			b = append(b, COMMA)
+			b = append(b, csvQuote(value)...)
+			b = append(b, COMMA)
+			b = append(b, pseudonym...)
+			b = append(b, COMMA)
+			if kind == redactNmi {
+				b = append(b, nem12.NmiChecksum(pseudonym))
+			}
+			b = append(b, '\n')
+		}
+	}
+
+	_, err := writer.Write(b)
+	return err
+}
+
+// WriteChecksums writes the checksum digit of each NMI pseudonym as CSV. Unlike Mapping, it holds no original values, so it can be shared with the redacted files.
+func (redactor *Redactor) WriteChecksums(writer io.Writer) error {
+	pseudonyms := make([]string, 0, len(redactor.Mapping[redactNmi]))
+	for _, pseudonym := range redactor.Mapping[redactNmi] {
+		pseudonyms = append(pseudonyms, pseudonym)
+	}
+	sort.Strings(pseudonyms)
+
+	var b []byte
+	b = append(b, "nmi,checksum\n"...)
+	for _, pseudonym := range pseudonyms {
+		b = append(b, pseudonym...)
+		b = append(b, COMMA)
+		b = append(b, nem12.NmiChecksum(pseudonym))
+		b = append(b, '\n')
+	}
+
+	_, err := writer.Write(b)
+	return err
+}
+
+// runRedact runs the redact command: NEM12 files rewritten with keyed pseudonyms for sharing.
+func runRedact(args []string) error {
+	flagSet := flag.NewFlagSet("redact", flag.ExitOnError)
+	key := flagSet.String("key", "", "pseudonym `key`; the same key gives the same pseudonyms (default $FLO_REDACT_KEY)")
+	shiftDays := flagSet.Int("shift-days", 0, "shift dates by `days`")
+	dir := flagSet.String("o", "redacted", "write the redacted files to `dir`")
+	mappingName := flagSet.String("mapping", "", "write the pseudonyms to `path` as CSV; it identifies customers, so do not share it")
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), "Usage: %s redact [flags] file...\n", os.Args[0])
+		flagSet.PrintDefaults()
+	}
+	flagSet.Parse(args)
+	if *key == "" {
+		// Not the flag's default, which usage would print.
+		*key = os.Getenv("FLO_REDACT_KEY")
+	}
+
+	if flagSet.NArg() == 0 || *key == "" {
+		flagSet.Usage()
+		os.Exit(2)
+	}
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return err
+	}
+
+	redactor := NewRedactor([]byte(*key), *shiftDays)
+	for _, name := range flagSet.Args() {
+		target := filepath.Join(*dir, filepath.Base(name))
+		if source, err := filepath.Abs(name); err != nil {
+			return err
+		} else if target, err := filepath.Abs(target); err != nil {
+			return err
+		} else if source == target {
+			return fmt.Errorf("%s: would overwrite itself, use -o", name)
+		}
+
+		if err := redactFile(redactor, name, target); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		fmt.Println(target)
+	}
+
+	checksums, err := os.Create(filepath.Join(*dir, redactChecksums))
+	if err != nil {
+		return err
+	}
+	if err := errors.Join(redactor.WriteChecksums(checksums), checksums.Close()); err != nil {
+		return err
+	}
+	fmt.Println(checksums.Name())
+
+	if *mappingName != "" {
+		file, err := os.OpenFile(*mappingName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+		if err != nil {
+			return err
+		}
+		return errors.Join(redactor.WriteMapping(file), file.Close())
+	}
+	return nil
+}
+func redactFile(redactor *Redactor, name string, target string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	output, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if err := errors.Join(redactor.Redact(file, output), output.Close()); err != nil {
+		os.Remove(target)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Cheejyg/Flo-Energy-Tech-Assessment/nem12"
+)
+
+func TestRedactor(t *testing.T) {
+	file := testNem12(
+		testHeaderLine,
+		testBlockLine("NEM1201009", "E1"),
+		"300,20050301"+strings.Repeat(",1", 48)+",V,,,20050310121004,20050311000000",
+		"400,1,48,F52,79,Customer 42 Smith St",
+		"500,O,S01009,20050310121004,",
+		testBlockLine("NEM1201010", "E1"),
+		testDayLine("20050301", "2", ""),
+		"900",
+	)
+	redact := func(key string) (string, *Redactor) {
+		t.Helper()
+		redactor := NewRedactor([]byte(key), 14)
+		var b bytes.Buffer
+		if err := redactor.Redact(strings.NewReader(file), &b); err != nil {
+			t.Fatal(err)
+		}
+		return b.String(), redactor
+	}
+
+	redacted, redactor := redact("key")
+	for _, value := range []string{"NEM1201009", "NEM1201010", "01009", "S01009", "Smith", "20050301", "200506081149"} {
+		if strings.Contains(redacted, value) {
+			t.Errorf("redacted file contains %s:\n%s", value, redacted)
+		}
+	}
+	for _, value := range []string{"200506221149", ",20050315,", ",20050324121004,20050325000000", "400,1,48,F52,79,Redacted", ",20050324121004,"} {
+		if !strings.Contains(redacted, value) {
+			t.Errorf("redacted file does not contain %s:\n%s", value, redacted)
+		}
+	}
+
+	nem12Reader := NewNem12Reader(strings.NewReader(redacted))
+	var nmis []string
+	for {
+		block, err := nem12Reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		nmis = append(nmis, block.Nmi)
+	}
+	if len(nmis) != 2 || nmis[0] == nmis[1] {
+		t.Fatalf("got NMIs %v", nmis)
+	}
+	var checksums bytes.Buffer
+	if err := redactor.WriteChecksums(&checksums); err != nil {
+		t.Fatal(err)
+	}
+	for _, nmi := range nmis {
+		if len(nmi) != 10 || !strings.HasPrefix(nmi, redactNmiPrefix) || strings.Trim(nmi, nem12.NmiAlphabet) != "" {
+			t.Errorf("pseudonym %s is not a 10-character NMI starting with %s", nmi, redactNmiPrefix)
+		}
+		if line := nmi + "," + string(nem12.NmiChecksum(nmi)) + "\n"; !strings.Contains(checksums.String(), line) {
+			t.Errorf("checksums do not contain %q:\n%s", line, checksums.String())
+		}
+	}
+
+	if again, _ := redact("key"); again != redacted {
+		t.Errorf("the same key gave other pseudonyms:\n%s\nthen\n%s", redacted, again)
+	}
+	if other, _ := redact("other key"); strings.Contains(other, nmis[0]) {
+		t.Errorf("another key gave the pseudonym %s", nmis[0])
+	}
+}
+
+func TestRedactorInvalid(t *testing.T) {
+	redactor := NewRedactor([]byte("key"), 0)
+	file := testNem12(testHeaderLine, testBlockLine("ZEM1201009", "E1"), testDayLine("20050301", "1", ""), "900")
+	if err := redactor.Redact(strings.NewReader(file), io.Discard); !errors.Is(err, ErrReservedNmiPrefix) {
+		t.Errorf("got %v for an NMI starting with %s, want %v", err, redactNmiPrefix, ErrReservedNmiPrefix)
+	}
+
+	block, err := NewNem12Reader(strings.NewReader(testNem12(testHeaderLine, testBlockLine("NEM1201009", "E1"), testDayLine("20050301", "1", ""), "900"))).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block.NmiDataDetails.IntervalLength = [2]byte{'0', '0'}
+	if err := redactor.redactBlock(block); !errors.Is(err, nem12.ErrInvalidNmiDataDetailsRecord) {
+		t.Errorf("got %v for an interval length of 0, want %v", err, nem12.ErrInvalidNmiDataDetailsRecord)
+	}
+}
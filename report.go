@@ -0,0 +1,129 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// reportFormat is a report sink's format option: csv by default, or json for a target ending in .json.
+func reportFormat(config *SinkConfig) string {
+	if strings.HasSuffix(config.Target, ".json") {
+		return sinkOption(config.Options, "format", "json")
+	}
+	return sinkOption(config.Options, "format", "csv")
+}
+
+// sortedChannels returns the channels of a report, by NMI, NMI suffix and unit of measure.
+func sortedChannels[V any](channels map[StoreSeries]V) []StoreSeries {
+	sorted := make([]StoreSeries, 0, len(channels))
+	for channel := range channels {
+		sorted = append(sorted, channel)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Nmi != sorted[j].Nmi {
+			return sorted[i].Nmi < sorted[j].Nmi
+		}
+		if sorted[i].NmiSuffix != sorted[j].NmiSuffix {
+			return sorted[i].NmiSuffix < sorted[j].NmiSuffix
+		}
+		return sorted[i].Uom < sorted[j].Uom
+	})
+
+	return sorted
+}
+
+// reportWriter writes the records of a report sink on Close: a JSON array with one object per line, or CSV rows under a header.
+//
+// A record is built with Field before each value and the Append methods, which append JSON values or bare CSV fields, and written with Record.
+type reportWriter struct {
+	*bufio.Writer
+	asJson  bool
+	records int
+}
+
+func newReportWriter(writer io.Writer, format string) (*reportWriter, error) {
+	if format != "csv" && format != "json" {
+		return nil, ErrInvalidAggregateFormat
+	}
+
+	return &reportWriter{
+		Writer: bufio.NewWriterSize(writer, 1<<20),
+		asJson: format == "json",
+	}, nil
+}
+
+// Begin writes the opening bracket, or csvHeader, a comma-separated list of the field names.
+func (reportWriter *reportWriter) Begin(csvHeader string) error {
+	if reportWriter.asJson {
+		return reportWriter.WriteByte('[')
+	}
+	_, err := reportWriter.WriteString(csvHeader + "\n")
+	return err
+}
+
+// Field appends the separator before the value of name.
+func (reportWriter *reportWriter) Field(b []byte, name string) []byte {
+	if !reportWriter.asJson {
+		return append(b, ',')
+	}
+	b = append(b, `,"`...)
+	b = append(b, name...)
+	return append(b, `":`...)
+}
+
+func (reportWriter *reportWriter) AppendNull(b []byte) []byte {
+	if reportWriter.asJson {
+		return append(b, "null"...)
+	}
+	return b
+}
+func (reportWriter *reportWriter) AppendString(b []byte, s string) []byte {
+	if reportWriter.asJson {
+		return appendJsonString(b, s)
+	}
+	return append(b, s...)
+}
+func (reportWriter *reportWriter) AppendDate(b []byte, t time.Time) []byte {
+	if reportWriter.asJson {
+		return appendJsonDate(b, &t)
+	}
+	return t.AppendFormat(b, jsonDateLayout)
+}
+func (reportWriter *reportWriter) AppendTimestamp(b []byte, t time.Time) []byte {
+	if reportWriter.asJson {
+		return appendJsonTimestamp(b, &t)
+	}
+	b = t.AppendFormat(b, jsonTimestampLayout)
+	return append(b, jsonMarketTimeOffset...)
+}
+
+// Record writes one record built with Field, which puts a separator before its first field.
+func (reportWriter *reportWriter) Record(line []byte) error {
+	if reportWriter.asJson {
+		if reportWriter.records > 0 {
+			reportWriter.WriteByte(',')
+		}
+		reportWriter.WriteByte('\n')
+		line[0] = '{'
+		line = append(line, '}')
+	} else {
+		line = append(line[1:], '\n')
+	}
+	reportWriter.records++
+
+	_, err := reportWriter.Write(line)
+	return err
+}
+
+// End writes the closing bracket and flushes the report. It does not close the underlying writer.
+func (reportWriter *reportWriter) End() error {
+	if reportWriter.asJson {
+		reportWriter.WriteString("\n]\n")
+	}
+	return reportWriter.Flush()
+}
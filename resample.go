@@ -0,0 +1,248 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Cheejyg/Flo-Energy-Tech-Assessment/nem12"
+)
+
+const resampleScale int = 6
+
+var ErrCannotResample = errors.New("cannot resample")
+
+// resampleQualityOrder ranks quality flags from best to worst; a resampled interval takes the worst of its readings.
+const resampleQualityOrder string = "AEVSFN"
+
+func resampleQualityRank(qualityMethod string) int {
+	if qualityMethod == "" {
+		return -1
+	}
+	return strings.IndexByte(resampleQualityOrder, qualityMethod[0])
+}
+
+// ParseResampleProfile parses flat, or comma-separated relative weights, one per shorter interval.
+func ParseResampleProfile(profile string) ([]int64, error) {
+	if profile == "" || profile == "flat" {
+		return nil, nil
+	}
+
+	var weights []int64
+	for _, value := range strings.Split(profile, ",") {
+		weight, err := nem12.ParseIntervalValueDecimal([]byte(strings.TrimSpace(value)), resampleScale)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("%w: resample-profile %q, want flat or comma-separated weights", ErrInvalidSinkOption, profile)
+		}
+		weights = append(weights, weight)
+	}
+
+	return weights, nil
+}
+
+// ResampleSink resamples meter readings to Interval before passing them on to Sink.
+//
+// Shorter intervals are summed into Interval, e.g. 5 into 15 or 30 minutes; the result takes the quality method of its readings if they agree, otherwise the worst quality flag, from A to E, V, S, F and N. Longer intervals are split into Interval only if Disaggregate is set: flat, or in proportion to Profile, one weight per shorter interval, keeping the quality method of the reading. Sums and splits are exact to 6 decimal places.
+//
+// Readings of an interval still being summed are held back until the next interval or Close, so Flush does not pass them on.
+type ResampleSink struct {
+	Sink
+	Interval     time.Duration
+	Disaggregate bool
+	Profile      []int64
+
+	pending []*MeterReadingsJob
+	batch   []*MeterReadingsJob
+}
+
+func NewResampleSink(sink Sink, interval time.Duration, disaggregate bool, profile []int64) (*ResampleSink, error) {
+	if interval < time.Minute || (24*time.Hour)%interval != 0 {
+		return nil, fmt.Errorf("%w: resample %s, want a duration dividing a day", ErrInvalidSinkOption, interval)
+	}
+
+	return &ResampleSink{
+		Sink:         sink,
+		Interval:     interval,
+		Disaggregate: disaggregate,
+		Profile:      profile,
+	}, nil
+}
+
+func resampleIntervalNumber(start time.Time, interval time.Duration) int {
+	return int(start.Sub(start.Truncate(24*time.Hour))/interval) + 1
+}
+
+// aggregate sums the pending readings into one of Interval.
+func (resampleSink *ResampleSink) aggregate() error {
+	if len(resampleSink.pending) == 0 {
+		return nil
+	}
+	first := resampleSink.pending[0]
+
+	var total int64
+	worst := first
+	uniform := true
+	for _, job := range resampleSink.pending {
+		value, err := nem12.ParseIntervalValueDecimal(job.Consumption, resampleScale)
+		if err != nil {
+			return err
+		}
+		total += value
+
+		if job.QualityMethod != first.QualityMethod {
+			uniform = false
+		}
+		if resampleQualityRank(job.QualityMethod) > resampleQualityRank(worst.QualityMethod) {
+			worst = job
+		}
+	}
+
+	start := first.Timestamp.Add(-first.IntervalLength).Truncate(resampleSink.Interval)
+	resampled := *first
+	resampled.Timestamp = start.Add(resampleSink.Interval)
+	resampled.IntervalLength = resampleSink.Interval
+	resampled.IntervalNumber = resampleIntervalNumber(start, resampleSink.Interval)
+	resampled.Consumption = appendScaledDecimal(nil, total, resampleScale)
+	resampled.QualityMethod = first.QualityMethod
+	resampled.IntervalEvent = worst.IntervalEvent
+	if !uniform && worst.QualityMethod != "" {
+		resampled.QualityMethod = worst.QualityMethod[:1]
+	}
+
+	resampleSink.batch = append(resampleSink.batch, &resampled)
+	resampleSink.pending = resampleSink.pending[:0]
+
+	return nil
+}
+
+// disaggregate splits job into readings of Interval.
+func (resampleSink *ResampleSink) disaggregate(job *MeterReadingsJob) error {
+	n := int(job.IntervalLength / resampleSink.Interval)
+	weights := resampleSink.Profile
+	if weights == nil {
+		weights = make([]int64, n)
+		for i := range weights {
+			weights[i] = 1
+		}
+	}
+	if len(weights) != n {
+		return fmt.Errorf("%w: resample-profile has %d weights, want %d to split %s into %s", ErrCannotResample, len(weights), n, job.IntervalLength, resampleSink.Interval)
+	}
+	var sum int64
+	for _, weight := range weights {
+		sum += weight
+	}
+	if sum == 0 {
+		return fmt.Errorf("%w: resample-profile weights sum to zero", ErrCannotResample)
+	}
+
+	value, err := nem12.ParseIntervalValueDecimal(job.Consumption, resampleScale)
+	if err != nil {
+		return err
+	}
+
+	start := job.Timestamp.Add(-job.IntervalLength)
+	var allocated int64
+	for i := 0; i < n; i++ {
+		part := value * weights[i] / sum
+		if i == n-1 {
+			part = value - allocated // The rounding remainder, so the parts add up exactly.
+		}
+		allocated += part
+
+		partStart := start.Add(time.Duration(i) * resampleSink.Interval)
+		resampled := *job
+		resampled.Timestamp = partStart.Add(resampleSink.Interval)
+		resampled.IntervalLength = resampleSink.Interval
+		resampled.IntervalNumber = resampleIntervalNumber(partStart, resampleSink.Interval)
+		resampled.Consumption = appendScaledDecimal(nil, part, resampleScale)
+		resampleSink.batch = append(resampleSink.batch, &resampled)
+	}
+
+	return nil
+}
+
+func (resampleSink *ResampleSink) WriteBatch(meterReadingsJob []*MeterReadingsJob) error {
+	resampleSink.batch = resampleSink.batch[:0]
+
+	for _, job := range meterReadingsJob {
+		switch {
+		case job.IntervalLength == resampleSink.Interval:
+			if err := resampleSink.aggregate(); err != nil {
+				return err
+			}
+			resampleSink.batch = append(resampleSink.batch, job)
+		case job.IntervalLength <= 0 || (resampleSink.Interval%job.IntervalLength != 0 && job.IntervalLength%resampleSink.Interval != 0):
+			return fmt.Errorf("%w: %s %s from %s to %s", ErrCannotResample, job.Nmi, job.NmiSuffix, job.IntervalLength, resampleSink.Interval)
+		case job.IntervalLength < resampleSink.Interval:
+			if len(resampleSink.pending) > 0 {
+				last := resampleSink.pending[len(resampleSink.pending)-1]
+				// Intervals of another channel, another bucket or a day sent again are summed separately.
+				if job.Nmi != last.Nmi || job.NmiSuffix != last.NmiSuffix || job.Uom != last.Uom || job.Source != last.Source || job.LineNumber != last.LineNumber || !job.Timestamp.Add(-job.IntervalLength).Truncate(resampleSink.Interval).Equal(last.Timestamp.Add(-last.IntervalLength).Truncate(resampleSink.Interval)) {
+					if err := resampleSink.aggregate(); err != nil {
+						return err
+					}
+				}
+			}
+			resampleSink.pending = append(resampleSink.pending, job)
+		default:
+			if !resampleSink.Disaggregate {
+				return fmt.Errorf("%w: %s %s from %s to %s without resample-profile", ErrCannotResample, job.Nmi, job.NmiSuffix, job.IntervalLength, resampleSink.Interval)
+			}
+			if err := resampleSink.aggregate(); err != nil {
+				return err
+			}
+			if err := resampleSink.disaggregate(job); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(resampleSink.batch) == 0 {
+		return nil
+	}
+	return resampleSink.Sink.WriteBatch(resampleSink.batch)
+}
+
+// WriteB2bDetails passes 500 records through, as they are not interval readings.
+func (resampleSink *ResampleSink) WriteB2bDetails(b2bDetailsJob []*B2bDetailsJob) error {
+	return writeB2bDetails(resampleSink.Sink, b2bDetailsJob)
+}
+func (resampleSink *ResampleSink) Close() error {
+	resampleSink.batch = resampleSink.batch[:0]
+	err := resampleSink.aggregate()
+	if err == nil && len(resampleSink.batch) > 0 {
+		err = resampleSink.Sink.WriteBatch(resampleSink.batch)
+	}
+
+	return errors.Join(err, resampleSink.Sink.Close())
+}
+
+// resampleOptions returns the ResampleSink options, or a zero interval if resample is not set.
+func resampleOptions(resample string, profile string) (time.Duration, bool, []int64, error) {
+	if resample == "" {
+		if profile != "" {
+			return 0, false, nil, fmt.Errorf("%w: resample-profile without resample", ErrInvalidSinkOption)
+		}
+		return 0, false, nil, nil
+	}
+
+	interval, err := time.ParseDuration(resample)
+	if err != nil {
+		minutes, err := strconv.Atoi(resample)
+		if err != nil {
+			return 0, false, nil, fmt.Errorf("%w: resample %q, want a duration", ErrInvalidSinkOption, resample)
+		}
+		interval = time.Duration(minutes) * time.Minute
+	}
+	weights, err := ParseResampleProfile(profile)
+	if err != nil {
+		return 0, false, nil, err
+	}
+
+	return interval, profile != "", weights, nil
+}
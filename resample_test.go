@@ -0,0 +1,129 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseResampleProfile(t *testing.T) {
+	tests := []struct {
+		profile string
+		want    []int64
+		err     error
+	}{
+		{"", nil, nil},
+		{"flat", nil, nil},
+		{"1,2", []int64{1000000, 2000000}, nil},
+		{" 0.5 , 1.25", []int64{500000, 1250000}, nil},
+		{"1,,2", nil, ErrInvalidSinkOption},
+		{"-1,2", nil, ErrInvalidSinkOption},
+		{"peak", nil, ErrInvalidSinkOption},
+	}
+	for _, test := range tests {
+		got, err := ParseResampleProfile(test.profile)
+		if !errors.Is(err, test.err) || !slices.Equal(got, test.want) {
+			t.Errorf("ParseResampleProfile(%q) = %v, %v, want %v, %v", test.profile, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestResampleSink(t *testing.T) {
+	dayLine := strings.Replace(testDayLine("20050301", "0.3", ""), ",A,,,", ",V,,,", 1)
+	file := []byte(testNem12(
+		testHeaderLine,
+		testBlockLine("NEM1201009", "E1"),
+		dayLine,
+		"400,1,1,A,,",
+		"400,2,3,S53,,",
+		"400,4,48,A,,",
+		testDayLine("20050302", "1", ""),
+		testDayLine("20050302", "2", ""), // Sent again, so summed apart from the first.
+		"900",
+	))
+
+	type reading struct {
+		end           string
+		consumption   string
+		qualityMethod string
+	}
+	tests := []struct {
+		name     string
+		interval time.Duration
+		profile  string
+		rows     int
+		want     []reading // The first readings.
+		err      error
+	}{
+		{"hourly", time.Hour, "", 72, []reading{
+			{"2005-03-01T01:00", "0.6", "S"},
+			{"2005-03-01T02:00", "0.6", "S"},
+			{"2005-03-01T03:00", "0.6", "A"},
+		}, nil},
+		{"daily", 24 * time.Hour, "", 3, []reading{
+			{"2005-03-02T00:00", "14.4", "S"},
+			{"2005-03-03T00:00", "48", "A"},
+			{"2005-03-03T00:00", "96", "A"},
+		}, nil},
+		{"same interval", 30 * time.Minute, "", 144, []reading{
+			{"2005-03-01T00:30", "0.3", "A"},
+		}, nil},
+		{"flat", 15 * time.Minute, "flat", 288, []reading{
+			{"2005-03-01T00:15", "0.15", "A"},
+			{"2005-03-01T00:30", "0.15", "A"},
+		}, nil},
+		{"profile", 15 * time.Minute, "1,2", 288, []reading{
+			{"2005-03-01T00:15", "0.1", "A"},
+			{"2005-03-01T00:30", "0.2", "A"},
+			{"2005-03-01T00:45", "0.1", "S53"},
+		}, nil},
+		{"no profile", 15 * time.Minute, "", 0, nil, ErrCannotResample},
+		{"profile of the wrong length", 15 * time.Minute, "1,1,1", 0, nil, ErrCannotResample},
+		{"not a multiple", 45 * time.Minute, "", 0, nil, ErrCannotResample},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			weights, err := ParseResampleProfile(test.profile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sink := &testSink{}
+			resampleSink, err := NewResampleSink(sink, test.interval, test.profile != "", weights)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = resampleSink.WriteBatch(loadTestNem12(t, file).jobs)
+			if err == nil {
+				err = resampleSink.Close()
+			}
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got %v, want %v", err, test.err)
+			}
+			if err != nil {
+				return
+			}
+
+			if len(sink.jobs) != test.rows {
+				t.Errorf("got %d rows, want %d", len(sink.jobs), test.rows)
+			}
+			for i, want := range test.want {
+				job := sink.jobs[i]
+				got := reading{job.Timestamp.Format("2006-01-02T15:04"), string(job.Consumption), job.QualityMethod}
+				if got != want {
+					t.Errorf("reading %d: got %+v, want %+v", i, got, want)
+				}
+				if job.IntervalLength != test.interval {
+					t.Errorf("reading %d: got interval length %s", i, job.IntervalLength)
+				}
+			}
+		})
+	}
+
+	if _, err := NewResampleSink(&testSink{}, 7*time.Minute, false, nil); !errors.Is(err, ErrInvalidSinkOption) {
+		t.Errorf("got %v for 7m, want %v", err, ErrInvalidSinkOption)
+	}
+}
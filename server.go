@@ -0,0 +1,374 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// UploadSummary reports what an uploaded NEM12 file contained and whether it was forwarded to the sinks.
+type UploadSummary struct {
+	File      string   `json:"file"`
+	Nmis      []string `json:"nmis"`
+	Days      int      `json:"days"` // Distinct interval dates.
+	Rows      int64    `json:"rows"`
+	Loaded    bool     `json:"loaded"`
+	Forwarded int64    `json:"forwarded"` // Rows forwarded to the sinks, fewer than Rows if forwarding failed part way through.
+	Warnings  []string `json:"warnings"`
+	Errors    []string `json:"errors"`
+}
+
+// summarySink collects an UploadSummary from the meter readings it is given, writing nothing.
+type summarySink struct {
+	summary *UploadSummary
+	nmis    map[string]struct{}
+	days    map[time.Time]struct{}
+}
+
+func newSummarySink(summary *UploadSummary) *summarySink {
+	return &summarySink{
+		summary: summary,
+		nmis:    make(map[string]struct{}, 16),
+		days:    make(map[time.Time]struct{}, 64),
+	}
+}
+func (summarySink *summarySink) WriteBatch(meterReadingsJob []*MeterReadingsJob) error {
+	for i := range meterReadingsJob {
+		if _, ok := summarySink.nmis[meterReadingsJob[i].Nmi]; !ok {
+			summarySink.nmis[meterReadingsJob[i].Nmi] = struct{}{}
+			summarySink.summary.Nmis = append(summarySink.summary.Nmis, meterReadingsJob[i].Nmi)
+		}
+		if intervalData := meterReadingsJob[i].IntervalData; intervalData != nil {
+			summarySink.days[intervalData.IntervalDate] = struct{}{}
+		}
+	}
+	summarySink.summary.Rows += int64(len(meterReadingsJob))
+	summarySink.summary.Days = len(summarySink.days)
+
+	return nil
+}
+func (summarySink *summarySink) Flush() error {
+	return nil
+}
+func (summarySink *summarySink) Close() error {
+	sort.Strings(summarySink.summary.Nmis)
+	return nil
+}
+
+// lockedSink shares a Sink between concurrent uploads. It is a sync.Locker: loadNem12 holds the lock for a whole file, so files are
+// never interleaved in the sink. Close is left to the server.
+type lockedSink struct {
+	mutex *sync.Mutex
+	sink  Sink
+}
+
+func (lockedSink lockedSink) Lock() {
+	lockedSink.mutex.Lock()
+}
+func (lockedSink lockedSink) Unlock() {
+	lockedSink.mutex.Unlock()
+}
+func (lockedSink lockedSink) WriteBatch(meterReadingsJob []*MeterReadingsJob) error {
+	return lockedSink.sink.WriteBatch(meterReadingsJob)
+}
+func (lockedSink lockedSink) WriteB2bDetails(b2bDetailsJob []*B2bDetailsJob) error {
+	return writeB2bDetails(lockedSink.sink, b2bDetailsJob)
+}
+func (lockedSink lockedSink) Flush() error {
+	return lockedSink.sink.Flush()
+}
+func (lockedSink lockedSink) Close() error {
+	return nil
+}
+
+// NemServer accepts NEM12 uploads over HTTP, validates them and forwards their meter readings to Sink.
+type NemServer struct {
+	Sink          Sink
+	MaxUploadSize int64
+	mutex         sync.Mutex
+}
+
+// ServeHTTP accepts a raw, gzip or multipart/form-data POST of one or more NEM12 files, and responds with a JSON UploadSummary for each.
+func (nemServer *NemServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writer.Header().Set("Allow", http.MethodPost)
+		http.Error(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	body := http.MaxBytesReader(writer, request.Body, nemServer.MaxUploadSize)
+	var summaries []*UploadSummary
+	var err error
+
+	mediaType, params, _ := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	if strings.HasPrefix(mediaType, "multipart/") {
+		// Every part is received before any is forwarded, so a request that fails part way through loads nothing.
+		var spooled []*spooledNem12
+		defer func() {
+			for i := range spooled {
+				spooled[i].Close()
+			}
+		}()
+		multipartReader := multipart.NewReader(body, params["boundary"])
+		for {
+			var part *multipart.Part
+			part, err = multipartReader.NextPart()
+			if err == io.EOF {
+				err = nil
+				break
+			}
+			if err != nil {
+				break
+			}
+			if part.FileName() == "" {
+				part.Close()
+				continue
+			}
+
+			var nem12File *spooledNem12
+			nem12File, err = spoolNem12(part, filepath.Base(part.FileName()), part.Header.Get("Content-Encoding"))
+			part.Close()
+			if err != nil {
+				break
+			}
+			spooled = append(spooled, nem12File)
+		}
+		for i := 0; err == nil && i < len(spooled); i++ {
+			var summary *UploadSummary
+			summary, err = loadNem12(spooled[i].File, spooled[i].Name, nemServer.lockedSink())
+			if summary != nil {
+				summaries = append(summaries, summary)
+			}
+		}
+	} else {
+		name := request.URL.Query().Get("name")
+		if _, params, err := mime.ParseMediaType(request.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+			name = params["filename"]
+		}
+		if name == "" {
+			name = "upload.csv"
+		}
+
+		var summary *UploadSummary
+		summary, err = nemServer.upload(body, filepath.Base(name), request.Header.Get("Content-Encoding"))
+		if summary != nil {
+			summaries = append(summaries, summary)
+		}
+	}
+
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			http.Error(writer, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	status := http.StatusOK
+	for i := range summaries {
+		if !summaries[i].Loaded {
+			status = http.StatusUnprocessableEntity
+		}
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(struct {
+		Files []*UploadSummary `json:"files"`
+	}{summaries})
+}
+
+func (nemServer *NemServer) upload(reader io.Reader, name string, contentEncoding string) (*UploadSummary, error) {
+	return ingestNem12(reader, name, contentEncoding, nemServer.lockedSink())
+}
+
+func (nemServer *NemServer) lockedSink() lockedSink {
+	return lockedSink{&nemServer.mutex, nemServer.Sink}
+}
+
+// spooledNem12 is a NEM12 file ready to load: gunzipped, and spooled to a temporary file unless it already was a plain *os.File.
+type spooledNem12 struct {
+	File      *os.File
+	Name      string
+	temporary bool
+}
+
+// Close removes the temporary file, if any. A plain *os.File is left to its owner.
+func (spooledNem12 *spooledNem12) Close() error {
+	if !spooledNem12.temporary {
+		return nil
+	}
+	return errors.Join(spooledNem12.File.Close(), os.Remove(spooledNem12.File.Name()))
+}
+
+// spoolNem12 reads a NEM12 file in full, gunzipping it if need be. Anything but a plain *os.File is spooled to a temporary file.
+func spoolNem12(reader io.Reader, name string, contentEncoding string) (*spooledNem12, error) {
+	bufferedReader := bufio.NewReader(reader)
+	// Gzip is detected by its magic number as well, as clients often omit Content-Encoding for .gz files.
+	if magic, _ := bufferedReader.Peek(2); contentEncoding == "gzip" || (len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b) {
+		gzipReader, err := gzip.NewReader(bufferedReader)
+		if err != nil {
+			return nil, err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+		name = strings.TrimSuffix(name, ".gz")
+	} else if file, ok := reader.(*os.File); ok {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return &spooledNem12{File: file, Name: name}, nil
+	} else {
+		reader = bufferedReader
+	}
+
+	file, err := os.CreateTemp("", "nem12-upload-*.csv")
+	if err != nil {
+		return nil, err
+	}
+	spooled := &spooledNem12{File: file, Name: name, temporary: true}
+
+	if _, err := io.Copy(file, reader); err != nil {
+		return nil, errors.Join(err, spooled.Close())
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, errors.Join(err, spooled.Close())
+	}
+
+	return spooled, nil
+}
+
+// ingestNem12 loads a NEM12 file, gunzipping it if need be, into sink.
+func ingestNem12(reader io.Reader, name string, contentEncoding string, sink Sink) (*UploadSummary, error) {
+	spooled, err := spoolNem12(reader, name, contentEncoding)
+	if err != nil {
+		return nil, err
+	}
+	defer spooled.Close()
+
+	return loadNem12(spooled.File, spooled.Name, sink)
+}
+
+// loadNem12 validates file, and forwards it to sink only if it parsed without errors. sink is flushed but not closed.
+func loadNem12(file io.ReadSeeker, name string, sink Sink) (*UploadSummary, error) {
+	summary := &UploadSummary{
+		File:     name,
+		Nmis:     []string{},
+		Warnings: []string{},
+		Errors:   []string{},
+	}
+
+	// First pass: validate and summarise.
+	summaryPipeline := NewPipeline(newSummarySink(summary), sqlInsertBatchSize)
+	state := ProcessLineState{
+		Source:   &SourceFile{Name: name},
+		Pipeline: summaryPipeline,
+	}
+	if err := errors.Join(processNem12(file, &state), summaryPipeline.Close()); err != nil {
+		summary.Errors = append(summary.Errors, fmt.Sprintf("line %d: %v", state.LineNumber, err))
+		return summary, nil
+	}
+	if state.Source.Header == nil {
+		summary.Warnings = append(summary.Warnings, "missing 100 header record")
+	}
+	if !state.EndOfData {
+		summary.Warnings = append(summary.Warnings, "missing 900 end of data record")
+	}
+	if summary.Rows == 0 {
+		summary.Warnings = append(summary.Warnings, "no interval data")
+	}
+
+	// Second pass: forward to the sink, holding it for the whole file if it is shared.
+	if locker, ok := sink.(sync.Locker); ok {
+		locker.Lock()
+		defer locker.Unlock()
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	pipeline := NewPipeline(sink, sqlInsertBatchSize)
+	state = ProcessLineState{
+		Source:   &SourceFile{Name: name},
+		Pipeline: pipeline,
+	}
+	err := errors.Join(processNem12(file, &state), pipeline.Flush())
+	summary.Forwarded = pipeline.Rows
+	if err != nil {
+		summary.Errors = append(summary.Errors, fmt.Sprintf("partially loaded, %d of %d rows forwarded: %v", summary.Forwarded, summary.Rows, err))
+		return summary, nil
+	}
+	summary.Loaded = true
+
+	return summary, nil
+}
+
+// runServe runs the serve command: an HTTP server accepting NEM12 uploads at POST /nem12 until interrupted.
+func runServe(args []string) error {
+	flagSet := flag.NewFlagSet("serve", flag.ExitOnError)
+	var sinkSpecs sinkFlag
+	flagSet.Var(&sinkSpecs, "sink", "forward meter readings to `name:target?options`, may be repeated")
+	listen := flagSet.String("listen", ":8080", "listen on `address`")
+	maxUploadSize := flagSet.Int64("max-upload-size", 1<<30, "reject uploads larger than `bytes`")
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), "Usage: %s serve [flags]\n", os.Args[0])
+		flagSet.PrintDefaults()
+		fmt.Fprintf(flagSet.Output(), "Sinks: %s\n", strings.Join(SinkNames(), ", "))
+	}
+	flagSet.Parse(args)
+
+	if len(sinkSpecs) == 0 {
+		sinkSpecs = sinkFlag{"copy:meter_readings.sql.csv"}
+	}
+	sink, err := OpenSinks(sinkSpecs, nil)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/nem12", &NemServer{Sink: sink, MaxUploadSize: *maxUploadSize})
+	server := &http.Server{
+		Addr:              *listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	shutdown := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		shutdown <- server.Shutdown(shutdownCtx)
+	}()
+
+	log.Println("listening on", *listen)
+	err = server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		// Wait for uploads in flight before closing the sinks.
+		err = <-shutdown
+	}
+
+	return errors.Join(err, sink.Close())
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func postNem12(t *testing.T, nemServer *NemServer, contentType string, body []byte) (int, []*UploadSummary) {
+	t.Helper()
+	request := httptest.NewRequest(http.MethodPost, "/nem12?name=test.csv", bytes.NewReader(body))
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	recorder := httptest.NewRecorder()
+	nemServer.ServeHTTP(recorder, request)
+
+	var response struct {
+		Files []*UploadSummary `json:"files"`
+	}
+	if recorder.Header().Get("Content-Type") == "application/json" {
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return recorder.Code, response.Files
+}
+
+func TestNemServerUpload(t *testing.T) {
+	valid := testNem12(testHeaderLine, testBlockLine("NEM1201009", "E1"), testDayLine("20050301", "1", ""), testDayLine("20050302", "1", ""), "900")
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	gzipWriter.Write([]byte(valid))
+	gzipWriter.Close()
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		rows   int64
+	}{
+		{"valid", valid, http.StatusOK, 96},
+		{"gzip", gzipped.String(), http.StatusOK, 96},
+		{"bare 200 without a newline", testHeaderLine + "\n200", http.StatusUnprocessableEntity, 0},
+		{"bare 100", "100\n", http.StatusUnprocessableEntity, 0},
+		{"bare 300", testNem12(testHeaderLine, testBlockLine("NEM1201009", "E1"), "300"), http.StatusUnprocessableEntity, 0},
+		{"300 before 200", testNem12(testHeaderLine, testDayLine("20050301", "1", "")), http.StatusUnprocessableEntity, 0},
+		{"bad value after a good day", testNem12(testHeaderLine, testBlockLine("NEM1201009", "E1"), testDayLine("20050301", "1", ""), "300,2005030x"+strings.Repeat(",1", 48)+",A,,,,"), http.StatusUnprocessableEntity, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sink := &testSink{}
+			status, summaries := postNem12(t, &NemServer{Sink: sink, MaxUploadSize: 1 << 20}, "", []byte(test.body))
+			if status != test.status {
+				t.Errorf("got status %d, want %d", status, test.status)
+			}
+			if len(summaries) != 1 {
+				t.Fatalf("got %d summaries, want 1", len(summaries))
+			}
+			summary := summaries[0]
+			if summary.Loaded != (test.status == http.StatusOK) || (test.status != http.StatusOK && len(summary.Errors) == 0) {
+				t.Errorf("got loaded %t with errors %v", summary.Loaded, summary.Errors)
+			}
+			if summary.Forwarded != test.rows || int64(len(sink.jobs)) != test.rows {
+				t.Errorf("forwarded %d rows, sink got %d, want %d", summary.Forwarded, len(sink.jobs), test.rows)
+			}
+		})
+	}
+}
+
+func TestNemServerMultipart(t *testing.T) {
+	valid := testNem12(testHeaderLine, testBlockLine("NEM1201009", "E1"), testDayLine("20050301", "1", ""), "900")
+	multipartBody := func(parts ...string) (string, []byte) {
+		var body bytes.Buffer
+		multipartWriter := multipart.NewWriter(&body)
+		for i, part := range parts {
+			writer, _ := multipartWriter.CreateFormFile("file", "part"+string(rune('a'+i))+".csv")
+			writer.Write([]byte(part))
+		}
+		multipartWriter.Close()
+		return multipartWriter.FormDataContentType(), body.Bytes()
+	}
+	temporaryFiles := func() []string {
+		names, _ := filepath.Glob(filepath.Join(os.TempDir(), "nem12-upload-*.csv"))
+		return names
+	}
+	before := len(temporaryFiles())
+
+	sink := &testSink{}
+	contentType, body := multipartBody(valid, valid)
+	status, summaries := postNem12(t, &NemServer{Sink: sink, MaxUploadSize: 1 << 20}, contentType, body)
+	if status != http.StatusOK || len(summaries) != 2 || len(sink.jobs) != 96 {
+		t.Errorf("got status %d, %d summaries and %d rows, want 200, 2 and 96", status, len(summaries), len(sink.jobs))
+	}
+
+	// A second part that is not gzip after all fails the request before the first is forwarded.
+	sink = &testSink{}
+	contentType, body = multipartBody(valid, "\x1f\x8bnot gzip")
+	status, _ = postNem12(t, &NemServer{Sink: sink, MaxUploadSize: 1 << 20}, contentType, body)
+	if status != http.StatusBadRequest || len(sink.jobs) != 0 {
+		t.Errorf("got status %d and %d rows, want 400 and none", status, len(sink.jobs))
+	}
+
+	if after := len(temporaryFiles()); after != before {
+		t.Errorf("%d temporary files left behind", after-before)
+	}
+}
+
+// failingSink fails every batch after the first Batches.
+type failingSink struct {
+	testSink
+	Batches int
+}
+
+func (failingSink *failingSink) WriteBatch(meterReadingsJob []*MeterReadingsJob) error {
+	if failingSink.Batches == 0 {
+		return errors.New("sink failed")
+	}
+	failingSink.Batches--
+	return failingSink.testSink.WriteBatch(meterReadingsJob)
+}
+
+func TestLoadNem12PartialLoad(t *testing.T) {
+	config := testGeneratorConfig()
+	config.Days = 120
+	file := generateTestNem12(t, config)
+
+	sink := &failingSink{Batches: 1}
+	summary, err := loadNem12(bytes.NewReader(file), "test.csv", sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Loaded {
+		t.Error("got loaded, want a failed load")
+	}
+	if summary.Rows != 3*120*48 || summary.Forwarded != int64(sqlInsertBatchSize) || len(sink.jobs) != sqlInsertBatchSize {
+		t.Errorf("got %d rows, %d forwarded and %d in the sink, want %d, %d and %d", summary.Rows, summary.Forwarded, len(sink.jobs), 3*120*48, sqlInsertBatchSize, sqlInsertBatchSize)
+	}
+	if len(summary.Errors) != 1 || !strings.HasPrefix(summary.Errors[0], "partially loaded, 16384 of 17280 rows forwarded: ") {
+		t.Errorf("got errors %v", summary.Errors)
+	}
+}
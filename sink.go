@@ -0,0 +1,513 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Sink receives every flushed batch of meter readings.
+//
+// WriteBatch may retain nothing from meterReadingsJob after it returns, as the batch is reused. Flush pushes buffered output to the underlying writer. Close flushes and releases the sink.
+type Sink interface {
+	WriteBatch(meterReadingsJob []*MeterReadingsJob) error
+	Flush() error
+	Close() error
+}
+
+// B2bDetailsSink is implemented by sinks that also write 500 records. WriteB2bDetails may retain nothing from b2bDetailsJob after it returns.
+type B2bDetailsSink interface {
+	WriteB2bDetails(b2bDetailsJob []*B2bDetailsJob) error
+}
+
+// writeB2bDetails writes b2bDetailsJob to sink if it is a B2bDetailsSink, and drops it otherwise.
+func writeB2bDetails(sink Sink, b2bDetailsJob []*B2bDetailsJob) error {
+	if b2bDetailsSink, ok := sink.(B2bDetailsSink); ok {
+		return b2bDetailsSink.WriteB2bDetails(b2bDetailsJob)
+	}
+	return nil
+}
+
+type SinkConfig struct {
+	Target  string     // File name or URL.
+	Options url.Values // Sink-specific options.
+
+	// Append to the existing output instead of replacing it, after truncating it to Size if Size is not negative. Used to resume an interrupted load.
+	Append bool
+	Size   int64
+}
+
+// SinkFactory opens a sink as configured by config.
+type SinkFactory func(config *SinkConfig) (Sink, error)
+
+var ErrUnknownSink = errors.New("unknown sink")
+var ErrInvalidSinkOption = errors.New("invalid sink option")
+var ErrSinkNotResumable = errors.New("sink cannot append to existing output")
+var ErrInvalidTable = errors.New("invalid table, want meter_readings or b2b_details")
+
+var sinkFactories = map[string]SinkFactory{}
+
+// RegisterSink makes a sink available by name to OpenSink. It is meant to be called from init.
+func RegisterSink(name string, factory SinkFactory) {
+	if _, ok := sinkFactories[name]; ok {
+		panic("sink already registered: " + name)
+	}
+	sinkFactories[name] = factory
+}
+func SinkNames() []string {
+	names := make([]string, 0, len(sinkFactories))
+	for name := range sinkFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Options understood by OpenSink for every sink, rather than passed on to its factory.
+const (
+	sinkOptionOnError = "on-error"
+	sinkOptionNmi     = "nmi"
+	sinkOptionSuffix  = "suffix"
+	sinkOptionUom     = "uom"
+	sinkOptionQuality = "quality"
+
+	sinkOptionResample        = "resample"
+	sinkOptionResampleProfile = "resample-profile"
+)
+
+// ParseSinkSpec splits a spec of the form name:target?option=value&...
+func ParseSinkSpec(spec string) (name string, target string, options url.Values, err error) {
+	name, target, _ = strings.Cut(spec, ":")
+	if i := strings.LastIndexByte(target, '?'); i >= 0 {
+		options, err = url.ParseQuery(target[i+1:])
+		if err != nil {
+			return "", "", nil, fmt.Errorf("%w: %s: %w", ErrInvalidSinkOption, spec, err)
+		}
+		target = target[:i]
+	} else {
+		options = url.Values{}
+	}
+
+	return
+}
+
+// sinkOption returns a sink-specific option, or defaultValue if it is not set.
+func sinkOption(options url.Values, name string, defaultValue string) string {
+	if options.Has(name) {
+		return options.Get(name)
+	}
+	return defaultValue
+}
+
+// OpenSink opens a sink from a spec of the form name:target?option=value&..., e.g.
+//
+//	parquet:meter_readings.parquet?suffix=E1,B1&on-error=disable
+//
+// The nmi, suffix, uom and quality options filter the readings the sink receives (quality matches the quality flag), resample and resample-profile resample them (see ResampleSink), and on-error sets its ErrorPolicy.
+//
+// If resume is not nil, the sink appends to its existing output, truncated to the size recorded in resume for spec.
+func OpenSink(spec string, resume map[string]int64) (Sink, error) {
+	name, target, options, err := ParseSinkSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	factory, ok := sinkFactories[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSink, name)
+	}
+
+	errorPolicy, err := ParseErrorPolicy(options.Get(sinkOptionOnError))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", spec, err)
+	}
+	filter := NewMeterReadingsFilter(options[sinkOptionNmi], options[sinkOptionSuffix], options[sinkOptionUom], options[sinkOptionQuality])
+	resample, disaggregate, profile, err := resampleOptions(options.Get(sinkOptionResample), options.Get(sinkOptionResampleProfile))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", spec, err)
+	}
+	if resample > 0 && resume != nil {
+		// Readings held back for resampling are not covered by the checkpoint.
+		return nil, fmt.Errorf("%s: %w", spec, ErrSinkNotResumable)
+	}
+	for _, option := range []string{sinkOptionOnError, sinkOptionNmi, sinkOptionSuffix, sinkOptionUom, sinkOptionQuality, sinkOptionResample, sinkOptionResampleProfile} {
+		options.Del(option)
+	}
+
+	config := &SinkConfig{
+		Target:  target,
+		Options: options,
+		Append:  resume != nil,
+		Size:    -1,
+	}
+	if size, ok := resume[checkpointSinkSpec(spec)]; ok {
+		config.Size = size
+	}
+
+	sink, err := factory(config)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", spec, err)
+	}
+	if resample > 0 {
+		resampleSink, err := NewResampleSink(sink, resample, disaggregate, profile)
+		if err != nil {
+			sink.Close()
+			return nil, fmt.Errorf("%s: %w", spec, err)
+		}
+		sink = resampleSink
+	}
+	if filter != nil {
+		sink = &FilterSink{Sink: sink, Predicate: filter}
+	}
+
+	return &ErrorPolicySink{Sink: sink, Name: name + ":" + target, Policy: errorPolicy}, nil
+}
+
+// OpenSinks opens every spec and tees them together, closing any already opened if one fails.
+func OpenSinks(specs []string, resume map[string]int64) (Sink, error) {
+	sinks := make([]Sink, 0, len(specs))
+	for i := range specs {
+		sink, err := OpenSink(specs[i], resume)
+		if err != nil {
+			for j := range sinks {
+				sinks[j].Close()
+			}
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	return NewTeeSink(sinks...), nil
+}
+
+// TeeSink fans each batch out to every sink in order.
+type TeeSink struct {
+	Sinks []Sink
+}
+
+func NewTeeSink(sinks ...Sink) *TeeSink {
+	return &TeeSink{Sinks: sinks}
+}
+func (teeSink *TeeSink) WriteBatch(meterReadingsJob []*MeterReadingsJob) error {
+	var errs []error
+	for i := range teeSink.Sinks {
+		if err := teeSink.Sinks[i].WriteBatch(meterReadingsJob); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+func (teeSink *TeeSink) WriteB2bDetails(b2bDetailsJob []*B2bDetailsJob) error {
+	var errs []error
+	for i := range teeSink.Sinks {
+		if err := writeB2bDetails(teeSink.Sinks[i], b2bDetailsJob); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+func (teeSink *TeeSink) Flush() error {
+	var errs []error
+	for i := range teeSink.Sinks {
+		if err := teeSink.Sinks[i].Flush(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+func (teeSink *TeeSink) Close() error {
+	var errs []error
+	for i := range teeSink.Sinks {
+		if err := teeSink.Sinks[i].Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// FilterSink forwards only the readings that satisfy Predicate, and the 500 records whose channel and 300 record would.
+type FilterSink struct {
+	Sink
+	Predicate  func(meterReadingsJob *MeterReadingsJob) bool
+	batch      []*MeterReadingsJob
+	b2bDetails []*B2bDetailsJob
+}
+
+func (filterSink *FilterSink) WriteBatch(meterReadingsJob []*MeterReadingsJob) error {
+	filterSink.batch = filterSink.batch[:0]
+	for i := range meterReadingsJob {
+		if filterSink.Predicate(meterReadingsJob[i]) {
+			filterSink.batch = append(filterSink.batch, meterReadingsJob[i])
+		}
+	}
+	if len(filterSink.batch) == 0 {
+		return nil
+	}
+
+	return filterSink.Sink.WriteBatch(filterSink.batch)
+}
+func (filterSink *FilterSink) WriteB2bDetails(b2bDetailsJob []*B2bDetailsJob) error {
+	filterSink.b2bDetails = filterSink.b2bDetails[:0]
+	for i := range b2bDetailsJob {
+		if filterSink.Predicate(&MeterReadingsJob{Nmi: b2bDetailsJob[i].Nmi, NmiSuffix: b2bDetailsJob[i].NmiSuffix, Uom: b2bDetailsJob[i].Uom, QualityMethod: b2bDetailsJob[i].QualityMethod}) {
+			filterSink.b2bDetails = append(filterSink.b2bDetails, b2bDetailsJob[i])
+		}
+	}
+	if len(filterSink.b2bDetails) == 0 {
+		return nil
+	}
+
+	return writeB2bDetails(filterSink.Sink, filterSink.b2bDetails)
+}
+
+// NewMeterReadingsFilter matches readings against comma separated NMIs, suffixes, UOMs and quality flags. Empty lists match everything, and it returns nil if all are empty.
+func NewMeterReadingsFilter(nmi []string, nmiSuffix []string, uom []string, quality []string) func(meterReadingsJob *MeterReadingsJob) bool {
+	set := func(values []string) map[string]bool {
+		if len(values) == 0 {
+			return nil
+		}
+		m := make(map[string]bool)
+		for i := range values {
+			for _, value := range strings.Split(values[i], ",") {
+				m[strings.TrimSpace(value)] = true
+			}
+		}
+		return m
+	}
+
+	nmiSet, nmiSuffixSet, uomSet, qualitySet := set(nmi), set(nmiSuffix), set(uom), set(quality)
+	if nmiSet == nil && nmiSuffixSet == nil && uomSet == nil && qualitySet == nil {
+		return nil
+	}
+
+	return func(meterReadingsJob *MeterReadingsJob) bool {
+		if nmiSet != nil && !nmiSet[meterReadingsJob.Nmi] {
+			return false
+		}
+		if nmiSuffixSet != nil && !nmiSuffixSet[meterReadingsJob.NmiSuffix] {
+			return false
+		}
+		if uomSet != nil && !uomSet[meterReadingsJob.Uom] {
+			return false
+		}
+		if qualitySet != nil && (meterReadingsJob.QualityMethod == "" || !qualitySet[meterReadingsJob.QualityMethod[:1]]) {
+			return false
+		}
+		return true
+	}
+}
+
+type ErrorPolicy int
+
+const (
+	ErrorPolicyFail     ErrorPolicy = iota // Stop the load.
+	ErrorPolicyContinue                    // Log the error and keep writing to the sink.
+	ErrorPolicyDisable                     // Log the error and stop writing to the sink.
+)
+
+var ErrInvalidErrorPolicy = errors.New("invalid error policy, want fail, continue or disable")
+
+func ParseErrorPolicy(s string) (ErrorPolicy, error) {
+	switch s {
+	case "", "fail":
+		return ErrorPolicyFail, nil
+	case "continue":
+		return ErrorPolicyContinue, nil
+	case "disable":
+		return ErrorPolicyDisable, nil
+	}
+	return ErrorPolicyFail, ErrInvalidErrorPolicy
+}
+
+// ErrorPolicySink applies Policy to the errors of one sink, so that a failing sink need not stop the others.
+type ErrorPolicySink struct {
+	Sink
+	Name     string
+	Policy   ErrorPolicy
+	disabled bool
+}
+
+func (errorPolicySink *ErrorPolicySink) handle(err error) error {
+	if err == nil {
+		return nil
+	}
+	err = fmt.Errorf("%s: %w", errorPolicySink.Name, err)
+
+	switch errorPolicySink.Policy {
+	case ErrorPolicyContinue:
+		log.Println(err)
+		return nil
+	case ErrorPolicyDisable:
+		log.Println(err, "(sink disabled)")
+		errorPolicySink.disabled = true
+		return nil
+	}
+	return err
+}
+func (errorPolicySink *ErrorPolicySink) WriteBatch(meterReadingsJob []*MeterReadingsJob) error {
+	if errorPolicySink.disabled {
+		return nil
+	}
+	return errorPolicySink.handle(errorPolicySink.Sink.WriteBatch(meterReadingsJob))
+}
+func (errorPolicySink *ErrorPolicySink) WriteB2bDetails(b2bDetailsJob []*B2bDetailsJob) error {
+	if errorPolicySink.disabled {
+		return nil
+	}
+	return errorPolicySink.handle(writeB2bDetails(errorPolicySink.Sink, b2bDetailsJob))
+}
+func (errorPolicySink *ErrorPolicySink) Flush() error {
+	if errorPolicySink.disabled {
+		return nil
+	}
+	return errorPolicySink.handle(errorPolicySink.Sink.Flush())
+}
+func (errorPolicySink *ErrorPolicySink) Close() error {
+	return errorPolicySink.handle(errorPolicySink.Sink.Close())
+}
+
+// createSinkFile creates config.Target for writing, or opens it for appending, or returns standard output if the target is -.
+func createSinkFile(config *SinkConfig) (io.WriteCloser, error) {
+	if config.Target == "-" {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+	if config.Target == "" {
+		return nil, fmt.Errorf("%w: missing file name", ErrInvalidSinkOption)
+	}
+	if !config.Append {
+		return os.Create(config.Target)
+	}
+
+	file, err := os.OpenFile(config.Target, os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if config.Size >= 0 {
+		// Drop anything written after the checkpoint was taken.
+		if err := file.Truncate(config.Size); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	if _, err := file.Seek(0, io.SeekEnd); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// bufferedSink adapts write functions over a *bufio.Writer, such as writeCopyStatements, to a Sink. It writes one table, so one of write and writeB2bDetails is nil.
+type bufferedSink struct {
+	file            io.WriteCloser
+	writer          *bufio.Writer
+	write           func(writer *bufio.Writer, meterReadingsJob []*MeterReadingsJob) error
+	writeB2bDetails func(writer *bufio.Writer, b2bDetailsJob []*B2bDetailsJob) error
+}
+
+// newTableSink opens a bufferedSink on the table named by the table option: meter_readings, the default, written with write, or b2b_details, written with writeB2bDetails.
+func newTableSink(config *SinkConfig, write func(writer *bufio.Writer, meterReadingsJob []*MeterReadingsJob) error, writeB2bDetails func(writer *bufio.Writer, b2bDetailsJob []*B2bDetailsJob) error) (Sink, error) {
+	switch sinkOption(config.Options, "table", "meter_readings") {
+	case "meter_readings":
+		writeB2bDetails = nil
+	case "b2b_details":
+		write = nil
+	default:
+		return nil, ErrInvalidTable
+	}
+
+	file, err := createSinkFile(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &bufferedSink{
+		file:            file,
+		writer:          bufio.NewWriterSize(file, 1<<27),
+		write:           write,
+		writeB2bDetails: writeB2bDetails,
+	}, nil
+}
+func (bufferedSink *bufferedSink) WriteBatch(meterReadingsJob []*MeterReadingsJob) error {
+	if bufferedSink.write == nil {
+		return nil
+	}
+	return bufferedSink.write(bufferedSink.writer, meterReadingsJob)
+}
+func (bufferedSink *bufferedSink) WriteB2bDetails(b2bDetailsJob []*B2bDetailsJob) error {
+	if bufferedSink.writeB2bDetails == nil {
+		return nil
+	}
+	return bufferedSink.writeB2bDetails(bufferedSink.writer, b2bDetailsJob)
+}
+func (bufferedSink *bufferedSink) Flush() error {
+	return bufferedSink.writer.Flush()
+}
+func (bufferedSink *bufferedSink) Close() error {
+	err := bufferedSink.writer.Flush()
+	return errors.Join(err, bufferedSink.file.Close())
+}
+
+// newFileSink creates the target file and opens a Sink on it with open.
+func newFileSink(config *SinkConfig, open func(writer io.Writer) (Sink, error)) (Sink, error) {
+	file, err := createSinkFile(config)
+	if err != nil {
+		return nil, err
+	}
+
+	sink, err := open(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &closerSink{Sink: sink, file: file}, nil
+}
+
+// closerSink closes file after closing the Sink that writes to it.
+type closerSink struct {
+	Sink
+	file io.Closer
+}
+
+func (closerSink *closerSink) WriteB2bDetails(b2bDetailsJob []*B2bDetailsJob) error {
+	return writeB2bDetails(closerSink.Sink, b2bDetailsJob)
+}
+func (closerSink *closerSink) Close() error {
+	err := closerSink.Sink.Close()
+	return errors.Join(err, closerSink.file.Close())
+}
+
+func init() {
+	RegisterSink("insert", func(config *SinkConfig) (Sink, error) {
+		return newTableSink(config, func(writer *bufio.Writer, meterReadingsJob []*MeterReadingsJob) error {
+			writeInsertStatements(writer, meterReadingsJob)
+			return writer.Flush()
+		}, writeB2bInsertStatements)
+	})
+	RegisterSink("copy", func(config *SinkConfig) (Sink, error) {
+		return newTableSink(config, func(writer *bufio.Writer, meterReadingsJob []*MeterReadingsJob) error {
+			writeCopyStatements(writer, meterReadingsJob)
+			return writer.Flush()
+		}, writeB2bCopyStatements)
+	})
+	RegisterSink("jsonl", func(config *SinkConfig) (Sink, error) {
+		return newTableSink(config, writeJsonLines, writeB2bJsonLines)
+	})
+}
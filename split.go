@@ -0,0 +1,234 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Cheejyg/Flo-Energy-Tech-Assessment/nem12"
+)
+
+var ErrInvalidSplit = errors.New("invalid split, want nmi, participant or none")
+var ErrSplitOverwritesInput = errors.New("split would overwrite a file being split, use -o")
+var ErrSplitMixedHeaders = errors.New("cannot split files with different 100 records into one file")
+
+// splitOutput is one group's output file, or its current part if split by size.
+type splitOutput struct {
+	name       string // Without part number or extension.
+	headerLine []byte
+	part       int
+	file       *os.File
+	writer     *Nem12Writer
+	blocks     int // Written to the current part.
+}
+
+// Nem12Splitter splits NEM12 files into one file per group in Dir: per NMI, per ToParticipant, or none, and into parts of at most MaxSize bytes if set.
+//
+// Each output file has the 100 record of the files its blocks came from, and a 900 record; blocks from files with another 100 record are rejected. Blocks are never split from their 200 record: a block too large for a part continues in the next after its 200 record again, and a day, with its 400 and 500 records, is never split. Files names the files written, none of which may be one of Inputs, the absolute paths of the files being split.
+type Nem12Splitter struct {
+	Dir     string
+	By      string
+	MaxSize int64
+	Inputs  []string
+	Files   []string
+
+	outputs map[string]*splitOutput
+}
+
+func NewNem12Splitter(dir string, by string, maxSize int64) (*Nem12Splitter, error) {
+	if by != "nmi" && by != "participant" && by != "none" {
+		return nil, ErrInvalidSplit
+	}
+
+	return &Nem12Splitter{
+		Dir:     dir,
+		By:      by,
+		MaxSize: maxSize,
+		outputs: make(map[string]*splitOutput, 16),
+	}, nil
+}
+
+// Split reads a NEM12 file once, named stem without its extension, and writes its blocks to their groups' files.
+func (splitter *Nem12Splitter) Split(reader io.Reader, stem string) error {
+	nem12Reader := NewNem12Reader(reader)
+	for {
+		block, err := nem12Reader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		var name string
+		switch splitter.By {
+		case "nmi":
+			name = stem + "." + storeEscape(block.Nmi)
+		case "participant":
+			name = storeEscape(nem12.ParseByteString(nem12Reader.Header.ToParticipant[:]))
+		default:
+			name = stem
+		}
+		output := splitter.outputs[name]
+		if output == nil {
+			output = &splitOutput{name: name, headerLine: nem12Reader.HeaderLine}
+			splitter.outputs[name] = output
+		} else if !bytes.Equal(output.headerLine, nem12Reader.HeaderLine) {
+			return fmt.Errorf("%w: %s.csv has blocks under %s, not %s", ErrSplitMixedHeaders, name, output.headerLine, nem12Reader.HeaderLine)
+		}
+
+		if err := splitter.writeBlock(output, block); err != nil {
+			return err
+		}
+	}
+}
+
+// fits reports whether size more bytes fit in output's current part, with its 900 record.
+func (splitter *Nem12Splitter) fits(output *splitOutput, size int64) bool {
+	return splitter.MaxSize <= 0 || output.writer.Size+size+int64(len(nem12.RecordIndicatorEndOfDataString)+1) <= splitter.MaxSize
+}
+
+func (splitter *Nem12Splitter) writeBlock(output *splitOutput, block *Nem12Block) error {
+	if output.writer == nil || (output.blocks > 0 && !splitter.fits(output, block.Size())) {
+		if err := splitter.nextPart(output); err != nil {
+			return err
+		}
+	}
+	if splitter.fits(output, block.Size()) {
+		output.blocks++
+		return output.writer.WriteBlock(block)
+	}
+
+	// Too large for a part of its own: split between days, repeating the 200 record.
+	part := &Nem12Block{Line: block.Line}
+	for _, day := range block.Days {
+		if len(part.Days) > 0 && !splitter.fits(output, part.Size()+day.Size()) {
+			if err := output.writer.WriteBlock(part); err != nil {
+				return err
+			}
+			if err := splitter.nextPart(output); err != nil {
+				return err
+			}
+			part = &Nem12Block{Line: block.Line}
+		}
+		if len(part.Days) == 0 && !splitter.fits(output, part.Size()+day.Size()) {
+			log.Printf("%s: %s %s %s is larger than %d bytes on its own", output.name, block.Nmi, block.NmiSuffix, day.IntervalData.IntervalDate.Format(jsonDateLayout), splitter.MaxSize)
+		}
+		part.Days = append(part.Days, day)
+	}
+	output.blocks++
+	return output.writer.WriteBlock(part)
+}
+
+// nextPart closes output's current part, if any, and creates the next.
+func (splitter *Nem12Splitter) nextPart(output *splitOutput) error {
+	if err := splitter.closeOutput(output); err != nil {
+		return err
+	}
+
+	output.part++
+	name := output.name
+	if splitter.MaxSize > 0 {
+		name += "." + strconv.Itoa(output.part)
+	}
+	name = filepath.Join(splitter.Dir, name+".csv")
+	if target, err := filepath.Abs(name); err != nil {
+		return err
+	} else if slices.Contains(splitter.Inputs, target) {
+		return fmt.Errorf("%w: %s", ErrSplitOverwritesInput, name)
+	}
+
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	writer, err := NewNem12Writer(file, output.headerLine)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	output.file, output.writer, output.blocks = file, writer, 0
+	splitter.Files = append(splitter.Files, name)
+
+	return nil
+}
+
+func (splitter *Nem12Splitter) closeOutput(output *splitOutput) error {
+	if output.file == nil {
+		return nil
+	}
+	err := errors.Join(output.writer.Close(), output.file.Close())
+	output.file, output.writer = nil, nil
+	return err
+}
+
+// Close writes the 900 records and closes the files.
+func (splitter *Nem12Splitter) Close() error {
+	var errs []error
+	for _, output := range splitter.outputs {
+		errs = append(errs, splitter.closeOutput(output))
+	}
+	return errors.Join(errs...)
+}
+
+// runSplit runs the split command: NEM12 files split into a valid NEM12 file per NMI or ToParticipant, or into files of at most a size.
+func runSplit(args []string) error {
+	flagSet := flag.NewFlagSet("split", flag.ExitOnError)
+	by := flagSet.String("by", "nmi", "split into a file per `nmi`, participant (ToParticipant) or none")
+	maxSize := flagSet.Int64("max-size", 0, "split files larger than `bytes` into numbered parts, 0 for no limit")
+	dir := flagSet.String("o", ".", "write the files to `dir`")
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), "Usage: %s split [flags] file...\n", os.Args[0])
+		flagSet.PrintDefaults()
+	}
+	flagSet.Parse(args)
+
+	if flagSet.NArg() == 0 {
+		flagSet.Usage()
+		os.Exit(2)
+	}
+	splitter, err := NewNem12Splitter(*dir, *by, *maxSize)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return err
+	}
+	for _, name := range flagSet.Args() {
+		input, err := filepath.Abs(name)
+		if err != nil {
+			return err
+		}
+		splitter.Inputs = append(splitter.Inputs, input)
+	}
+
+	for _, name := range flagSet.Args() {
+		file, err := os.Open(name)
+		if err != nil {
+			return errors.Join(err, splitter.Close())
+		}
+		stem := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+		err = splitter.Split(file, stem)
+		file.Close()
+		if err != nil {
+			return errors.Join(fmt.Errorf("%s: %w", name, err), splitter.Close())
+		}
+	}
+	if err := splitter.Close(); err != nil {
+		return err
+	}
+
+	for _, name := range splitter.Files {
+		fmt.Println(name)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNem12Splitter(t *testing.T) {
+	otherHeaderLine := "100,NEM12,200506081149,UNITEDDP,OTHER"
+	blockE1 := testBlockLine("NEM1201009", "E1")
+	blockB1 := testBlockLine("NEM1201009", "B1")
+	block10 := testBlockLine("NEM1201010", "E1")
+	day := func(date string) string {
+		return testDayLine(date, "1", "20050310121004")
+	}
+
+	tests := []struct {
+		name  string
+		by    string
+		files map[string]string // Input files by stem, split in stem order.
+		want  map[string]string // Output files by name.
+	}{
+		{"by nmi", "nmi", map[string]string{
+			"a": testNem12(testHeaderLine, blockE1, day("20050301"), blockB1, day("20050301"), block10, day("20050301"), "400,1,48,E52,,", "900"),
+		}, map[string]string{
+			"a.NEM1201009.csv": testNem12(testHeaderLine, blockE1, day("20050301"), blockB1, day("20050301"), "900"),
+			"a.NEM1201010.csv": testNem12(testHeaderLine, block10, day("20050301"), "400,1,48,E52,,", "900"),
+		}},
+		{"by participant", "participant", map[string]string{
+			"a": testNem12(testHeaderLine, blockE1, day("20050301"), "900"),
+			"b": testNem12(otherHeaderLine, block10, day("20050301"), "900"),
+			"c": testNem12(testHeaderLine, blockB1, day("20050302"), "900"),
+		}, map[string]string{
+			"NEMMCO.csv": testNem12(testHeaderLine, blockE1, day("20050301"), blockB1, day("20050302"), "900"),
+			"OTHER.csv":  testNem12(otherHeaderLine, block10, day("20050301"), "900"),
+		}},
+		{"none", "none", map[string]string{
+			"a": testNem12(testHeaderLine, blockE1, day("20050301"), block10, day("20050301"), "900"),
+		}, map[string]string{
+			"a.csv": testNem12(testHeaderLine, blockE1, day("20050301"), block10, day("20050301"), "900"),
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			splitter, err := NewNem12Splitter(dir, test.by, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stems := make([]string, 0, len(test.files))
+			for stem := range test.files {
+				stems = append(stems, stem)
+			}
+			slices.Sort(stems)
+			for _, stem := range stems {
+				if err := splitter.Split(strings.NewReader(test.files[stem]), stem); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := splitter.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(splitter.Files) != len(test.want) {
+				t.Errorf("got files %v, want %d", splitter.Files, len(test.want))
+			}
+			for name, want := range test.want {
+				got, err := os.ReadFile(filepath.Join(dir, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != want {
+					t.Errorf("%s: got\n%s\nwant\n%s", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+// TestNem12SplitterMaxSize splits by size, checking that every part fits, is valid NEM12 on its own, and that the parts hold every day in order.
+func TestNem12SplitterMaxSize(t *testing.T) {
+	blockE1 := testBlockLine("NEM1201009", "E1")
+	block10 := testBlockLine("NEM1201010", "E1")
+	dates := []string{"20050301", "20050302", "20050303", "20050304", "20050305"}
+	lines := []string{testHeaderLine, blockE1}
+	for _, date := range dates {
+		lines = append(lines, testDayLine(date, "1", ""))
+	}
+	lines = append(lines, "400,1,48,E52,,", block10, testDayLine("20050301", "2", ""), "900")
+	file := testNem12(lines...)
+
+	dayLine := int64(len(testDayLine("20050301", "1", "")) + 1)
+	fixed := int64(len(testHeaderLine) + 1 + len(blockE1) + 1 + len("900\n"))
+	tests := []struct {
+		name    string
+		maxSize int64
+		parts   int
+	}{
+		{"no limit", 0, 1},
+		{"whole file", int64(len(file)), 1},
+		{"two days a part", fixed + 2*dayLine, 4},
+		{"a day a part", fixed + dayLine + int64(len("400,1,48,E52,,\n")), 6},
+		{"smaller than a day", fixed, 6},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			splitter, err := NewNem12Splitter(dir, "none", test.maxSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := splitter.Split(strings.NewReader(file), "a"); err != nil {
+				t.Fatal(err)
+			}
+			if err := splitter.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if len(splitter.Files) != test.parts {
+				t.Fatalf("got %d parts %v, want %d", len(splitter.Files), splitter.Files, test.parts)
+			}
+
+			var days []string
+			for _, name := range splitter.Files {
+				part, err := os.ReadFile(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if test.maxSize > fixed && int64(len(part)) > test.maxSize {
+					t.Errorf("%s: %d bytes, more than %d", name, len(part), test.maxSize)
+				}
+				if !strings.HasSuffix(string(part), "\n900\n") {
+					t.Errorf("%s: no 900 record", name)
+				}
+
+				nem12Reader := NewNem12Reader(strings.NewReader(string(part)))
+				for {
+					block, err := nem12Reader.Next()
+					if err == io.EOF {
+						break
+					} else if err != nil {
+						t.Fatalf("%s: %v", name, err)
+					}
+					for _, day := range block.Days {
+						lines := make([]string, len(day.Lines))
+						for i := range day.Lines {
+							lines[i] = string(day.Lines[i])
+						}
+						days = append(days, block.Nmi+" "+strings.Join(lines, "\n"))
+					}
+				}
+			}
+
+			var want []string
+			for i, date := range dates {
+				want = append(want, "NEM1201009 "+testDayLine(date, "1", ""))
+				if i == len(dates)-1 {
+					want[i] += "\n400,1,48,E52,,"
+				}
+			}
+			want = append(want, "NEM1201010 "+testDayLine("20050301", "2", ""))
+			if !slices.Equal(days, want) {
+				t.Errorf("got days\n%s\nwant\n%s", strings.Join(days, "\n"), strings.Join(want, "\n"))
+			}
+		})
+	}
+}
+
+func TestNewNem12SplitterInvalid(t *testing.T) {
+	if _, err := NewNem12Splitter(t.TempDir(), "uom", 0); !errors.Is(err, ErrInvalidSplit) {
+		t.Errorf("got %v, want %v", err, ErrInvalidSplit)
+	}
+}
+
+// TestNem12SplitterInput splits a file by none into its own folder, which would overwrite it.
+func TestNem12SplitterInput(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "a.csv")
+	file := testNem12(testHeaderLine, testBlockLine("NEM1201009", "E1"), testDayLine("20050301", "1", ""), "900")
+	if err := os.WriteFile(name, []byte(file), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	splitter, err := NewNem12Splitter(dir, "none", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	splitter.Inputs = []string{name}
+	input, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer input.Close()
+	if err := splitter.Split(input, "a"); !errors.Is(err, ErrSplitOverwritesInput) {
+		t.Errorf("got %v, want %v", err, ErrSplitOverwritesInput)
+	}
+	if err := splitter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := os.ReadFile(name); err != nil || string(got) != file {
+		t.Errorf("a.csv was overwritten: %q, %v", got, err)
+	}
+}
+
+func TestNem12SplitterMixedHeaders(t *testing.T) {
+	splitter, err := NewNem12Splitter(t.TempDir(), "participant", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer splitter.Close()
+
+	block := testBlockLine("NEM1201009", "E1")
+	if err := splitter.Split(strings.NewReader(testNem12(testHeaderLine, block, testDayLine("20050301", "1", ""), "900")), "a"); err != nil {
+		t.Fatal(err)
+	}
+	// The same ToParticipant, sent later.
+	laterHeaderLine := "100,NEM12,200506091149,UNITEDDP,NEMMCO"
+	if err := splitter.Split(strings.NewReader(testNem12(laterHeaderLine, block, testDayLine("20050302", "1", ""), "900")), "b"); !errors.Is(err, ErrSplitMixedHeaders) {
+		t.Errorf("got %v, want %v", err, ErrSplitMixedHeaders)
+	}
+}
@@ -0,0 +1,337 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Cheejyg/Flo-Energy-Tech-Assessment/nem12"
+)
+
+// StatsUom is the breakdown of a file by UOM.
+type StatsUom struct {
+	Channels  int         `json:"channels"`
+	Intervals int         `json:"intervals"`
+	Total     json.Number `json:"total"`
+
+	total int64
+}
+
+// StatsChannel is the profile of one channel. IntervalLength is in minutes, from its last 200 record.
+type StatsChannel struct {
+	Nmi            string      `json:"nmi"`
+	NmiSuffix      string      `json:"nmi_suffix"`
+	Uom            string      `json:"uom"`
+	IntervalLength int         `json:"interval_length"`
+	Days           int         `json:"days"`
+	FirstDate      string      `json:"first_date"`
+	LastDate       string      `json:"last_date"`
+	Intervals      int         `json:"intervals"`
+	Total          json.Number `json:"total"`
+
+	days map[time.Time]*statsDay
+}
+
+// statsDay is the last version read of one channel's interval date.
+type statsDay struct {
+	Intervals int
+	Total     int64
+	Quality   map[string]int
+}
+
+// Nem12Stats is the profile of a NEM12 file.
+//
+// Records counts records by record indicator. IntervalLengths counts 200 records by interval length in minutes. Quality counts intervals by quality flag, after their 400 records. TransCodes counts 500 records by TransCode. A day sent more than once in the file counts as a DuplicateDay, and only its last version counts towards intervals, totals and Quality; Records and TransCodes count every record.
+type Nem12Stats struct {
+	File            string               `json:"file"`
+	Version         string               `json:"version"`
+	DateTime        string               `json:"datetime"`
+	FromParticipant string               `json:"from_participant"`
+	ToParticipant   string               `json:"to_participant"`
+	Records         map[string]int       `json:"records"`
+	Nmis            int                  `json:"nmis"`
+	FirstDate       string               `json:"first_date"`
+	LastDate        string               `json:"last_date"`
+	IntervalLengths map[int]int          `json:"interval_lengths"`
+	DuplicateDays   int                  `json:"duplicate_days"`
+	Uoms            map[string]*StatsUom `json:"uoms"`
+	Quality         map[string]int       `json:"quality"`
+	TransCodes      map[string]int       `json:"trans_codes"`
+	Channels        []*StatsChannel      `json:"channels"`
+}
+
+// addDay adds a day of channel to the stats.
+func (stats *Nem12Stats) addDay(channel *StatsChannel, day *Nem12Day) error {
+	n := len(day.IntervalData.IntervalValue)
+	job := &IntervalDataJob{
+		QualityMethod: make([]string, n),
+		IntervalEvent: make([]*nem12.IntervalEventRecord, n),
+	}
+	for i := range job.QualityMethod {
+		job.QualityMethod[i] = nem12.ParseByteString(day.IntervalData.QualityMethod[:])
+	}
+
+	for _, line := range day.Lines[1:] {
+		record := bytes.Split(line, []byte{COMMA})
+		switch {
+		case bytes.Equal(record[0], nem12.RecordIndicatorIntervalEventBytes):
+			if len(record) < 4 {
+				return nem12.ErrInvalidIntervalEventRecord
+			}
+			intervalEventRecord, err := nem12.ParseIntervalEventRecord(record)
+			if err != nil {
+				return err
+			}
+			if err := processIntervalEvent(job, intervalEventRecord); err != nil {
+				return err
+			}
+		case bytes.Equal(record[0], nem12.RecordIndicatorB2bDetailsBytes):
+			if len(record) < 2 {
+				return nem12.ErrInvalidB2bDetailsRecord
+			}
+			b2bDetailsRecord, err := nem12.ParseB2bDetailsRecord(record)
+			if err != nil {
+				return err
+			}
+			stats.TransCodes[nem12.ParseByteString(b2bDetailsRecord.TransCode[:])]++
+		}
+	}
+
+	statsDay := &statsDay{Intervals: n, Quality: make(map[string]int, 2)}
+	for _, intervalValue := range day.IntervalData.IntervalValue {
+		value, err := nem12.ParseIntervalValueDecimal(intervalValue, aggregateScale)
+		if err != nil {
+			return err
+		}
+		statsDay.Total += value
+	}
+	for _, qualityMethod := range job.QualityMethod {
+		if qualityMethod != "" {
+			statsDay.Quality[qualityMethod[:1]]++
+		}
+	}
+
+	date := day.IntervalData.IntervalDate.Format(jsonDateLayout)
+	if _, ok := channel.days[day.IntervalData.IntervalDate]; ok {
+		stats.DuplicateDays++
+	} else {
+		channel.Days++
+	}
+	// A day sent again replaces the earlier version.
+	channel.days[day.IntervalData.IntervalDate] = statsDay
+	if channel.FirstDate == "" || date < channel.FirstDate {
+		channel.FirstDate = date
+	}
+	if date > channel.LastDate {
+		channel.LastDate = date
+	}
+
+	return nil
+}
+
+// ReadNem12Stats reads a NEM12 file, named name, and profiles it.
+func ReadNem12Stats(reader io.Reader, name string) (*Nem12Stats, error) {
+	stats := &Nem12Stats{
+		File:            name,
+		IntervalLengths: make(map[int]int, 3),
+		Uoms:            make(map[string]*StatsUom, 4),
+		Quality:         make(map[string]int, 6),
+		TransCodes:      make(map[string]int, 4),
+	}
+	channels := make(map[StoreSeries]*StatsChannel, 64)
+
+	nem12Reader := NewNem12Reader(reader)
+	for {
+		block, err := nem12Reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		uom := nem12.ParseByteString(block.NmiDataDetails.Uom[:])
+		intervalLength, _ := strconv.Atoi(nem12.ParseByteString(block.NmiDataDetails.IntervalLength[:]))
+		stats.IntervalLengths[intervalLength]++
+
+		key := StoreSeries{block.Nmi, block.NmiSuffix, uom}
+		channel := channels[key]
+		if channel == nil {
+			channel = &StatsChannel{Nmi: block.Nmi, NmiSuffix: block.NmiSuffix, Uom: uom, days: make(map[time.Time]*statsDay, 32)}
+			channels[key] = channel
+		}
+		channel.IntervalLength = intervalLength
+
+		for _, day := range block.Days {
+			if err := stats.addDay(channel, day); err != nil {
+				return nil, fmt.Errorf("%s %s %s: %w", block.Nmi, block.NmiSuffix, day.IntervalData.IntervalDate.Format(jsonDateLayout), err)
+			}
+		}
+	}
+
+	header := nem12Reader.Header
+	stats.Version = nem12.ParseByteString(header.VersionHeader[:])
+	stats.DateTime = header.DateTime.Format(jsonTimestampLayout) + jsonMarketTimeOffset
+	stats.FromParticipant = nem12.ParseByteString(header.FromParticipant[:])
+	stats.ToParticipant = nem12.ParseByteString(header.ToParticipant[:])
+	stats.Records = nem12Reader.Records
+
+	nmis := make(map[string]struct{}, len(channels))
+	stats.Channels = make([]*StatsChannel, 0, len(channels))
+	for _, channel := range channels {
+		nmis[channel.Nmi] = struct{}{}
+		var total int64
+		for _, statsDay := range channel.days {
+			channel.Intervals += statsDay.Intervals
+			total += statsDay.Total
+			for quality, count := range statsDay.Quality {
+				stats.Quality[quality] += count
+			}
+		}
+		channel.Total = json.Number(appendScaledDecimal(nil, total, aggregateScale))
+		stats.Channels = append(stats.Channels, channel)
+
+		uom := stats.Uoms[channel.Uom]
+		if uom == nil {
+			uom = &StatsUom{}
+			stats.Uoms[channel.Uom] = uom
+		}
+		uom.Channels++
+		uom.Intervals += channel.Intervals
+		uom.total += total
+
+		if channel.FirstDate != "" && (stats.FirstDate == "" || channel.FirstDate < stats.FirstDate) {
+			stats.FirstDate = channel.FirstDate
+		}
+		if channel.LastDate > stats.LastDate {
+			stats.LastDate = channel.LastDate
+		}
+	}
+	stats.Nmis = len(nmis)
+	for _, uom := range stats.Uoms {
+		uom.Total = json.Number(appendScaledDecimal(nil, uom.total, aggregateScale))
+	}
+	sort.Slice(stats.Channels, func(i, j int) bool {
+		if stats.Channels[i].Nmi != stats.Channels[j].Nmi {
+			return stats.Channels[i].Nmi < stats.Channels[j].Nmi
+		}
+		if stats.Channels[i].NmiSuffix != stats.Channels[j].NmiSuffix {
+			return stats.Channels[i].NmiSuffix < stats.Channels[j].NmiSuffix
+		}
+		return stats.Channels[i].Uom < stats.Channels[j].Uom
+	})
+
+	return stats, nil
+}
+
+// sortedKeys returns the keys of counts, sorted.
+func sortedKeys[K int | string, V any](counts map[K]V) []K {
+	keys := make([]K, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// writeStatsText writes stats as a text report.
+func writeStatsText(writer io.Writer, stats *Nem12Stats) error {
+	tabWriter := tabwriter.NewWriter(writer, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintf(tabWriter, "%s\n", stats.File)
+	fmt.Fprintf(tabWriter, "header:\t%s %s %s -> %s\n", stats.Version, stats.DateTime, stats.FromParticipant, stats.ToParticipant)
+	var counts []string
+	for _, recordIndicator := range sortedKeys(stats.Records) {
+		counts = append(counts, fmt.Sprintf("%s: %d", recordIndicator, stats.Records[recordIndicator]))
+	}
+	fmt.Fprintf(tabWriter, "records:\t%s\n", strings.Join(counts, ", "))
+	fmt.Fprintf(tabWriter, "nmis:\t%d\n", stats.Nmis)
+	fmt.Fprintf(tabWriter, "channels:\t%d\n", len(stats.Channels))
+	fmt.Fprintf(tabWriter, "dates:\t%s to %s\n", stats.FirstDate, stats.LastDate)
+	counts = counts[:0]
+	for _, intervalLength := range sortedKeys(stats.IntervalLengths) {
+		counts = append(counts, fmt.Sprintf("%dm: %d", intervalLength, stats.IntervalLengths[intervalLength]))
+	}
+	fmt.Fprintf(tabWriter, "interval lengths:\t%s\n", strings.Join(counts, ", "))
+	fmt.Fprintf(tabWriter, "duplicate days:\t%d\n", stats.DuplicateDays)
+	counts = counts[:0]
+	for _, transCode := range sortedKeys(stats.TransCodes) {
+		counts = append(counts, fmt.Sprintf("%s: %d", transCode, stats.TransCodes[transCode]))
+	}
+	fmt.Fprintf(tabWriter, "trans codes:\t%s\n", strings.Join(counts, ", "))
+
+	fmt.Fprintf(tabWriter, "\nuom\tchannels\tintervals\ttotal\n")
+	for _, name := range sortedKeys(stats.Uoms) {
+		uom := stats.Uoms[name]
+		fmt.Fprintf(tabWriter, "%s\t%d\t%d\t%s\n", name, uom.Channels, uom.Intervals, uom.Total)
+	}
+	fmt.Fprintf(tabWriter, "\nquality\tintervals\n")
+	for _, quality := range sortedKeys(stats.Quality) {
+		fmt.Fprintf(tabWriter, "%s\t%d\n", quality, stats.Quality[quality])
+	}
+	fmt.Fprintf(tabWriter, "\nnmi\tsuffix\tuom\tinterval\tdays\tfirst_date\tlast_date\tintervals\ttotal\n")
+	for _, channel := range stats.Channels {
+		fmt.Fprintf(tabWriter, "%s\t%s\t%s\t%dm\t%d\t%s\t%s\t%d\t%s\n", channel.Nmi, channel.NmiSuffix, channel.Uom, channel.IntervalLength, channel.Days, channel.FirstDate, channel.LastDate, channel.Intervals, channel.Total)
+	}
+
+	return tabWriter.Flush()
+}
+
+// runStats runs the stats command: a profile of NEM12 files before loading them.
+func runStats(args []string) error {
+	flagSet := flag.NewFlagSet("stats", flag.ExitOnError)
+	format := flagSet.String("format", "text", "write the report as `text` or json")
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), "Usage: %s stats [flags] file...\n", os.Args[0])
+		flagSet.PrintDefaults()
+	}
+	flagSet.Parse(args)
+
+	if flagSet.NArg() == 0 || (*format != "text" && *format != "json") {
+		flagSet.Usage()
+		os.Exit(2)
+	}
+
+	files := make([]*Nem12Stats, 0, flagSet.NArg())
+	for _, name := range flagSet.Args() {
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		stats, err := ReadNem12Stats(file, name)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		files = append(files, stats)
+	}
+
+	writer := bufio.NewWriter(os.Stdout)
+	var err error
+	if *format == "json" {
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "\t")
+		err = encoder.Encode(map[string]any{"files": files})
+	} else {
+		for i, stats := range files {
+			if i > 0 {
+				fmt.Fprintln(writer)
+			}
+			if err = writeStatsText(writer, stats); err != nil {
+				break
+			}
+		}
+	}
+	return errors.Join(err, writer.Flush())
+}
@@ -0,0 +1,206 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Cheejyg/Flo-Energy-Tech-Assessment/nem12"
+)
+
+func init() {
+	RegisterSink("store", func(config *SinkConfig) (Sink, error) {
+		if config.Append {
+			return nil, ErrSinkNotResumable
+		}
+		return OpenStore(config.Target)
+	})
+}
+
+const storeExtension string = ".readings"
+const storeRecordSize int = 24
+const storeScale int = 6 // Values are stored as fixed-point decimals.
+
+// StoreSeries identifies one NMI channel in a Store.
+type StoreSeries struct {
+	Nmi       string
+	NmiSuffix string
+	Uom       string
+}
+
+// storeEscape escapes s for use in a file name, including the dots that separate the fields of one.
+func storeEscape(s string) string {
+	return strings.ReplaceAll(url.PathEscape(s), ".", "%2E")
+}
+func (storeSeries StoreSeries) fileName() string {
+	return storeEscape(storeSeries.Nmi) + "." + storeEscape(storeSeries.NmiSuffix) + "." + storeEscape(storeSeries.Uom) + storeExtension
+}
+func parseStoreSeries(name string) (StoreSeries, bool) {
+	parts := strings.Split(strings.TrimSuffix(name, storeExtension), ".")
+	if len(parts) != 3 || !strings.HasSuffix(name, storeExtension) {
+		return StoreSeries{}, false
+	}
+
+	var storeSeries StoreSeries
+	var err error
+	if storeSeries.Nmi, err = url.PathUnescape(parts[0]); err != nil {
+		return StoreSeries{}, false
+	}
+	if storeSeries.NmiSuffix, err = url.PathUnescape(parts[1]); err != nil {
+		return StoreSeries{}, false
+	}
+	if storeSeries.Uom, err = url.PathUnescape(parts[2]); err != nil {
+		return StoreSeries{}, false
+	}
+
+	return storeSeries, true
+}
+
+// StoreReading is one interval reading. Times are market time.
+type StoreReading struct {
+	Timestamp      time.Time // End of the interval.
+	IntervalLength time.Duration
+	Value          int64 // Scaled by 10^storeScale.
+	QualityMethod  string
+}
+
+func (storeReading *StoreReading) Start() time.Time {
+	return storeReading.Timestamp.Add(-storeReading.IntervalLength)
+}
+
+// Store is an embedded, append-only store of interval readings: a directory with one file of fixed-size records per NMI channel. Readings are kept in arrival order; a reading for an interval that was already stored replaces it when read.
+//
+// Each record is the interval end (Unix seconds of market time), the value scaled by 10^storeScale, the interval length in seconds, and the quality method.
+type Store struct {
+	Dir string
+}
+
+func OpenStore(dir string) (*Store, error) {
+	if dir == "" {
+		return nil, ErrInvalidSinkOption
+	}
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+
+	return &Store{Dir: dir}, nil
+}
+
+// WriteBatch appends meterReadingsJob to the file of each series, one write per series.
+func (store *Store) WriteBatch(meterReadingsJob []*MeterReadingsJob) error {
+	series := make(map[StoreSeries]*bytes.Buffer, 8)
+	var order []StoreSeries
+	var record [storeRecordSize]byte
+	for i := range meterReadingsJob {
+		key := StoreSeries{meterReadingsJob[i].Nmi, meterReadingsJob[i].NmiSuffix, meterReadingsJob[i].Uom}
+		buffer := series[key]
+		if buffer == nil {
+			buffer = &bytes.Buffer{}
+			series[key] = buffer
+			order = append(order, key)
+		}
+
+		value, err := nem12.ParseIntervalValueDecimal(meterReadingsJob[i].Consumption, storeScale)
+		if err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint64(record[0:], uint64(meterReadingsJob[i].Timestamp.Unix()))
+		binary.LittleEndian.PutUint64(record[8:], uint64(value))
+		binary.LittleEndian.PutUint32(record[16:], uint32(meterReadingsJob[i].IntervalLength/time.Second))
+		copy(record[20:24], append([]byte(meterReadingsJob[i].QualityMethod), 0, 0, 0, 0))
+		buffer.Write(record[:])
+	}
+
+	for _, key := range order {
+		file, err := os.OpenFile(filepath.Join(store.Dir, key.fileName()), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			return err
+		}
+		_, err = file.Write(series[key].Bytes())
+		if err := errors.Join(err, file.Close()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+func (store *Store) Flush() error {
+	return nil
+}
+func (store *Store) Close() error {
+	return nil
+}
+
+// Series lists every series in the store, sorted.
+func (store *Store) Series() ([]StoreSeries, error) {
+	entries, err := os.ReadDir(store.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var series []StoreSeries
+	for _, entry := range entries {
+		if storeSeries, ok := parseStoreSeries(entry.Name()); ok && entry.Type().IsRegular() {
+			series = append(series, storeSeries)
+		}
+	}
+	sort.Slice(series, func(i, j int) bool {
+		if series[i].Nmi != series[j].Nmi {
+			return series[i].Nmi < series[j].Nmi
+		}
+		if series[i].NmiSuffix != series[j].NmiSuffix {
+			return series[i].NmiSuffix < series[j].NmiSuffix
+		}
+		return series[i].Uom < series[j].Uom
+	})
+
+	return series, nil
+}
+
+// Readings returns the readings of storeSeries whose intervals start in [from, to), in time order. Zero times leave the range open.
+func (store *Store) Readings(storeSeries StoreSeries, from time.Time, to time.Time) ([]StoreReading, error) {
+	b, err := os.ReadFile(filepath.Join(store.Dir, storeSeries.fileName()))
+	if err != nil {
+		return nil, err
+	}
+	// A record still being appended by a writer is left for the next read.
+	b = b[:len(b)-len(b)%storeRecordSize]
+
+	readings := make([]StoreReading, 0, len(b)/storeRecordSize)
+	for i := 0; i < len(b); i += storeRecordSize {
+		storeReading := StoreReading{
+			Timestamp:      time.Unix(int64(binary.LittleEndian.Uint64(b[i:])), 0).UTC(),
+			Value:          int64(binary.LittleEndian.Uint64(b[i+8:])),
+			IntervalLength: time.Duration(binary.LittleEndian.Uint32(b[i+16:])) * time.Second,
+			QualityMethod:  string(bytes.TrimRight(b[i+20:i+24], "\x00")),
+		}
+		start := storeReading.Start()
+		if (!from.IsZero() && start.Before(from)) || (!to.IsZero() && !start.Before(to)) {
+			continue
+		}
+		readings = append(readings, storeReading)
+	}
+
+	// Resent days repeat intervals; the reading stored last wins.
+	sort.SliceStable(readings, func(i, j int) bool {
+		return readings[i].Timestamp.Before(readings[j].Timestamp)
+	})
+	deduplicated := readings[:0]
+	for i := range readings {
+		if len(deduplicated) > 0 && deduplicated[len(deduplicated)-1].Timestamp.Equal(readings[i].Timestamp) {
+			deduplicated[len(deduplicated)-1] = readings[i]
+		} else {
+			deduplicated = append(deduplicated, readings[i])
+		}
+	}
+
+	return deduplicated, nil
+}
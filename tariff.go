@@ -0,0 +1,533 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Cheejyg/Flo-Energy-Tech-Assessment/nem12"
+)
+
+func init() {
+	RegisterSink("tariff", func(config *SinkConfig) (Sink, error) {
+		if config.Append {
+			return nil, ErrSinkNotResumable
+		}
+
+		tariff, err := LoadTariff(config.Options.Get("tariff"))
+		if err != nil {
+			return nil, err
+		}
+		dates, err := parseDatesOption(config.Options)
+		if err != nil {
+			return nil, err
+		}
+		format := reportFormat(config)
+		channels := strings.Split(sinkOption(config.Options, "channels", "E"), ",")
+
+		return newFileSink(config, func(writer io.Writer) (Sink, error) {
+			return NewTariffWriter(writer, tariff, dates, channels, format)
+		})
+	})
+}
+
+var ErrInvalidTariff = errors.New("invalid tariff")
+
+const tariffHoliday string = "holiday"
+
+var tariffWeekdays = map[string][]time.Weekday{
+	"sun":     {time.Sunday},
+	"mon":     {time.Monday},
+	"tue":     {time.Tuesday},
+	"wed":     {time.Wednesday},
+	"thu":     {time.Thursday},
+	"fri":     {time.Friday},
+	"sat":     {time.Saturday},
+	"weekday": {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	"weekend": {time.Saturday, time.Sunday},
+}
+
+// TariffWindow applies Period to intervals starting between Start and End (HH:MM, End exclusive, 24:00 for midnight) on Days: mon to sun, weekday, weekend or holiday. A window with Start after End runs over midnight.
+type TariffWindow struct {
+	Period string   `json:"period"`
+	Days   []string `json:"days"`
+	Start  string   `json:"start"`
+	End    string   `json:"end"`
+
+	start, end int // Minutes after midnight.
+	weekdays   [7]bool
+	holiday    bool
+}
+
+// TariffSeason prices each period, per unit, in Months; DailySupplyCharge overrides the tariff's if set.
+type TariffSeason struct {
+	Name              string             `json:"name"`
+	Months            []int              `json:"months"`
+	Rates             map[string]float64 `json:"rates"`
+	DailySupplyCharge *float64           `json:"daily_supply_charge,omitempty"`
+}
+
+// Tariff is a declarative time-of-use tariff, loaded from JSON, or YAML (see yamlToJson), e.g.
+//
+//	{
+//		"name": "Residential TOU",
+//		"daily_supply_charge": 1.05,
+//		"default_period": "off_peak",
+//		"windows": [
+//			{"period": "peak", "days": ["weekday"], "start": "14:00", "end": "20:00"},
+//			{"period": "shoulder", "days": ["weekday"], "start": "07:00", "end": "14:00"}
+//		],
+//		"seasons": [
+//			{"name": "summer", "months": [12, 1, 2], "rates": {"peak": 0.52, "shoulder": 0.31, "off_peak": 0.19}},
+//			{"name": "non-summer", "months": [3, 4, 5, 6, 7, 8, 9, 10, 11], "rates": {"peak": 0.44, "shoulder": 0.29, "off_peak": 0.19}}
+//		],
+//		"holidays": ["2005-01-01", "2005-01-26"]
+//	}
+//
+// The first window matching an interval's start sets its period, otherwise DefaultPeriod applies. Public holidays only match windows listing holiday.
+type Tariff struct {
+	Name              string         `json:"name"`
+	DailySupplyCharge float64        `json:"daily_supply_charge"`
+	DefaultPeriod     string         `json:"default_period"`
+	Windows           []TariffWindow `json:"windows"`
+	Seasons           []TariffSeason `json:"seasons"`
+	Holidays          []string       `json:"holidays"`
+
+	seasons  [13]*TariffSeason // By month.
+	holidays map[time.Time]bool
+}
+
+func parseTariffTime(value string) (int, error) {
+	hours, minutes, ok := strings.Cut(value, ":")
+	h, err := strconv.Atoi(hours)
+	if !ok || err != nil {
+		return 0, fmt.Errorf("%w: time %q, want HH:MM", ErrInvalidTariff, value)
+	}
+	m, err := strconv.Atoi(minutes)
+	if err != nil || h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, fmt.Errorf("%w: time %q, want HH:MM", ErrInvalidTariff, value)
+	}
+	return h*60 + m, nil
+}
+
+func LoadTariff(name string) (*Tariff, error) {
+	if name == "" {
+		return nil, fmt.Errorf("%w: missing tariff file", ErrInvalidSinkOption)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(name, ".yaml") || strings.HasSuffix(name, ".yml") {
+		if data, err = yamlToJson(data); err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidTariff, name, err)
+		}
+	}
+
+	var tariff Tariff
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&tariff); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidTariff, name, err)
+	}
+	if err := tariff.compile(); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return &tariff, nil
+}
+
+// compile validates tariff and indexes its windows, seasons and holidays.
+func (tariff *Tariff) compile() error {
+	if tariff.DefaultPeriod == "" {
+		return fmt.Errorf("%w: missing default_period", ErrInvalidTariff)
+	}
+	periods := map[string]bool{tariff.DefaultPeriod: true}
+
+	for i := range tariff.Windows {
+		window := &tariff.Windows[i]
+		var err error
+		if window.start, err = parseTariffTime(window.Start); err != nil {
+			return err
+		}
+		if window.end, err = parseTariffTime(window.End); err != nil {
+			return err
+		}
+		if len(window.Days) == 0 {
+			return fmt.Errorf("%w: window %d has no days", ErrInvalidTariff, i+1)
+		}
+		for _, day := range window.Days {
+			day = strings.ToLower(day)
+			if day == tariffHoliday {
+				window.holiday = true
+				continue
+			}
+			weekdays, ok := tariffWeekdays[day]
+			if !ok {
+				return fmt.Errorf("%w: day %q", ErrInvalidTariff, day)
+			}
+			for _, weekday := range weekdays {
+				window.weekdays[weekday] = true
+			}
+		}
+		periods[window.Period] = true
+	}
+
+	for i := range tariff.Seasons {
+		season := &tariff.Seasons[i]
+		for _, month := range season.Months {
+			if month < 1 || month > 12 || tariff.seasons[month] != nil {
+				return fmt.Errorf("%w: season %s: month %d is invalid or in another season", ErrInvalidTariff, season.Name, month)
+			}
+			tariff.seasons[month] = season
+		}
+		for period := range periods {
+			if _, ok := season.Rates[period]; !ok {
+				return fmt.Errorf("%w: season %s has no rate for %s", ErrInvalidTariff, season.Name, period)
+			}
+		}
+	}
+	for month := 1; month <= 12; month++ {
+		if tariff.seasons[month] == nil {
+			return fmt.Errorf("%w: no season for month %d", ErrInvalidTariff, month)
+		}
+	}
+
+	tariff.holidays = make(map[time.Time]bool, len(tariff.Holidays))
+	for _, holiday := range tariff.Holidays {
+		date, err := time.Parse(jsonDateLayout, holiday)
+		if err != nil {
+			return fmt.Errorf("%w: holiday %q, want YYYY-MM-DD", ErrInvalidTariff, holiday)
+		}
+		tariff.holidays[date] = true
+	}
+
+	return nil
+}
+
+// Classify returns the season and period of an interval starting at start, in market time.
+func (tariff *Tariff) Classify(start time.Time) (*TariffSeason, string) {
+	date := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	holiday := tariff.holidays[date]
+	minute := start.Hour()*60 + start.Minute()
+
+	season := tariff.seasons[start.Month()]
+	for i := range tariff.Windows {
+		window := &tariff.Windows[i]
+		if holiday && !window.holiday || !holiday && !window.weekdays[start.Weekday()] {
+			continue
+		}
+		if window.start <= window.end && minute >= window.start && minute < window.end || window.start > window.end && (minute >= window.start || minute < window.end) {
+			return season, window.Period
+		}
+	}
+
+	return season, tariff.DefaultPeriod
+}
+
+func (tariff *Tariff) dailySupplyCharge(season *TariffSeason) float64 {
+	if season.DailySupplyCharge != nil {
+		return *season.DailySupplyCharge
+	}
+	return tariff.DailySupplyCharge
+}
+
+// tariffDay is one channel's consumption on one interval date, per season and period, from the last 300 record read for it.
+type tariffDay struct {
+	Quantity   map[string]int64 // By season and period, scaled by 10^aggregateScale.
+	Source     *SourceFile
+	LineNumber int
+}
+
+type tariffItem struct {
+	Description string  `json:"description"`
+	Quantity    float64 `json:"quantity"`
+	Unit        string  `json:"unit"`
+	Rate        float64 `json:"rate"`
+	Amount      float64 `json:"amount"`
+}
+type tariffBill struct {
+	Nmi    string       `json:"nmi"`
+	Tariff string       `json:"tariff"`
+	Start  *string      `json:"start"`
+	End    *string      `json:"end"` // Exclusive.
+	Days   int          `json:"days"`
+	Items  []tariffItem `json:"items"`
+	Total  float64      `json:"total"`
+}
+
+// TariffWriter bills each NMI's import channels under a Tariff per billing period, and writes itemised bills as CSV or JSON on Close.
+//
+// Billing periods run between the given dates, or, if there are none, between the NextScheduledReadDates of each NMI's 200 records. Usage is itemised by season, period and unit of measure, so that channels read in different units are not summed. Supply is charged for each day with readings.
+type TariffWriter struct {
+	report   *reportWriter
+	tariff   *Tariff
+	dates    []time.Time
+	channels []string // NMI suffix prefixes to bill, e.g. E for import.
+
+	days              map[StoreSeries]map[time.Time]*tariffDay
+	nextScheduledRead map[string]map[time.Time]bool
+}
+
+func NewTariffWriter(writer io.Writer, tariff *Tariff, dates []time.Time, channels []string, format string) (*TariffWriter, error) {
+	report, err := newReportWriter(writer, format)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TariffWriter{
+		report:            report,
+		tariff:            tariff,
+		dates:             dates,
+		channels:          channels,
+		days:              make(map[StoreSeries]map[time.Time]*tariffDay, 16),
+		nextScheduledRead: make(map[string]map[time.Time]bool, 16),
+	}, nil
+}
+
+func (tariffWriter *TariffWriter) billed(nmiSuffix string) bool {
+	for _, prefix := range tariffWriter.channels {
+		if strings.HasPrefix(nmiSuffix, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (tariffWriter *TariffWriter) WriteBatch(meterReadingsJob []*MeterReadingsJob) error {
+	for _, job := range meterReadingsJob {
+		if !tariffWriter.billed(job.NmiSuffix) {
+			continue
+		}
+		value, err := nem12.ParseIntervalValueDecimal(job.Consumption, aggregateScale)
+		if err != nil {
+			return err
+		}
+
+		channel := StoreSeries{job.Nmi, job.NmiSuffix, job.Uom}
+		days := tariffWriter.days[channel]
+		if days == nil {
+			days = make(map[time.Time]*tariffDay, 64)
+			tariffWriter.days[channel] = days
+		}
+
+		start := job.Timestamp.Add(-job.IntervalLength)
+		date := start.Truncate(24 * time.Hour)
+		if job.IntervalData != nil {
+			date = job.IntervalData.IntervalDate
+		}
+		day := days[date]
+		// A day sent again in a later 300 record replaces the earlier one.
+		if day == nil || day.Source != job.Source || day.LineNumber != job.LineNumber {
+			day = &tariffDay{Quantity: make(map[string]int64, 4), Source: job.Source, LineNumber: job.LineNumber}
+			days[date] = day
+		}
+		season, period := tariffWriter.tariff.Classify(start)
+		day.Quantity[season.Name+"\x00"+period] += value
+
+		if job.NmiDataDetails != nil && job.NmiDataDetails.NextScheduledReadDate != nil {
+			nextScheduledRead := tariffWriter.nextScheduledRead[job.Nmi]
+			if nextScheduledRead == nil {
+				nextScheduledRead = make(map[time.Time]bool, 4)
+				tariffWriter.nextScheduledRead[job.Nmi] = nextScheduledRead
+			}
+			nextScheduledRead[*job.NmiDataDetails.NextScheduledReadDate] = true
+		}
+	}
+
+	return nil
+}
+
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// bills totals the channels of each NMI per billing period.
+func (tariffWriter *TariffWriter) bills() []*tariffBill {
+	type billKey struct {
+		Nmi        string
+		Start, End time.Time
+	}
+	type billUsage struct {
+		Quantity map[string]int64 // By season, period and unit of measure.
+		Days     map[time.Time]bool
+	}
+	usage := make(map[billKey]*billUsage, 16)
+	for channel, days := range tariffWriter.days {
+		boundaries := billingBoundaries(tariffWriter.dates, tariffWriter.nextScheduledRead[channel.Nmi])
+		for date, day := range days {
+			start, end := billingPeriodOf(date, boundaries)
+			key := billKey{channel.Nmi, start, end}
+			periodUsage := usage[key]
+			if periodUsage == nil {
+				periodUsage = &billUsage{Quantity: make(map[string]int64, 8), Days: make(map[time.Time]bool, 32)}
+				usage[key] = periodUsage
+			}
+			for item, quantity := range day.Quantity {
+				periodUsage.Quantity[item+"\x00"+channel.Uom] += quantity
+			}
+			periodUsage.Days[date] = true
+		}
+	}
+
+	keys := make([]billKey, 0, len(usage))
+	for key := range usage {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Nmi != keys[j].Nmi {
+			return keys[i].Nmi < keys[j].Nmi
+		}
+		return keys[i].Start.Before(keys[j].Start)
+	})
+
+	bills := make([]*tariffBill, 0, len(keys))
+	for _, key := range keys {
+		periodUsage := usage[key]
+		bill := &tariffBill{
+			Nmi:    key.Nmi,
+			Tariff: tariffWriter.tariff.Name,
+			Days:   len(periodUsage.Days),
+		}
+		if !key.Start.IsZero() {
+			start := key.Start.Format(jsonDateLayout)
+			bill.Start = &start
+		}
+		if !key.End.IsZero() {
+			end := key.End.Format(jsonDateLayout)
+			bill.End = &end
+		}
+
+		items := make([]string, 0, len(periodUsage.Quantity))
+		for item := range periodUsage.Quantity {
+			items = append(items, item)
+		}
+		sort.Strings(items)
+		for _, item := range items {
+			seasonName, period, _ := strings.Cut(item, "\x00")
+			period, uom, _ := strings.Cut(period, "\x00")
+			var season *TariffSeason
+			for i := range tariffWriter.tariff.Seasons {
+				if tariffWriter.tariff.Seasons[i].Name == seasonName {
+					season = &tariffWriter.tariff.Seasons[i]
+				}
+			}
+			quantity, _ := strconv.ParseFloat(string(appendScaledDecimal(nil, periodUsage.Quantity[item], aggregateScale)), 64)
+			rate := season.Rates[period]
+			bill.Items = append(bill.Items, tariffItem{
+				Description: strings.TrimSpace(seasonName + " " + period),
+				Quantity:    quantity,
+				Unit:        uom,
+				Rate:        rate,
+				Amount:      roundCents(quantity * rate),
+			})
+		}
+
+		// Supply is charged at the rate of the season of each day.
+		supply := make(map[*TariffSeason]int, 2)
+		for date := range periodUsage.Days {
+			supply[tariffWriter.tariff.seasons[date.Month()]]++
+		}
+		for i := range tariffWriter.tariff.Seasons {
+			season := &tariffWriter.tariff.Seasons[i]
+			if days := supply[season]; days > 0 {
+				rate := tariffWriter.tariff.dailySupplyCharge(season)
+				bill.Items = append(bill.Items, tariffItem{
+					Description: strings.TrimSpace(season.Name + " daily supply charge"),
+					Quantity:    float64(days),
+					Unit:        "day",
+					Rate:        rate,
+					Amount:      roundCents(float64(days) * rate),
+				})
+			}
+		}
+
+		for i := range bill.Items {
+			bill.Total += bill.Items[i].Amount
+		}
+		bill.Total = roundCents(bill.Total)
+
+		bills = append(bills, bill)
+	}
+
+	return bills
+}
+
+func (tariffWriter *TariffWriter) Flush() error {
+	return nil
+}
+
+// Close writes the bills: one JSON array of bills, or one CSV row per item. It does not close the underlying writer.
+func (tariffWriter *TariffWriter) Close() error {
+	bills := tariffWriter.bills()
+	report := tariffWriter.report
+
+	if report.asJson {
+		encoder := json.NewEncoder(report)
+		encoder.SetIndent("", "\t")
+		if err := encoder.Encode(bills); err != nil {
+			return err
+		}
+		return report.Flush()
+	}
+
+	if err := report.Begin("nmi,tariff,start,end,days,item,quantity,unit,rate,amount"); err != nil {
+		return err
+	}
+	line := make([]byte, 0, 256)
+	for _, bill := range bills {
+		items := append(bill.Items, tariffItem{Description: "total", Amount: bill.Total})
+		for _, item := range items {
+			line = report.Field(line[:0], "nmi")
+			line = append(line, bill.Nmi...)
+			line = report.Field(line, "tariff")
+			line = append(line, csvQuote(bill.Tariff)...)
+			line = report.Field(line, "start")
+			if bill.Start != nil {
+				line = append(line, *bill.Start...)
+			}
+			line = report.Field(line, "end")
+			if bill.End != nil {
+				line = append(line, *bill.End...)
+			}
+			line = report.Field(line, "days")
+			line = strconv.AppendInt(line, int64(bill.Days), 10)
+			line = report.Field(line, "item")
+			line = append(line, csvQuote(item.Description)...)
+			line = report.Field(line, "quantity")
+			if item.Unit != "" {
+				line = strconv.AppendFloat(line, item.Quantity, 'f', -1, 64)
+			}
+			line = report.Field(line, "unit")
+			line = append(line, item.Unit...)
+			line = report.Field(line, "rate")
+			if item.Unit != "" {
+				line = strconv.AppendFloat(line, item.Rate, 'f', -1, 64)
+			}
+			line = report.Field(line, "amount")
+			line = strconv.AppendFloat(line, item.Amount, 'f', 2, 64)
+			if err := report.Record(line); err != nil {
+				return err
+			}
+		}
+	}
+
+	return report.End()
+}
+
+func csvQuote(s string) string {
+	if !strings.ContainsAny(s, ",\"\n\r") {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadTariff(t *testing.T) {
+	want, err := LoadTariff("tariff.example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadTariff("tariff.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tariff.example.yaml:\n%+v\nwant that of tariff.example.json:\n%+v", got, want)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		err     error
+	}{
+		{"no default period", "windows: []\n", ErrInvalidTariff},
+		{"unknown field", "default_period: off_peak\ncolour: red\n", ErrInvalidTariff},
+		{"tab indentation", "seasons:\n\t- name: summer\n", ErrInvalidYaml},
+		{"anchor", "default_period: &period off_peak\n", ErrInvalidYaml},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "tariff.yaml")
+			if err := os.WriteFile(name, []byte(test.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadTariff(name); !errors.Is(err, test.err) {
+				t.Errorf("got %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestTariffClassify(t *testing.T) {
+	tariff, err := LoadTariff("tariff.example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		start  string
+		season string
+		period string
+	}{
+		{"2005-03-01T15:00", "summer", "peak"},
+		{"2005-03-14T15:00", "summer", "off_peak"}, // A public holiday.
+		{"2005-06-01T07:00", "non-summer", "shoulder"},
+		{"2005-06-01T19:30", "non-summer", "peak"},
+		{"2005-06-01T22:00", "non-summer", "off_peak"},
+		{"2005-06-04T15:00", "non-summer", "off_peak"}, // A Saturday.
+	}
+	for _, test := range tests {
+		start, err := time.Parse("2006-01-02T15:04", test.start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if season, period := tariff.Classify(start); season.Name != test.season || period != test.period {
+			t.Errorf("Classify(%s) = %s %s, want %s %s", test.start, season.Name, period, test.season, test.period)
+		}
+	}
+}
+
+// TestTariffWriterUnits bills an NMI with channels read in kWh and Wh, which are itemised apart rather than summed.
+func TestTariffWriterUnits(t *testing.T) {
+	tariff, err := LoadTariff("tariff.example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := loadTestNem12(t, []byte(testNem12(
+		testHeaderLine,
+		testBlockLine("NEM1201009", "E1"),
+		testDayLine("20050601", "1", ""),
+		strings.Replace(testBlockLine("NEM1201009", "E2"), ",kWh,", ",Wh,", 1),
+		testDayLine("20050601", "1000", ""),
+		"900",
+	)))
+
+	var b bytes.Buffer
+	tariffWriter, err := NewTariffWriter(&b, tariff, nil, []string{"E"}, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tariffWriter.WriteBatch(sink.jobs); err != nil {
+		t.Fatal(err)
+	}
+	if err := tariffWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var bills []tariffBill
+	if err := json.Unmarshal(b.Bytes(), &bills); err != nil {
+		t.Fatal(err)
+	}
+	if len(bills) != 1 || bills[0].Days != 1 {
+		t.Fatalf("got bills %+v", bills)
+	}
+	want := []tariffItem{
+		{"non-summer off_peak", 18000, "Wh", 0.1898, 3416.4},
+		{"non-summer off_peak", 18, "kWh", 0.1898, 3.42},
+		{"non-summer peak", 12000, "Wh", 0.4422, 5306.4},
+		{"non-summer peak", 12, "kWh", 0.4422, 5.31},
+		{"non-summer shoulder", 18000, "Wh", 0.2935, 5283},
+		{"non-summer shoulder", 18, "kWh", 0.2935, 5.28},
+		{"non-summer daily supply charge", 1, "day", 1.05, 1.05},
+	}
+	if !reflect.DeepEqual(bills[0].Items, want) {
+		t.Errorf("got items\n%+v\nwant\n%+v", bills[0].Items, want)
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// watchedFile tracks a file in the inbox until its size and modification time have stopped changing.
+type watchedFile struct {
+	Size    int64
+	ModTime time.Time
+	Stable  int // Consecutive polls without a change.
+}
+
+// Watcher polls Dir for NEM12 files and loads each into Sink once it has been stable for StablePolls polls, then moves it to ArchiveDir, or to ErrorDir with a sidecar report.
+type Watcher struct {
+	Dir         string
+	ArchiveDir  string
+	ErrorDir    string
+	Interval    time.Duration
+	StablePolls int
+	Concurrency int
+	Sink        Sink
+
+	mutex      sync.Mutex
+	files      map[string]*watchedFile
+	processing map[string]bool
+}
+
+// ignoreWatchedFile skips hidden files and the temporary names SFTP clients upload to before renaming.
+func ignoreWatchedFile(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".part") || strings.HasSuffix(name, ".filepart") || strings.HasSuffix(name, ".tmp")
+}
+
+// poll returns the files that have become stable since the previous poll.
+func (watcher *Watcher) poll() ([]string, error) {
+	entries, err := os.ReadDir(watcher.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+
+	seen := make(map[string]bool, len(entries))
+	var ready []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || ignoreWatchedFile(name) || watcher.processing[name] {
+			continue
+		}
+		fileInfo, err := entry.Info()
+		if err != nil {
+			continue // Moved away since ReadDir.
+		}
+		seen[name] = true
+
+		file := watcher.files[name]
+		if file == nil || file.Size != fileInfo.Size() || !file.ModTime.Equal(fileInfo.ModTime()) {
+			watcher.files[name] = &watchedFile{Size: fileInfo.Size(), ModTime: fileInfo.ModTime()}
+			continue
+		}
+		file.Stable++
+		if file.Stable >= watcher.StablePolls {
+			delete(watcher.files, name)
+			watcher.processing[name] = true
+			ready = append(ready, name)
+		}
+	}
+	for name := range watcher.files {
+		if !seen[name] {
+			delete(watcher.files, name)
+		}
+	}
+
+	return ready, nil
+}
+
+// moveFile moves name into dir, adding a timestamp if a file of that name is already there, and returns its new path.
+func moveFile(name string, dir string) (string, error) {
+	target := filepath.Join(dir, filepath.Base(name))
+	if _, err := os.Stat(target); err == nil {
+		extension := filepath.Ext(target)
+		target = strings.TrimSuffix(target, extension) + "." + time.Now().Format("20060102150405.000000000") + extension
+	}
+
+	return target, os.Rename(name, target)
+}
+
+func (watcher *Watcher) process(name string) error {
+	path := filepath.Join(watcher.Dir, name)
+	defer func() {
+		watcher.mutex.Lock()
+		delete(watcher.processing, name)
+		watcher.mutex.Unlock()
+	}()
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	summary, err := ingestNem12(file, name, "", watcher.Sink)
+	file.Close()
+	if err == nil && summary.Loaded {
+		log.Printf("%s: loaded %d rows for %d NMIs", name, summary.Rows, len(summary.Nmis))
+		_, err := moveFile(path, watcher.ArchiveDir)
+		return err
+	}
+
+	if summary == nil {
+		summary = &UploadSummary{File: name, Nmis: []string{}, Warnings: []string{}}
+	}
+	if err != nil {
+		summary.Errors = append(summary.Errors, err.Error())
+	}
+	log.Printf("%s: failed: %s", name, strings.Join(summary.Errors, "; "))
+
+	target, err := moveFile(path, watcher.ErrorDir)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(summary, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(target+".report.json", append(b, '\n'), 0666)
+}
+
+// Run polls until ctx is done, then waits for files in progress.
+func (watcher *Watcher) Run(ctx context.Context) error {
+	for _, dir := range []string{watcher.ArchiveDir, watcher.ErrorDir} {
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			return err
+		}
+	}
+	watcher.files = make(map[string]*watchedFile, 64)
+	watcher.processing = make(map[string]bool, watcher.Concurrency)
+
+	semaphore := make(chan struct{}, watcher.Concurrency)
+	var waitGroup sync.WaitGroup
+	defer waitGroup.Wait()
+
+	ticker := time.NewTicker(watcher.Interval)
+	defer ticker.Stop()
+	for {
+		ready, err := watcher.poll()
+		if err != nil {
+			return err
+		}
+		for _, name := range ready {
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+				return nil
+			}
+			waitGroup.Add(1)
+			go func() {
+				defer waitGroup.Done()
+				defer func() { <-semaphore }()
+				if err := watcher.process(name); err != nil {
+					log.Printf("%s: %v", name, err)
+				}
+			}()
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// runWatch runs the watch command: load NEM12 files as they arrive in a directory until interrupted.
+func runWatch(args []string) error {
+	flagSet := flag.NewFlagSet("watch", flag.ExitOnError)
+	var sinkSpecs sinkFlag
+	flagSet.Var(&sinkSpecs, "sink", "write meter readings to `name:target?options`, may be repeated (default copy:meter_readings.sql.csv)")
+	interval := flagSet.Duration("interval", 5*time.Second, "poll the directory every `duration`")
+	stablePolls := flagSet.Int("stable", 2, "load a file once its size is unchanged for `n` polls")
+	concurrency := flagSet.Int("concurrency", 4, "load at most `n` files at once")
+	archiveDir := flagSet.String("archive", "", "move loaded files to `dir` (default <dir>/archive)")
+	errorDir := flagSet.String("error", "", "move failed files and their reports to `dir` (default <dir>/error)")
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), "Usage: %s watch [flags] dir\n", os.Args[0])
+		flagSet.PrintDefaults()
+		fmt.Fprintf(flagSet.Output(), "Sinks: %s\n", strings.Join(SinkNames(), ", "))
+	}
+	flagSet.Parse(args)
+
+	if flagSet.NArg() != 1 {
+		flagSet.Usage()
+		os.Exit(2)
+	}
+	dir := flagSet.Arg(0)
+	if *archiveDir == "" {
+		*archiveDir = filepath.Join(dir, "archive")
+	}
+	if *errorDir == "" {
+		*errorDir = filepath.Join(dir, "error")
+	}
+	if *concurrency < 1 || *stablePolls < 1 || *interval <= 0 {
+		return errors.New("watch: -concurrency, -stable and -interval must be positive")
+	}
+
+	if len(sinkSpecs) == 0 {
+		sinkSpecs = sinkFlag{"copy:meter_readings.sql.csv"}
+	}
+	sink, err := OpenSinks(sinkSpecs, nil)
+	if err != nil {
+		return err
+	}
+
+	watcher := &Watcher{
+		Dir:         dir,
+		ArchiveDir:  *archiveDir,
+		ErrorDir:    *errorDir,
+		Interval:    *interval,
+		StablePolls: *stablePolls,
+		Concurrency: *concurrency,
+		Sink:        lockedSink{&sync.Mutex{}, sink},
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Println("watching", dir)
+	err = watcher.Run(ctx)
+
+	return errors.Join(err, sink.Close())
+}
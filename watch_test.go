@@ -0,0 +1,107 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func newTestWatcher(t *testing.T, sink Sink) *Watcher {
+	t.Helper()
+	dir := t.TempDir()
+	watcher := &Watcher{
+		Dir:         dir,
+		ArchiveDir:  filepath.Join(dir, "archive"),
+		ErrorDir:    filepath.Join(dir, "error"),
+		StablePolls: 2,
+		Concurrency: 1,
+		Sink:        sink,
+		files:       map[string]*watchedFile{},
+		processing:  map[string]bool{},
+	}
+	for _, dir := range []string{watcher.ArchiveDir, watcher.ErrorDir} {
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return watcher
+}
+
+func TestWatcherProcess(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		dir    string // Where the file ends up, archive or error.
+		rows   int
+		failed bool
+	}{
+		{"loaded", testNem12(testHeaderLine, testBlockLine("NEM1201009", "E1"), testDayLine("20050301", "1", ""), "900"), "archive", 48, false},
+		{"bare 200 without a newline", testHeaderLine + "\n200", "error", 0, true},
+		{"bare 300", testNem12(testHeaderLine, testBlockLine("NEM1201009", "E1"), "300"), "error", 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sink := &testSink{}
+			watcher := newTestWatcher(t, sink)
+			if err := os.WriteFile(filepath.Join(watcher.Dir, "a.csv"), []byte(test.file), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := watcher.process("a.csv"); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := os.Stat(filepath.Join(watcher.Dir, test.dir, "a.csv")); err != nil {
+				t.Errorf("not moved to %s: %v", test.dir, err)
+			}
+			if len(sink.jobs) != test.rows {
+				t.Errorf("sink got %d rows, want %d", len(sink.jobs), test.rows)
+			}
+
+			b, err := os.ReadFile(filepath.Join(watcher.ErrorDir, "a.csv.report.json"))
+			if !test.failed {
+				if err == nil {
+					t.Errorf("got a report for a loaded file: %s", b)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var summary UploadSummary
+			if err := json.Unmarshal(b, &summary); err != nil {
+				t.Fatal(err)
+			}
+			if summary.Loaded || len(summary.Errors) == 0 {
+				t.Errorf("got report %s", b)
+			}
+		})
+	}
+}
+
+func TestWatcherPoll(t *testing.T) {
+	watcher := newTestWatcher(t, &testSink{})
+	for _, name := range []string{"a.csv", "b.csv.part", ".c.csv"} {
+		if err := os.WriteFile(filepath.Join(watcher.Dir, name), []byte(testHeaderLine), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Ready once unchanged for StablePolls polls after the poll that last saw it change.
+	for i, want := range [][]string{nil, nil, nil, {"a.csv"}, nil} {
+		ready, err := watcher.poll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(ready, want) {
+			t.Errorf("poll %d: got %v, want %v", i, ready, want)
+		}
+		if i == 0 {
+			// A file still growing starts over.
+			os.WriteFile(filepath.Join(watcher.Dir, "a.csv"), []byte(testHeaderLine+"\n"), 0o644)
+		}
+	}
+}
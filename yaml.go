@@ -0,0 +1,341 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidYaml = errors.New("invalid or unsupported YAML")
+
+// yamlLine is a line of a YAML document, without its indentation and comment.
+type yamlLine struct {
+	Number int
+	Indent int
+	Text   string
+}
+
+// yamlParser reads the subset of YAML used for configuration files: block mappings and sequences, single-line flow collections ([a, b] and {a: b}), and plain, single- or double-quoted scalars. Anchors, aliases, tags, block scalars (| and >) and multiple documents are not supported.
+type yamlParser struct {
+	lines []yamlLine
+	next  int
+}
+
+// yamlToJson converts a YAML document to JSON, so that it can be decoded, and checked, as JSON is. Plain scalars are numbers, true, false or null where they read as such, and otherwise strings.
+func yamlToJson(data []byte) ([]byte, error) {
+	parser := &yamlParser{}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(yamlStripComment(strings.TrimSuffix(line, "\r")), " \t")
+		text := strings.TrimLeft(line, " ")
+		if text == "" || len(parser.lines) == 0 && text == "---" {
+			continue
+		}
+		if text[0] == '\t' {
+			return nil, fmt.Errorf("%w: line %d: tab in indentation", ErrInvalidYaml, i+1)
+		}
+		parser.lines = append(parser.lines, yamlLine{Number: i + 1, Indent: len(line) - len(text), Text: text})
+	}
+	if len(parser.lines) == 0 {
+		return []byte("null"), nil
+	}
+
+	value, err := parser.parseNode(0)
+	if err != nil {
+		return nil, err
+	}
+	if parser.next < len(parser.lines) {
+		return nil, parser.errorf("unexpected indentation")
+	}
+
+	return json.Marshal(value)
+}
+
+// yamlStripComment removes a comment, a # at the start of line or after a space, outside quotes.
+func yamlStripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || strings.IndexByte(" \t[{,:", line[i-1]) >= 0 {
+				quote = c
+			}
+		case c == '#':
+			if i == 0 || line[i-1] == ' ' || line[i-1] == '\t' {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
+
+func (parser *yamlParser) errorf(format string, args ...any) error {
+	line := parser.lines[min(parser.next, len(parser.lines)-1)].Number
+	return fmt.Errorf("%w: line %d: %s", ErrInvalidYaml, line, fmt.Sprintf(format, args...))
+}
+
+func yamlSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// parseNode parses the block node starting at the next line, if it is indented by at least indent.
+func (parser *yamlParser) parseNode(indent int) (any, error) {
+	if parser.next >= len(parser.lines) || parser.lines[parser.next].Indent < indent {
+		return nil, nil
+	}
+	line := parser.lines[parser.next]
+	if yamlSequenceItem(line.Text) {
+		return parser.parseSequence(line.Indent)
+	}
+	if _, _, ok := yamlCutKey(line.Text); !ok {
+		// A scalar or flow collection on its own line.
+		parser.next++
+		return parser.parseFlow(line.Text)
+	}
+	return parser.parseMapping(line.Indent)
+}
+
+func (parser *yamlParser) parseSequence(indent int) ([]any, error) {
+	sequence := []any{}
+	for parser.next < len(parser.lines) && parser.lines[parser.next].Indent == indent && yamlSequenceItem(parser.lines[parser.next].Text) {
+		line := &parser.lines[parser.next]
+		item := strings.TrimLeft(line.Text[1:], " ")
+		var value any
+		var err error
+		if item == "" {
+			parser.next++
+			value, err = parser.parseNode(indent + 1)
+		} else {
+			// The item's node starts on the same line, indented to where it starts, e.g. "- name: summer".
+			line.Indent += len(line.Text) - len(item)
+			line.Text = item
+			value, err = parser.parseNode(line.Indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		sequence = append(sequence, value)
+	}
+	return sequence, nil
+}
+
+func (parser *yamlParser) parseMapping(indent int) (map[string]any, error) {
+	mapping := map[string]any{}
+	for parser.next < len(parser.lines) && parser.lines[parser.next].Indent == indent {
+		line := parser.lines[parser.next]
+		key, value, ok := yamlCutKey(line.Text)
+		if !ok {
+			return nil, parser.errorf("want key: value")
+		}
+		if key, ok = yamlKey(key); !ok {
+			return nil, parser.errorf("invalid key %s", key)
+		}
+		if _, ok := mapping[key]; ok {
+			return nil, parser.errorf("duplicate key %s", key)
+		}
+		parser.next++
+
+		var err error
+		switch {
+		case value != "":
+			mapping[key], err = parser.parseFlow(value)
+		case parser.next < len(parser.lines) && parser.lines[parser.next].Indent == indent && yamlSequenceItem(parser.lines[parser.next].Text):
+			// A sequence may be indented as far as its key.
+			mapping[key], err = parser.parseSequence(indent)
+		default:
+			mapping[key], err = parser.parseNode(indent + 1)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return mapping, nil
+}
+
+// yamlCutKey splits a block mapping entry at the colon after its key, outside quotes.
+func yamlCutKey(text string) (key string, value string, ok bool) {
+	if text == "" || text[0] == '[' || text[0] == '{' {
+		return "", "", false
+	}
+	i := 0
+	if text[0] == '"' || text[0] == '\'' {
+		end := yamlQuoteEnd(text)
+		if end < 0 {
+			return "", "", false
+		}
+		i = end
+	}
+	for ; i < len(text); i++ {
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+			return strings.TrimRight(text[:i], " "), strings.TrimLeft(text[i+1:], " "), true
+		}
+	}
+	return "", "", false
+}
+
+// yamlKey returns the string of a plain or quoted key.
+func yamlKey(text string) (string, bool) {
+	if text != "" && (text[0] == '"' || text[0] == '\'') {
+		if yamlQuoteEnd(text) != len(text) {
+			return text, false
+		}
+		return yamlUnquote(text)
+	}
+	return text, text != "" && strings.IndexByte("[]{},&*!|>%@`", text[0]) < 0
+}
+
+// yamlQuoteEnd returns the index after the closing quote of the quoted scalar text starts with, or -1.
+func yamlQuoteEnd(text string) int {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case text[i] == '\\' && quote == '"':
+			i++
+		case text[i] == quote && quote == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == quote:
+			return i + 1
+		}
+	}
+	return -1
+}
+
+func yamlUnquote(text string) (string, bool) {
+	if text[0] == '\'' {
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), true
+	}
+	// YAML's double-quoted escapes are a superset of JSON's; those used in configuration files are common to both.
+	var s string
+	if err := json.Unmarshal([]byte(text), &s); err != nil {
+		return "", false
+	}
+	return s, true
+}
+
+// parseFlow parses a scalar or a single-line flow collection.
+func (parser *yamlParser) parseFlow(text string) (any, error) {
+	value, rest, err := parser.parseFlowValue(text, false)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimLeft(rest, " ") != "" {
+		return nil, parser.errorf("unexpected %q", rest)
+	}
+	return value, nil
+}
+
+// parseFlowValue parses the value text starts with, and returns the rest of text. In a flow collection, a plain scalar ends at a comma, closing bracket or key colon.
+func (parser *yamlParser) parseFlowValue(text string, inFlow bool) (any, string, error) {
+	text = strings.TrimLeft(text, " ")
+	if text == "" {
+		if inFlow {
+			return nil, "", parser.errorf("unterminated flow collection")
+		}
+		return nil, "", nil
+	}
+
+	switch text[0] {
+	case '[':
+		sequence := []any{}
+		rest := strings.TrimLeft(text[1:], " ")
+		for !strings.HasPrefix(rest, "]") {
+			value, after, err := parser.parseFlowValue(rest, true)
+			if err != nil {
+				return nil, "", err
+			}
+			sequence = append(sequence, value)
+			if rest, err = parser.flowSeparator(after, ']'); err != nil {
+				return nil, "", err
+			}
+		}
+		return sequence, rest[1:], nil
+
+	case '{':
+		mapping := map[string]any{}
+		rest := strings.TrimLeft(text[1:], " ")
+		for !strings.HasPrefix(rest, "}") {
+			key, after, err := parser.parseFlowValue(rest, true)
+			if err != nil {
+				return nil, "", err
+			}
+			name, ok := key.(string)
+			if !ok || !strings.HasPrefix(after, ":") {
+				return nil, "", parser.errorf("want key: value in %q", text)
+			}
+			if _, ok := mapping[name]; ok {
+				return nil, "", parser.errorf("duplicate key %s", name)
+			}
+			if mapping[name], after, err = parser.parseFlowValue(after[1:], true); err != nil {
+				return nil, "", err
+			}
+			if rest, err = parser.flowSeparator(after, '}'); err != nil {
+				return nil, "", err
+			}
+		}
+		return mapping, rest[1:], nil
+
+	case '"', '\'':
+		end := yamlQuoteEnd(text)
+		if end < 0 {
+			return nil, "", parser.errorf("unterminated string %s", text)
+		}
+		s, ok := yamlUnquote(text[:end])
+		if !ok {
+			return nil, "", parser.errorf("invalid string %s", text[:end])
+		}
+		return s, strings.TrimLeft(text[end:], " "), nil
+
+	case ']', '}', ',', '&', '*', '!', '|', '>', '%', '@', '`':
+		return nil, "", parser.errorf("unsupported %q", text)
+	}
+
+	end := len(text)
+	if inFlow {
+		for i := 0; i < len(text); i++ {
+			if text[i] == ',' || text[i] == ']' || text[i] == '}' || text[i] == ':' && (i+1 == len(text) || strings.IndexByte(" ,]}", text[i+1]) >= 0) {
+				end = i
+				break
+			}
+		}
+	}
+	return yamlScalar(strings.TrimRight(text[:end], " ")), text[end:], nil
+}
+
+// flowSeparator skips the comma after a value in a flow collection, and returns the rest from the next value or the closing bracket.
+func (parser *yamlParser) flowSeparator(text string, closing byte) (string, error) {
+	text = strings.TrimLeft(text, " ")
+	switch {
+	case strings.HasPrefix(text, ","):
+		return strings.TrimLeft(text[1:], " "), nil
+	case text != "" && text[0] == closing:
+		return text, nil
+	}
+	return "", parser.errorf("want , or %c in flow collection", closing)
+}
+
+// yamlScalar resolves a plain scalar to a number, true, false, null or a string.
+func yamlScalar(text string) any {
+	switch text {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if text[0] == '-' || text[0] >= '0' && text[0] <= '9' {
+		if json.Valid([]byte(text)) {
+			return json.Number(text)
+		}
+	}
+	return text
+}
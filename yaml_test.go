@@ -0,0 +1,40 @@
+// Copyright (c) 2025 Cheejyg. All Rights Reserved.
+
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestYamlToJson(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		json string
+		err  error
+	}{
+		{"mapping", "a: 1\nb: text # comment\nc: \"quoted # not a comment\"\n", `{"a":1,"b":"text","c":"quoted # not a comment"}`, nil},
+		{"scalars", "a: -1.5\nb: true\nc: ~\nd: 14:00\ne: 2005-01-01\nf: 'it''s'\ng:\n", `{"a":-1.5,"b":true,"c":null,"d":"14:00","e":"2005-01-01","f":"it's","g":null}`, nil},
+		{"nested", "a:\n  b:\n    c: 1\n  d: 2\n", `{"a":{"b":{"c":1},"d":2}}`, nil},
+		{"sequence", "a:\n  - 1\n  - x\nb:\n- 2\n", `{"a":[1,"x"],"b":[2]}`, nil},
+		{"sequence of mappings", "- a: 1\n  b: [x, y]\n-\n  a: 2\n- - 3\n", `[{"a":1,"b":["x","y"]},{"a":2},[3]]`, nil},
+		{"flow", "a: {b: [1, \"2\"], c: {}, 'd': []}\n", `{"a":{"b":[1,"2"],"c":{},"d":[]}}`, nil},
+		{"document marker", "---\r\na: 1\r\n", `{"a":1}`, nil},
+		{"empty", "# nothing\n", `null`, nil},
+		{"duplicate key", "a: 1\na: 2\n", "", ErrInvalidYaml},
+		{"bad indentation", "a: 1\n  b: 2\n", "", ErrInvalidYaml},
+		{"unterminated flow", "a: [1, 2\n", "", ErrInvalidYaml},
+		{"unterminated string", "a: \"x\n", "", ErrInvalidYaml},
+		{"block scalar", "a: |\n  text\n", "", ErrInvalidYaml},
+		{"alias", "a: *b\n", "", ErrInvalidYaml},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := yamlToJson([]byte(test.yaml))
+			if !errors.Is(err, test.err) || string(got) != test.json {
+				t.Errorf("got %s, %v, want %s, %v", got, err, test.json, test.err)
+			}
+		})
+	}
+}